@@ -0,0 +1,84 @@
+// importer seeds the movies table from the catalog CSVs (data/*.csv) without calling OMDb.
+//
+//	go run ./cmd/importer                 # every data/*.csv
+//	go run ./cmd/importer data/war.csv    # selected files or directories
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"totallyguysproject/internal/catalog"
+	"totallyguysproject/internal/database"
+)
+
+func main() {
+	batch := flag.Int("batch", 500, "rows per insert batch")
+	verbose := flag.Bool("v", false, "print rejected rows")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"data"}
+	}
+	files, err := csvFiles(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files) == 0 {
+		log.Fatal("no csv files found")
+	}
+
+	db := database.InitDB()
+	im := catalog.NewImporter(db, *batch)
+
+	start := time.Now()
+	for _, f := range files {
+		before := im.Stats
+		if err := im.ImportFile(f); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%-30s inserted %6d  updated %6d  rejected %5d\n", f,
+			im.Stats.Inserted-before.Inserted,
+			im.Stats.Updated-before.Updated,
+			im.Stats.Rejected-before.Rejected)
+	}
+
+	fmt.Printf("\ntotal: inserted %d, updated %d, rejected %d in %s\n",
+		im.Stats.Inserted, im.Stats.Updated, im.Stats.Rejected, time.Since(start).Round(time.Millisecond))
+
+	if *verbose {
+		for _, r := range im.Stats.Rejections {
+			fmt.Println("rejected:", r)
+		}
+		if im.Stats.Rejected > len(im.Stats.Rejections) {
+			fmt.Printf("... and %d more\n", im.Stats.Rejected-len(im.Stats.Rejections))
+		}
+	}
+}
+
+// csvFiles expands directories into their *.csv files.
+func csvFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.csv"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -0,0 +1,37 @@
+// repair-ratings recomputes avg_rating, review_count and the rating histogram of movies from reviews.
+//
+//	go run ./cmd/repair-ratings            # every movie
+//	go run ./cmd/repair-ratings 12 40 41   # selected movie ids
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+	"totallyguysproject/internal/database"
+	"totallyguysproject/internal/ratings"
+)
+
+func main() {
+	flag.Parse()
+
+	var ids []uint
+	for _, arg := range flag.Args() {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid movie id %q", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	db := database.InitDB()
+
+	start := time.Now()
+	fixed, err := ratings.Recompute(db, ids)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("repaired %d movies in %s\n", fixed, time.Since(start).Round(time.Millisecond))
+}
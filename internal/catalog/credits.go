@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// creditsSQL lists (movie, role, billing, name, nm-id) from the comma-separated
+// director/actors columns. director_ids/star_ids hold the known nm-ids in the same
+// order, missing ids are always at the end, so position n of both lists match.
+const creditsSQL = `
+	SELECT m.id AS movie_id, 'director' AS role, n.ord AS billing,
+		trim(n.name) AS name, NULLIF(trim(i.id), '') AS imdb_id
+	FROM movies m
+	CROSS JOIN LATERAL unnest(string_to_array(m.director, ',')) WITH ORDINALITY AS n(name, ord)
+	LEFT JOIN LATERAL unnest(string_to_array(NULLIF(m.director_ids, ''), ',')) WITH ORDINALITY AS i(id, ord) ON i.ord = n.ord
+	WHERE m.deleted_at IS NULL AND trim(n.name) NOT IN ('', 'N/A')%[1]s
+	UNION ALL
+	SELECT m.id, 'actor', n.ord,
+		trim(n.name), NULLIF(trim(i.id), '')
+	FROM movies m
+	CROSS JOIN LATERAL unnest(string_to_array(m.actors, ',')) WITH ORDINALITY AS n(name, ord)
+	LEFT JOIN LATERAL unnest(string_to_array(NULLIF(m.star_ids, ''), ',')) WITH ORDINALITY AS i(id, ord) ON i.ord = n.ord
+	WHERE m.deleted_at IS NULL AND trim(n.name) NOT IN ('', 'N/A')%[1]s`
+
+// SyncCredits rebuilds people and movie_credits from the director/actors columns.
+// People are matched by nm-id when the source has one, by name otherwise; a name-only
+// person gets its nm-id once a CSV row brings it. With movieIDs == nil every movie is synced.
+func SyncCredits(db *gorm.DB, movieIDs []uint) error {
+	scope := ""
+	var args []interface{}
+	if movieIDs != nil {
+		if len(movieIDs) == 0 {
+			return nil
+		}
+		scope = " AND m.id IN @ids"
+		args = append(args, map[string]interface{}{"ids": movieIDs})
+	}
+	credits := "WITH credits AS (" + fmt.Sprintf(creditsSQL, scope) + ")"
+
+	steps := []string{
+		// name-only people learn their nm-id
+		credits + `
+		UPDATE people SET imdb_id = c.imdb_id
+		FROM (SELECT DISTINCT ON (imdb_id) imdb_id, name FROM credits WHERE imdb_id IS NOT NULL) c
+		WHERE people.imdb_id IS NULL AND lower(people.name) = lower(c.name)
+			AND NOT EXISTS (SELECT 1 FROM people p WHERE p.imdb_id = c.imdb_id)`,
+
+		credits + `
+		INSERT INTO people (imdb_id, name)
+		SELECT DISTINCT ON (imdb_id) imdb_id, name FROM credits WHERE imdb_id IS NOT NULL
+		ON CONFLICT DO NOTHING`,
+
+		credits + `
+		INSERT INTO people (name)
+		SELECT DISTINCT ON (lower(name)) name FROM credits c
+		WHERE c.imdb_id IS NULL AND NOT EXISTS (SELECT 1 FROM people p WHERE lower(p.name) = lower(c.name))
+		ON CONFLICT DO NOTHING`,
+	}
+	if movieIDs != nil {
+		steps = append(steps, "DELETE FROM movie_credits WHERE movie_id IN @ids")
+	}
+	// a name-only credit goes to the name-only person first, then to the oldest namesake
+	steps = append(steps, credits+`
+		INSERT INTO movie_credits (movie_id, person_id, role, billing)
+		SELECT DISTINCT ON (c.movie_id, p.id, c.role) c.movie_id, p.id, c.role, c.billing
+		FROM credits c
+		CROSS JOIN LATERAL (
+			SELECT people.id FROM people
+			WHERE (c.imdb_id IS NOT NULL AND people.imdb_id = c.imdb_id)
+				OR (c.imdb_id IS NULL AND lower(people.name) = lower(c.name))
+			ORDER BY people.imdb_id IS NULL DESC, people.id
+			LIMIT 1
+		) p
+		ORDER BY c.movie_id, p.id, c.role, c.billing
+		ON CONFLICT DO NOTHING`)
+
+	for _, stmt := range steps {
+		if err := db.Exec(stmt, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
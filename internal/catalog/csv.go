@@ -0,0 +1,210 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// columns of data/*.csv
+var header = []string{
+	"movie_id", "movie_name", "year", "certificate", "runtime", "genre", "rating",
+	"description", "director", "director_id", "star", "star_id", "votes", "gross(in $)",
+}
+
+var (
+	imdbIDRe   = regexp.MustCompile(`^tt\d+$`)
+	personIDRe = regexp.MustCompile(`nm\d+`)
+	yearRe     = regexp.MustCompile(`^\d{4}$`)
+)
+
+// placeholder descriptions from the IMDb scrape
+var noPlot = map[string]bool{
+	"Add a Plot": true,
+}
+
+// Credit is a person named in a row, PersonID is the imdb nm-id when known.
+type Credit struct {
+	Name     string
+	PersonID string
+}
+
+// Row is one parsed catalog line.
+type Row struct {
+	IMDbID      string
+	Title       string
+	Year        string
+	Certificate string
+	Runtime     string
+	Genres      []string
+	Rating      string
+	Plot        string
+	Directors   []Credit
+	Stars       []Credit
+	Votes       int
+	Gross       int64
+}
+
+// Reader streams Rows from one CSV file, quoted multiline fields included.
+type Reader struct {
+	r    *csv.Reader
+	cols map[string]int
+	line int // where the last record started in the file
+}
+
+func NewReader(in io.Reader) (*Reader, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+
+	first, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("catalog: failed to read header: %w", err)
+	}
+	cols := make(map[string]int, len(first))
+	for i, name := range first {
+		cols[strings.TrimSpace(name)] = i
+	}
+	for _, name := range header[:3] {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("catalog: missing column %q", name)
+		}
+	}
+
+	return &Reader{r: r, cols: cols, line: 1}, nil
+}
+
+// Next returns the next row. A *RowError means the line was rejected
+// and reading may continue, io.EOF ends the file.
+func (cr *Reader) Next() (*Row, error) {
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			cr.line = perr.StartLine
+			return nil, &RowError{Line: cr.line, Reason: err.Error()}
+		}
+		return nil, err
+	}
+	// quoted fields span lines, so records and lines don't count alike
+	cr.line, _ = cr.r.FieldPos(0)
+
+	get := func(name string) string {
+		i, ok := cr.cols[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := &Row{
+		IMDbID:      get("movie_id"),
+		Title:       get("movie_name"),
+		Certificate: get("certificate"),
+		Runtime:     get("runtime"),
+		Rating:      get("rating"),
+		Plot:        get("description"),
+	}
+	if !imdbIDRe.MatchString(row.IMDbID) {
+		return nil, &RowError{Line: cr.line, Reason: fmt.Sprintf("invalid movie_id %q", row.IMDbID)}
+	}
+	if row.Title == "" {
+		return nil, &RowError{Line: cr.line, Reason: "empty movie_name"}
+	}
+
+	if year := get("year"); yearRe.MatchString(year) {
+		row.Year = year
+	}
+	if noPlot[row.Plot] {
+		row.Plot = ""
+	}
+	row.Genres = splitList(get("genre"))
+	row.Votes = int(parseNumber(get("votes")))
+	row.Gross = parseNumber(get("gross(in $)"))
+
+	// the scrape puts the first director's id in director_id and
+	// every other director id in front of the star ids
+	directors := splitList(get("director"))
+	stars := splitList(get("star"))
+	ids := personIDRe.FindAllString(get("director_id")+","+get("star_id"), -1)
+	row.Directors = credits(directors, ids)
+	if len(ids) > len(directors) {
+		row.Stars = credits(stars, ids[len(directors):])
+	} else {
+		row.Stars = credits(stars, nil)
+	}
+
+	return row, nil
+}
+
+// RowError is a rejected line.
+type RowError struct {
+	Line   int
+	Reason string
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+func credits(names, ids []string) []Credit {
+	out := make([]Credit, 0, len(names))
+	for i, name := range names {
+		c := Credit{Name: name}
+		if i < len(ids) {
+			c.PersonID = ids[i]
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// splitList splits "a, \nb, \nc" into trimmed names.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// parseNumber reads "189732.0" or "1,234" and returns 0 for anything else.
+func parseNumber(s string) int64 {
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f)
+}
+
+// Names joins credit names the way OMDb does ("A, B, C").
+func Names(cs []Credit) string {
+	names := make([]string, 0, len(cs))
+	for _, c := range cs {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// IDs joins the known nm-ids of credits with commas.
+func IDs(cs []Credit) string {
+	ids := make([]string, 0, len(cs))
+	for _, c := range cs {
+		if c.PersonID != "" {
+			ids = append(ids, c.PersonID)
+		}
+	}
+	return strings.Join(ids, ",")
+}
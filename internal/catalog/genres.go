@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// GenreSlug turns "Film-Noir" or "Science Fiction" into "film-noir" / "science-fiction".
+func GenreSlug(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// genreSlugSQL is GenreSlug for a SQL expression.
+func genreSlugSQL(expr string) string {
+	return "lower(regexp_replace(trim(" + expr + "), '\\s+', '-', 'g'))"
+}
+
+// SyncGenres rebuilds movie_genres from the comma-separated movies.genre column.
+// With movieIDs == nil every movie is linked (used for the first backfill).
+func SyncGenres(db *gorm.DB, movieIDs []uint) error {
+	scope := ""
+	var args []interface{}
+	if movieIDs != nil {
+		if len(movieIDs) == 0 {
+			return nil
+		}
+		scope = " AND m.id IN ?"
+		args = append(args, movieIDs)
+	}
+
+	if err := db.Exec(`
+		INSERT INTO genres (name, slug)
+		SELECT DISTINCT ON (`+genreSlugSQL("g.name")+`) trim(g.name), `+genreSlugSQL("g.name")+`
+		FROM movies m CROSS JOIN LATERAL unnest(string_to_array(m.genre, ',')) AS g(name)
+		WHERE trim(g.name) NOT IN ('', 'N/A')`+scope+`
+		ON CONFLICT DO NOTHING
+	`, args...).Error; err != nil {
+		return err
+	}
+
+	if movieIDs != nil {
+		if err := db.Exec("DELETE FROM movie_genres WHERE movie_id IN ?", movieIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Exec(`
+		INSERT INTO movie_genres (movie_id, genre_id)
+		SELECT DISTINCT m.id, genres.id
+		FROM movies m CROSS JOIN LATERAL unnest(string_to_array(m.genre, ',')) AS g(name)
+		JOIN genres ON genres.slug = `+genreSlugSQL("g.name")+`
+		WHERE m.deleted_at IS NULL`+scope+`
+		ON CONFLICT DO NOTHING
+	`, args...).Error
+}
@@ -0,0 +1,236 @@
+package catalog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Stats is the import report.
+type Stats struct {
+	Inserted int
+	Updated  int
+	Rejected int
+	// Rejections keeps the first MaxRejections reasons ("file: line N: ...")
+	Rejections []string
+}
+
+const MaxRejections = 100
+
+func (s *Stats) reject(file string, err error) {
+	s.Rejected++
+	if len(s.Rejections) < MaxRejections {
+		s.Rejections = append(s.Rejections, file+": "+err.Error())
+	}
+}
+
+// Importer upserts catalog rows into movies by omdb_id, in batches, without calling OMDb.
+type Importer struct {
+	db        *gorm.DB
+	BatchSize int
+	Stats     Stats
+
+	batch map[string]*Row
+	order []string
+}
+
+func NewImporter(db *gorm.DB, batchSize int) *Importer {
+	if batchSize < 1 {
+		batchSize = 500
+	}
+	return &Importer{
+		db:        db,
+		BatchSize: batchSize,
+		batch:     make(map[string]*Row, batchSize),
+	}
+}
+
+// ImportFile streams one CSV file into the database.
+func (im *Importer) ImportFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if rowErr, ok := err.(*RowError); ok {
+			im.Stats.reject(path, rowErr)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := im.Add(row); err != nil {
+			return err
+		}
+	}
+	return im.Flush()
+}
+
+// Add queues a row and writes the batch once it is full.
+// The same movie seen twice in a batch is merged, later values win.
+func (im *Importer) Add(row *Row) error {
+	if prev, ok := im.batch[row.IMDbID]; ok {
+		im.Stats.Updated++
+		mergeRow(prev, row)
+		return nil
+	}
+	im.batch[row.IMDbID] = row
+	im.order = append(im.order, row.IMDbID)
+	if len(im.order) >= im.BatchSize {
+		return im.Flush()
+	}
+	return nil
+}
+
+// Flush writes the queued rows in one transaction.
+func (im *Importer) Flush() error {
+	if len(im.order) == 0 {
+		return nil
+	}
+
+	err := im.db.Transaction(func(tx *gorm.DB) error {
+		var existing []string
+		if err := tx.Unscoped().Model(&models.Movie{}).
+			Where("omdb_id IN ?", im.order).
+			Pluck("omdb_id", &existing).Error; err != nil {
+			return err
+		}
+
+		movies := make([]models.Movie, 0, len(im.order))
+		for _, id := range im.order {
+			movies = append(movies, movieFromRow(im.batch[id]))
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "omdb_id"}},
+			DoUpdates: upsertAssignments,
+		}).Create(&movies).Error; err != nil {
+			return err
+		}
+
+		ids := make([]uint, 0, len(movies))
+		for _, m := range movies {
+			ids = append(ids, m.ID)
+		}
+		if err := SyncGenres(tx, ids); err != nil {
+			return err
+		}
+		if err := SyncCredits(tx, ids); err != nil {
+			return err
+		}
+
+		im.Stats.Updated += len(existing)
+		im.Stats.Inserted += len(movies) - len(existing)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("catalog: batch write failed: %w", err)
+	}
+
+	im.batch = make(map[string]*Row, im.BatchSize)
+	im.order = im.order[:0]
+	return nil
+}
+
+// upsertAssignments overwrite title and keep existing values wherever the CSV is empty.
+// Columns locked by an admin edit are never touched.
+var upsertAssignments = clause.Set{
+	{Column: clause.Column{Name: "title"}, Value: gorm.Expr(
+		"CASE WHEN " + lockedSQL("title") + " THEN movies.title ELSE EXCLUDED.title END")},
+	keepExisting("year", "year", "''"),
+	keepExisting("certificate", "certificate", "''"),
+	keepExisting("runtime", "runtime", "''"),
+	keepExisting("genre", "genre", "''"),
+	keepExisting("rating", "rating", "''"),
+	keepExisting("plot", "plot", "''"),
+	keepExisting("director", "director", "''"),
+	keepExisting("actors", "actors", "''"),
+	keepExisting("director_ids", "director", "''"),
+	keepExisting("star_ids", "actors", "''"),
+	keepExisting("votes", "votes", "0"),
+	keepExisting("gross", "gross", "0"),
+	{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("EXCLUDED.updated_at")},
+}
+
+// keepExisting writes the CSV value unless it is empty or lock is locked on the row.
+func keepExisting(column, lock, empty string) clause.Assignment {
+	return clause.Assignment{
+		Column: clause.Column{Name: column},
+		Value: gorm.Expr(fmt.Sprintf("CASE WHEN %s THEN movies.%s ELSE COALESCE(NULLIF(EXCLUDED.%s, %s), movies.%s) END",
+			lockedSQL(lock), column, column, empty, column)),
+	}
+}
+
+// lockedSQL is models.Movie.Locked for the existing row of an upsert.
+func lockedSQL(column string) string {
+	return fmt.Sprintf("'%s' = ANY(string_to_array(movies.locked_fields, ','))", column)
+}
+
+func movieFromRow(r *Row) models.Movie {
+	return models.Movie{
+		OMDBID:      r.IMDbID,
+		Title:       r.Title,
+		Year:        r.Year,
+		Certificate: r.Certificate,
+		Runtime:     r.Runtime,
+		Genre:       strings.Join(r.Genres, ", "),
+		Rating:      r.Rating,
+		Plot:        r.Plot,
+		Director:    Names(r.Directors),
+		Actors:      Names(r.Stars),
+		DirectorIDs: IDs(r.Directors),
+		StarIDs:     IDs(r.Stars),
+		Votes:       r.Votes,
+		Gross:       r.Gross,
+	}
+}
+
+// mergeRow copies the non-empty fields of src over dst.
+func mergeRow(dst, src *Row) {
+	if src.Year != "" {
+		dst.Year = src.Year
+	}
+	if src.Certificate != "" {
+		dst.Certificate = src.Certificate
+	}
+	if src.Runtime != "" {
+		dst.Runtime = src.Runtime
+	}
+	if len(src.Genres) > 0 {
+		dst.Genres = src.Genres
+	}
+	if src.Rating != "" {
+		dst.Rating = src.Rating
+	}
+	if src.Plot != "" {
+		dst.Plot = src.Plot
+	}
+	if len(src.Directors) > 0 {
+		dst.Directors = src.Directors
+	}
+	if len(src.Stars) > 0 {
+		dst.Stars = src.Stars
+	}
+	if src.Votes > 0 {
+		dst.Votes = src.Votes
+	}
+	if src.Gross > 0 {
+		dst.Gross = src.Gross
+	}
+}
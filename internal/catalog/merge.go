@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"sort"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ratings"
+
+	"gorm.io/gorm"
+)
+
+// MergeStats reports what a merge moved and what it had to drop.
+type MergeStats struct {
+	ReviewsMoved    int64    `json:"reviews_moved"`
+	ReviewsDropped  int64    `json:"reviews_dropped"` // the user had reviewed the canonical movie too
+	EntriesMoved    int64    `json:"playlist_entries_moved"`
+	EntriesDropped  int64    `json:"playlist_entries_dropped"` // the playlist had both movies
+	FieldsCopied    []string `json:"fields_copied"`
+	DuplicateOMDBID string   `json:"duplicate_omdb_id"`
+}
+
+// MergeMovies folds duplicate into canonical and deletes duplicate. Run it in a transaction.
+//
+// Reviews and playlist entries (likes, watch-later, ...) move over unless the user or
+// playlist already has the canonical movie: reviews and playlist_movies are unique per
+// (user, movie) and (playlist, movie), so the canonical row wins and the other is dropped.
+// Empty, unlocked canonical fields are filled from the duplicate.
+func MergeMovies(tx *gorm.DB, canonical, duplicate *models.Movie) (*MergeStats, error) {
+	stats := &MergeStats{FieldsCopied: []string{}, DuplicateOMDBID: duplicate.OMDBID}
+
+	// reviews; raw SQL so soft-deleted rows count for the unique index too
+	res := tx.Exec(`
+		UPDATE reviews SET movie_id = ?
+		WHERE movie_id = ? AND user_id NOT IN (SELECT user_id FROM reviews WHERE movie_id = ?)`,
+		canonical.ID, duplicate.ID, canonical.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	stats.ReviewsMoved = res.RowsAffected
+
+	// what is left on the duplicate is dropped below, and diary entries lose their link to it
+	if err := tx.Exec(`
+		UPDATE diary_entries SET review_id = NULL
+		WHERE movie_id = ? AND review_id IN (SELECT id FROM reviews WHERE movie_id = ?)`,
+		duplicate.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec(`
+		DELETE FROM comment_votes WHERE comment_id IN (
+			SELECT comments.id FROM comments JOIN reviews ON reviews.id = comments.review_id
+			WHERE reviews.movie_id = ?)`, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec(`
+		DELETE FROM comments WHERE review_id IN (SELECT id FROM reviews WHERE movie_id = ?)`,
+		duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec(`
+		DELETE FROM review_reactions WHERE review_id IN (SELECT id FROM reviews WHERE movie_id = ?)`,
+		duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	res = tx.Exec("DELETE FROM reviews WHERE movie_id = ?", duplicate.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	stats.ReviewsDropped = res.RowsAffected
+
+	// diary entries are viewings, they all move
+	if err := tx.Exec("UPDATE diary_entries SET movie_id = ? WHERE movie_id = ?",
+		canonical.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+
+	// playlist entries; a dropped entry hands its description to the kept one
+	if err := tx.Exec(`
+		UPDATE playlist_movies SET description = d.description
+		FROM playlist_movies d
+		WHERE playlist_movies.movie_id = ? AND d.movie_id = ?
+			AND d.playlist_id = playlist_movies.playlist_id
+			AND playlist_movies.description = '' AND d.description <> ''`,
+		canonical.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	res = tx.Exec(`
+		UPDATE playlist_movies SET movie_id = ?
+		WHERE movie_id = ? AND playlist_id NOT IN (SELECT playlist_id FROM playlist_movies WHERE movie_id = ?)`,
+		canonical.ID, duplicate.ID, canonical.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	stats.EntriesMoved = res.RowsAffected
+	res = tx.Exec("DELETE FROM playlist_movies WHERE movie_id = ?", duplicate.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	stats.EntriesDropped = res.RowsAffected
+
+	updates := fillFrom(canonical, duplicate)
+	for column := range updates {
+		stats.FieldsCopied = append(stats.FieldsCopied, column)
+	}
+
+	if err := tx.Exec("DELETE FROM movie_genres WHERE movie_id = ?", duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM movie_credits WHERE movie_id = ?", duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM movie_similarities WHERE movie_id = ? OR similar_id = ?",
+		duplicate.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM item_similarities WHERE movie_id = ? OR other_id = ?",
+		duplicate.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM recommendations WHERE movie_id = ? OR because_id = ?",
+		duplicate.ID, duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM trending_scores WHERE movie_id = ?", duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("DELETE FROM movie_posters WHERE movie_id = ?", duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	// smart playlists pick the canonical movie up on their next refresh
+	if err := tx.Exec("DELETE FROM smart_playlist_movies WHERE movie_id = ?", duplicate.ID).Error; err != nil {
+		return nil, err
+	}
+	// hard delete, so the omdb_id unique index lets the canonical movie take it over
+	if err := tx.Unscoped().Delete(duplicate).Error; err != nil {
+		return nil, err
+	}
+
+	if canonical.OMDBID == "" && duplicate.OMDBID != "" {
+		updates["omdb_id"] = duplicate.OMDBID
+		stats.FieldsCopied = append(stats.FieldsCopied, "omdb_id")
+	}
+	sort.Strings(stats.FieldsCopied)
+	if len(updates) > 0 {
+		if err := tx.Model(canonical).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := SyncGenres(tx, []uint{canonical.ID}); err != nil {
+		return nil, err
+	}
+	if err := SyncCredits(tx, []uint{canonical.ID}); err != nil {
+		return nil, err
+	}
+	if _, err := ratings.Recompute(tx, []uint{canonical.ID}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// fillFrom returns the empty, unlocked columns of dst that src has a value for.
+func fillFrom(dst, src *models.Movie) map[string]interface{} {
+	updates := make(map[string]interface{})
+	fill := func(column, dstVal, srcVal string) {
+		if dstVal == "" && srcVal != "" && !dst.Locked(column) {
+			updates[column] = srcVal
+		}
+	}
+	fill("year", dst.Year, src.Year)
+	fill("plot", dst.Plot, src.Plot)
+	fill("poster", dst.Poster, src.Poster)
+	fill("genre", dst.Genre, src.Genre)
+	fill("rating", dst.Rating, src.Rating)
+	fill("certificate", dst.Certificate, src.Certificate)
+	fill("runtime", dst.Runtime, src.Runtime)
+	fill("director", dst.Director, src.Director)
+	fill("actors", dst.Actors, src.Actors)
+	// nm-ids only make sense next to the names they came with
+	if _, ok := updates["director"]; ok {
+		updates["director_ids"] = src.DirectorIDs
+	}
+	if _, ok := updates["actors"]; ok {
+		updates["star_ids"] = src.StarIDs
+	}
+	if dst.Votes == 0 && src.Votes > 0 && !dst.Locked("votes") {
+		updates["votes"] = src.Votes
+	}
+	if dst.Gross == 0 && src.Gross > 0 && !dst.Locked("gross") {
+		updates["gross"] = src.Gross
+	}
+	return updates
+}
@@ -4,7 +4,9 @@ import (
     "fmt"
     "log"
     "os"
+    "totallyguysproject/internal/catalog"
     "totallyguysproject/internal/models"
+    "totallyguysproject/internal/ratings"
 
     "gorm.io/driver/postgres"
     "gorm.io/gorm"
@@ -28,6 +30,11 @@ func InitDB() *gorm.DB {
         log.Fatal("failed to connect to database:", err)
     }
 
+    // rating aggregates came after reviews, count the existing ones once
+    backfillRatings := !db.Migrator().HasColumn(&models.Movie{}, "ReviewCount")
+    // playlists were all public before visibility; watch-later starts out private
+    hideWatchLater := !db.Migrator().HasColumn(&models.Playlist{}, "Visibility")
+
     err = db.AutoMigrate(
         &models.User{},
         &models.Movie{},
@@ -38,6 +45,22 @@ func InitDB() *gorm.DB {
         &models.Notification{}, 
         &models.CommentVote{},
         &models.BannedUser{},
+        &models.ProviderCache{},
+        &models.Genre{},
+        &models.Person{},
+        &models.MovieCredit{},
+        &models.MovieSimilarity{},
+        &models.ItemSimilarity{},
+        &models.Recommendation{},
+        &models.TrendingScore{},
+        &models.TrendingSnapshot{},
+        &models.MoviePoster{},
+        &models.DiaryEntry{},
+        &models.ImportJob{},
+        &models.PlaylistCollaborator{},
+        &models.SmartPlaylistMovie{},
+        &models.PlaylistSubscription{},
+        &models.ReviewReaction{},
     )
     if err != nil {
         log.Fatal("failed to migrate database:", err)
@@ -49,6 +72,62 @@ func InitDB() *gorm.DB {
         }
     }
 
+    if err := execAll(db, playlistMovieMigrations); err != nil {
+        log.Fatal("failed to migrate playlist entries", err)
+    }
+
+    if err := execAll(db, trendingMigrations); err != nil {
+        log.Fatal("failed to create activity indexes", err)
+    }
+
+    // system playlists were told apart by name before kind
+    if err := db.Exec(classifyPlaylistKinds).Error; err != nil {
+        log.Fatal("failed to classify playlists", err)
+    }
+
+    if err := execAll(db, playlistKindMigrations); err != nil {
+        log.Fatal("failed to create playlist kind index", err)
+    }
+
+    if hideWatchLater {
+        if err := db.Model(&models.Playlist{}).Where("kind = ?", models.PlaylistWatchlist).
+            Update("visibility", models.VisibilityPrivate).Error; err != nil {
+            log.Fatal("failed to set playlist visibility", err)
+        }
+    }
+
+    // link genres of movies that existed before the genres table
+    var linked int64
+    db.Table("movie_genres").Count(&linked)
+    if linked == 0 {
+        if err := catalog.SyncGenres(db, nil); err != nil {
+            log.Fatal("failed to backfill genres", err)
+        }
+    }
+
+    if backfillRatings {
+        if _, err := ratings.Recompute(db, nil); err != nil {
+            log.Fatal("failed to backfill movie ratings", err)
+        }
+    }
+
+    if err := execAll(db, searchMigrations); err != nil {
+        log.Fatal("failed to create search indexes", err)
+    }
+
+    if err := execAll(db, peopleMigrations); err != nil {
+        log.Fatal("failed to create people indexes", err)
+    }
+
+    // build people from movies that existed before the credits table
+    var credits int64
+    db.Model(&models.MovieCredit{}).Count(&credits)
+    if credits == 0 {
+        if err := catalog.SyncCredits(db, nil); err != nil {
+            log.Fatal("failed to backfill credits", err)
+        }
+    }
+
     fmt.Println("Database connected and migrated")
     return db
 }
\ No newline at end of file
@@ -0,0 +1,73 @@
+package database
+
+import "gorm.io/gorm"
+
+// searchMigrations set up full-text and trigram search over movies.
+// search_vector is generated by Postgres, so it is not part of models.Movie.
+var searchMigrations = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`ALTER TABLE movies ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(director, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(actors, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(plot, '')), 'C')
+	) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_movies_search_vector ON movies USING gin (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_movies_title_trgm ON movies USING gin (title gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_movies_director_trgm ON movies USING gin (director gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_movies_actors_trgm ON movies USING gin (actors gin_trgm_ops)`,
+}
+
+// peopleMigrations index people by name; names without an nm-id are unique
+// so catalog.SyncCredits does not create the same person twice.
+var peopleMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_people_name_only ON people (lower(name)) WHERE imdb_id IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_people_lower_name ON people (lower(name))`,
+	`CREATE INDEX IF NOT EXISTS idx_people_name_trgm ON people USING gin (name gin_trgm_ops)`,
+}
+
+// playlistMovieMigrations add added_at without a default first, so entries older than
+// the column stay NULL instead of all looking new (trending counts additions by it).
+// position stays NULL until a playlist is reordered.
+var playlistMovieMigrations = []string{
+	`ALTER TABLE playlist_movies ADD COLUMN IF NOT EXISTS added_at timestamptz`,
+	`ALTER TABLE playlist_movies ALTER COLUMN added_at SET DEFAULT now()`,
+	`CREATE INDEX IF NOT EXISTS idx_playlist_movies_added_at ON playlist_movies (added_at)`,
+	`ALTER TABLE playlist_movies ADD COLUMN IF NOT EXISTS position integer`,
+	`ALTER TABLE playlist_movies ADD COLUMN IF NOT EXISTS added_by bigint`,
+}
+
+// classifyPlaylistKinds gives the playlists that were system playlists by name their kind:
+// per owner the oldest one with each default name, any others stay custom. Owners who
+// already have a playlist of that kind are left alone, so it is safe on every boot and
+// picks up where an interrupted run stopped.
+const classifyPlaylistKinds = `UPDATE playlists SET kind = k.kind
+	FROM (
+		SELECT DISTINCT ON (owner_id, name) id, owner_id,
+			CASE name WHEN 'watch-later' THEN 'watchlist' ELSE name END AS kind
+		FROM playlists
+		WHERE name IN ('watch-later', 'watched', 'liked') AND kind = 'custom' AND deleted_at IS NULL
+		ORDER BY owner_id, name, id
+	) k
+	WHERE playlists.id = k.id
+		AND NOT EXISTS (SELECT 1 FROM playlists s WHERE s.owner_id = k.owner_id AND s.kind = k.kind)`
+
+// playlistKindMigrations: one playlist of each system kind per owner.
+var playlistKindMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_owner_kind ON playlists (owner_id, kind) WHERE kind <> 'custom'`,
+}
+
+// trendingMigrations index the activity internal/trending scans by time.
+var trendingMigrations = []string{
+	`CREATE INDEX IF NOT EXISTS idx_reviews_created_at ON reviews (created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at)`,
+}
+
+func execAll(db *gorm.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"totallyguysproject/internal/catalog"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/provider"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusNotFound = "not_found"
+)
+
+// ErrDailyLimit: the day's provider calls are spent, the movie is left as it is for tomorrow.
+var ErrDailyLimit = errors.New("daily provider limit reached")
+
+// incompleteCond matches movies that still miss provider data.
+const incompleteCond = "(plot = '' OR genre = '' OR director = '' OR actors = '' OR rating = '')"
+
+type Config struct {
+	Interval   time.Duration // how often to scan for incomplete rows
+	BatchSize  int           // rows per scan
+	Workers    int           // concurrent provider calls
+	RatePerSec float64       // provider calls per second, per provider
+	MaxRetries int           // retries of one lookup on transient errors
+	RetryBase  time.Duration // first retry delay, doubled every retry
+	FailDelay  time.Duration // first re-scan delay for a failed movie, doubled every failed attempt
+	DailyLimit int           // provider calls per day (local time), retries included; 0 is no limit
+}
+
+// DefaultConfig reads ENRICH_WORKERS, ENRICH_RATE_PER_SEC and ENRICH_DAILY_LIMIT (default 1000,
+// the free OMDb key's), the rest is fixed.
+func DefaultConfig() Config {
+	cfg := Config{
+		Interval:   time.Minute,
+		BatchSize:  50,
+		Workers:    4,
+		RatePerSec: 2,
+		MaxRetries: 3,
+		RetryBase:  time.Second,
+		FailDelay:  5 * time.Minute,
+		DailyLimit: 1000,
+	}
+	if n, err := strconv.Atoi(os.Getenv("ENRICH_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if r, err := strconv.ParseFloat(os.Getenv("ENRICH_RATE_PER_SEC"), 64); err == nil && r > 0 {
+		cfg.RatePerSec = r
+	}
+	if n, err := strconv.Atoi(os.Getenv("ENRICH_DAILY_LIMIT")); err == nil && n >= 0 {
+		cfg.DailyLimit = n
+	}
+	return cfg
+}
+
+// Worker fills in Plot/Genre/Director/Actors/Rating for movies in the background.
+type Worker struct {
+	db       *gorm.DB
+	provider provider.MovieProvider
+	cfg      Config
+	limiter  *rateLimiter
+
+	queue chan uint
+	sem   chan struct{}
+	stop  chan struct{}
+
+	mu       sync.Mutex
+	inflight map[uint]bool
+	day      string // calls are counted per day, in memory: a restart starts over
+	calls    int
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter) // provider name -> limiter
+
+	defaultWorker *Worker
+)
+
+func NewWorker(db *gorm.DB, p provider.MovieProvider, cfg Config) *Worker {
+	return &Worker{
+		db:       db,
+		provider: p,
+		cfg:      cfg,
+		limiter:  limiterFor(p.Name(), cfg.RatePerSec),
+		queue:    make(chan uint, 256),
+		sem:      make(chan struct{}, cfg.Workers),
+		stop:     make(chan struct{}),
+		inflight: make(map[uint]bool),
+	}
+}
+
+// Start runs the default worker, Enqueue sends ids to it.
+func Start(db *gorm.DB, p provider.MovieProvider, cfg Config) *Worker {
+	w := NewWorker(db, p, cfg)
+	defaultWorker = w
+	go w.run()
+	return w
+}
+
+// Enqueue asks the default worker to enrich a movie soon. Never blocks.
+func Enqueue(movieID uint) {
+	if defaultWorker == nil {
+		return
+	}
+	select {
+	case defaultWorker.queue <- movieID:
+	default:
+		// queue full, the periodic scan will pick it up
+	}
+}
+
+func (w *Worker) Stop() {
+	close(w.stop)
+}
+
+func (w *Worker) run() {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	w.scan()
+	for {
+		select {
+		case id := <-w.queue:
+			w.dispatch(id)
+		case <-ticker.C:
+			w.scan()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// spend counts one provider call against the day's budget; false when it is spent.
+// With n == 0 it only reports whether there is budget left.
+func (w *Worker) spend(n int) bool {
+	if w.cfg.DailyLimit <= 0 {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if today := time.Now().Format("2006-01-02"); w.day != today {
+		w.day, w.calls = today, 0
+	}
+	if w.calls >= w.cfg.DailyLimit {
+		return false
+	}
+	w.calls += n
+	return true
+}
+
+// scan picks a batch of incomplete movies that are due for an attempt, none once the
+// day's budget is spent.
+func (w *Worker) scan() {
+	if !w.spend(0) {
+		return
+	}
+	var ids []uint
+	err := w.db.Model(&models.Movie{}).
+		Where(incompleteCond).
+		Where("enrich_status IN ?", []string{StatusPending, StatusFailed}).
+		Where("enrich_next_at IS NULL OR enrich_next_at <= ?", time.Now()).
+		Order("enrich_attempts ASC, id ASC").
+		Limit(w.cfg.BatchSize).
+		Pluck("id", &ids).Error
+	if err != nil {
+		fmt.Println("enrich scan failed:", err)
+		return
+	}
+	for _, id := range ids {
+		w.dispatch(id)
+	}
+}
+
+// dispatch runs Process on the pool, blocking while all workers are busy.
+func (w *Worker) dispatch(id uint) {
+	w.mu.Lock()
+	if w.inflight[id] {
+		w.mu.Unlock()
+		return
+	}
+	w.inflight[id] = true
+	w.mu.Unlock()
+
+	w.sem <- struct{}{}
+	go func() {
+		defer func() {
+			<-w.sem
+			w.mu.Lock()
+			delete(w.inflight, id)
+			w.mu.Unlock()
+		}()
+		if err := w.Process(id); err != nil {
+			fmt.Printf("enrich movie %d: %v\n", id, err)
+		}
+	}()
+}
+
+// Process enriches one movie and records the outcome on its row.
+func (w *Worker) Process(id uint) error {
+	var movie models.Movie
+	if err := w.db.First(&movie, id).Error; err != nil {
+		return err
+	}
+	if movie.EnrichStatus == StatusDone || movie.EnrichStatus == StatusNotFound || isComplete(&movie) {
+		return nil
+	}
+
+	var details *provider.MovieDetails
+	err := w.withRetry(func() error {
+		if !w.spend(1) {
+			return ErrDailyLimit
+		}
+		w.limiter.Wait()
+		var err error
+		if movie.OMDBID != "" {
+			details, err = w.provider.ByID(movie.OMDBID)
+		} else {
+			details, err = w.provider.ByTitle(movie.Title, movie.Year)
+		}
+		return err
+	})
+
+	if errors.Is(err, ErrDailyLimit) {
+		return nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"enrich_attempts":   movie.EnrichAttempts + 1,
+		"enrich_attempt_at": now,
+	}
+
+	switch {
+	case err == provider.ErrNotFound:
+		updates["enrich_status"] = StatusNotFound
+		updates["enrich_error"] = err.Error()
+		updates["enrich_next_at"] = nil
+	case err != nil:
+		updates["enrich_status"] = StatusFailed
+		updates["enrich_error"] = err.Error()
+		updates["enrich_next_at"] = now.Add(w.failDelay(movie.EnrichAttempts + 1))
+	default:
+		updates["enrich_status"] = StatusDone
+		updates["enrich_error"] = ""
+		updates["enrich_next_at"] = nil
+	}
+
+	dbErr := w.db.Transaction(func(tx *gorm.DB) error {
+		if details != nil {
+			// fields locked or filled in by an admin while the provider answered stay theirs
+			var current models.Movie
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, movie.ID).Error; err != nil {
+				return err
+			}
+			for k, v := range Apply(&current, details) {
+				updates[k] = v
+			}
+		}
+		return tx.Model(&models.Movie{}).Where("id = ?", movie.ID).Updates(updates).Error
+	})
+	if dbErr != nil {
+		return dbErr
+	}
+	if _, ok := updates["genre"]; ok {
+		if dbErr := catalog.SyncGenres(w.db, []uint{movie.ID}); dbErr != nil {
+			return dbErr
+		}
+	}
+	_, director := updates["director"]
+	_, actors := updates["actors"]
+	if director || actors {
+		if dbErr := catalog.SyncCredits(w.db, []uint{movie.ID}); dbErr != nil {
+			return dbErr
+		}
+	}
+	if err == provider.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// withRetry retries fn with exponential backoff, ErrNotFound and ErrDailyLimit are final.
+func (w *Worker) withRetry(fn func() error) error {
+	delay := w.cfg.RetryBase
+	var err error
+	for attempt := 0; attempt <= w.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		err = fn()
+		if err == nil || errors.Is(err, provider.ErrNotFound) || errors.Is(err, ErrDailyLimit) {
+			return err
+		}
+	}
+	return err
+}
+
+// failDelay is FailDelay * 2^(attempts-1), capped at one day.
+func (w *Worker) failDelay(attempts int) time.Duration {
+	d := w.cfg.FailDelay
+	for i := 1; i < attempts && d < 24*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 24*time.Hour {
+		d = 24 * time.Hour
+	}
+	return d
+}
+
+// Apply copies provider values into the empty, unlocked fields of movie and returns the column updates.
+func Apply(movie *models.Movie, d *provider.MovieDetails) map[string]interface{} {
+	updates := make(map[string]interface{})
+
+	if movie.Plot == "" && !movie.Locked("plot") && d.Plot != "" {
+		movie.Plot = d.Plot
+		updates["plot"] = movie.Plot
+	}
+	if movie.Genre == "" && !movie.Locked("genre") && d.Genre != "" {
+		movie.Genre = d.Genre
+		updates["genre"] = movie.Genre
+	}
+	if movie.Director == "" && !movie.Locked("director") && d.Director != "" {
+		movie.Director = d.Director
+		updates["director"] = movie.Director
+	}
+	if movie.Actors == "" && !movie.Locked("actors") && d.Actors != "" {
+		movie.Actors = d.Actors
+		updates["actors"] = movie.Actors
+	}
+	if movie.Rating == "" && !movie.Locked("rating") && d.Rating != "" {
+		movie.Rating = d.Rating
+		updates["rating"] = movie.Rating
+	}
+	if movie.Certificate == "" && !movie.Locked("certificate") && d.Rated != "" {
+		movie.Certificate = d.Rated
+		updates["certificate"] = movie.Certificate
+	}
+	if movie.Runtime == "" && !movie.Locked("runtime") && d.Runtime != "" {
+		movie.Runtime = d.Runtime
+		updates["runtime"] = movie.Runtime
+	}
+	if movie.Votes == 0 && !movie.Locked("votes") && d.VotesCount() > 0 {
+		movie.Votes = d.VotesCount()
+		updates["votes"] = movie.Votes
+	}
+	if movie.Poster == "" && !movie.Locked("poster") && d.Poster != "" {
+		movie.Poster = d.Poster
+		updates["poster"] = movie.Poster
+	}
+
+	return updates
+}
+
+func isComplete(m *models.Movie) bool {
+	return m.Plot != "" && m.Genre != "" && m.Director != "" && m.Actors != "" && m.Rating != ""
+}
+
+// NeedsEnrichment reports whether the worker would still touch this movie.
+func NeedsEnrichment(m *models.Movie) bool {
+	return !isComplete(m) && m.EnrichStatus != StatusDone && m.EnrichStatus != StatusNotFound
+}
+
+// rateLimiter spaces calls evenly, shared by every worker of one provider.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func limiterFor(name string, perSec float64) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if l, ok := limiters[name]; ok {
+		return l
+	}
+	l := &rateLimiter{interval: time.Duration(float64(time.Second) / perSec)}
+	limiters[name] = l
+	return l
+}
+
+func (l *rateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"totallyguysproject/internal/banned"
+	"totallyguysproject/internal/catalog"
 	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/provider"
 	"totallyguysproject/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DELETE /api/admin/reviews/:id
@@ -33,25 +39,9 @@ func AdminDeleteReview(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 		return
 	}
 
-	// delete comment votes tied to review
-	if err := db.Exec(`
-        DELETE FROM comment_votes 
-        WHERE comment_id IN (SELECT id FROM comments WHERE review_id = ?)
-    `, reviewID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete votes"})
-		return
-	}
-
-	// delete comments
-	if err := db.Where("review_id = ?", reviewID).
-		Unscoped().Delete(&models.Comment{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comments"})
-		return
-	}
-
-	// soft delete review
-	if err := db.Unscoped().Delete(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete review"})
+	// delete comment votes, comments and the review itself
+	if err := deleteReviewTx(db, &review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -186,3 +176,204 @@ func AdminUnbanUser(c *gin.Context, hub *ws.Hub) {
 	})
 	c.JSON(http.StatusOK, gin.H{"message": "user unbanned"})
 }
+
+// GET /api/admin/provider/cache
+func AdminGetProviderCacheStats(c *gin.Context) {
+	cached, ok := movieProvider.(*provider.Cached)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"enabled": false, "provider": movieProvider.Name()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":      true,
+		"provider":     cached.Name(),
+		"ttl":          cached.TTL.String(),
+		"negative_ttl": cached.NegativeTTL.String(),
+		"stats":        cached.Stats(),
+	})
+}
+
+// movieEditableColumns are the columns PUT /api/admin/movies/:id can override (json name = column)
+var movieEditableColumns = []string{
+	"title", "year", "plot", "poster", "genre", "director", "actors", "rating", "certificate", "runtime",
+}
+
+// PUT /api/admin/movies/:id
+// body: {"plot": "...", "director": "...", "unlock": ["poster"]}
+// every field set here is locked against imports and enrichment until it is unlocked
+func AdminUpdateMovie(c *gin.Context, db *gorm.DB) {
+	movieID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid movie id"})
+		return
+	}
+
+	var req map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	editable := make(map[string]bool, len(movieEditableColumns))
+	for _, col := range movieEditableColumns {
+		editable[col] = true
+	}
+
+	var unlock []string
+	updates := make(map[string]interface{})
+	for key, raw := range req {
+		if key == "unlock" {
+			if err := json.Unmarshal(raw, &unlock); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unlock must be a list of fields"})
+				return
+			}
+			continue
+		}
+		if !editable[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field cannot be edited: " + key})
+			return
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be a string"})
+			return
+		}
+		updates[key] = strings.TrimSpace(value)
+	}
+	for _, col := range unlock {
+		if !editable[col] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field cannot be unlocked: " + col})
+			return
+		}
+	}
+	if title, ok := updates["title"]; ok && title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+		return
+	}
+	if len(updates) == 0 && len(unlock) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	var movie models.Movie
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&movie, movieID).Error; err != nil {
+			return err
+		}
+
+		locks := map[string]bool{}
+		for _, col := range strings.Split(movie.LockedFields, ",") {
+			if col != "" {
+				locks[col] = true
+			}
+		}
+		for _, col := range unlock {
+			delete(locks, col)
+		}
+		for col := range updates {
+			locks[col] = true
+		}
+		locked := make([]string, 0, len(locks))
+		for col := range locks {
+			locked = append(locked, col)
+		}
+		sort.Strings(locked)
+		updates["locked_fields"] = strings.Join(locked, ",")
+
+		// hand-edited names no longer line up with the imported nm-ids
+		if _, ok := updates["director"]; ok {
+			updates["director_ids"] = ""
+		}
+		if _, ok := updates["actors"]; ok {
+			updates["star_ids"] = ""
+		}
+
+		if err := tx.Model(&movie).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, ok := updates["genre"]; ok {
+			if err := catalog.SyncGenres(tx, []uint{movie.ID}); err != nil {
+				return err
+			}
+		}
+		_, director := updates["director"]
+		_, actors := updates["actors"]
+		if director || actors {
+			return catalog.SyncCredits(tx, []uint{movie.ID})
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update movie"})
+		return
+	}
+
+	c.JSON(http.StatusOK, movie)
+}
+
+// POST /api/admin/movies/:id/merge
+// body: {"duplicate_id": 42}; the duplicate is folded into :id and deleted
+func AdminMergeMovies(c *gin.Context, db *gorm.DB) {
+	canonicalID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid movie id"})
+		return
+	}
+
+	var req struct {
+		DuplicateID uint `json:"duplicate_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.DuplicateID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate_id required"})
+		return
+	}
+	if uint64(req.DuplicateID) == canonicalID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot merge a movie into itself"})
+		return
+	}
+
+	var canonical, duplicate models.Movie
+	var stats *catalog.MergeStats
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// lock both rows in id order so two opposite merges cannot deadlock
+		var pair []models.Movie
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []uint64{canonicalID, uint64(req.DuplicateID)}).
+			Order("id").Find(&pair).Error; err != nil {
+			return err
+		}
+		for _, m := range pair {
+			if uint64(m.ID) == canonicalID {
+				canonical = m
+			} else {
+				duplicate = m
+			}
+		}
+		if canonical.ID == 0 || duplicate.ID == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var err error
+		stats, err = catalog.MergeMovies(tx, &canonical, &duplicate)
+		return err
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to merge movies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movie":        canonical,
+		"merged_id":    duplicate.ID,
+		"merge_report": stats,
+	})
+}
@@ -78,21 +78,8 @@ func Register(c *gin.Context, db *gorm.DB) {
 	}
 
 	// default playlists
-	defaultPlaylists := []struct {
-		Name  string
-		Cover string
-	}{
-		{"watch-later", "/static/playlists/watch-later.png"},
-		{"watched", "/static/playlists/watched.png"},
-		{"liked", "/static/playlists/liked.png"},
-	}
-
-	for _, p := range defaultPlaylists {
-		db.Create(&models.Playlist{
-			Name:    p.Name,
-			OwnerID: user.ID,
-			Cover:   p.Cover,
-		})
+	if err := createSystemPlaylists(db, user.ID); err != nil {
+		fmt.Println("failed to create default playlists:", err)
 	}
 	// verification through fmt, l8r with email
 	fmt.Printf("Verification code for %s: %s\n", user.Email, code)
@@ -204,12 +191,8 @@ func EnsureAdmin(db *gorm.DB) {
 		}
 		db.Create(&admin)
 
-		defaultPlaylists := []string{"watch-later", "watched", "liked"}
-		for _, name := range defaultPlaylists {
-			db.Create(&models.Playlist{
-				Name:    name,
-				OwnerID: admin.ID,
-			})
+		if err := createSystemPlaylists(db, admin.ID); err != nil {
+			fmt.Println("failed to create admin playlists:", err)
 		}
 
 		fmt.Println("Admin user created: admin@site.com / admin123")
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxBulkOps = 200
+
+// bulkOp is one item of POST /api/playlists/bulk.
+type bulkOp struct {
+	Op          string `json:"op"`               // add, remove or move
+	PlaylistID  uint   `json:"playlist_id"`      // for move, where the movie goes
+	FromID      uint   `json:"from_playlist_id"` // move only
+	MovieID     uint   `json:"movie_id"`
+	Description string `json:"description"` // add only, the entry's note
+}
+
+type bulkResult struct {
+	Index      int    `json:"index"`
+	Op         string `json:"op"`
+	PlaylistID uint   `json:"playlist_id"`
+	MovieID    uint   `json:"movie_id"`
+	// added, removed, moved, unchanged (nothing to do), failed, or not_applied when another item failed;
+	// a move into a playlist that already has the movie is "removed" from its source
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// errBulkItem aborts the bulk transaction after an item has failed.
+var errBulkItem = errors.New("bulk item failed")
+
+// POST /api/playlists/bulk  the owner and editors of every playlist touched
+// body: {"ops": [{"op": "add", "playlist_id": 3, "movie_id": 7, "description": "..."},
+// {"op": "remove", "playlist_id": 3, "movie_id": 8}, {"op": "move", "from_playlist_id": 3, "playlist_id": 4, "movie_id": 9}]}
+// All or nothing: if one item fails nothing is applied and the answer is 422, with the
+// reason on that item.
+func BulkPlaylistOps(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	var req struct {
+		Ops []bulkOp `json:"ops"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Ops) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ops required"})
+		return
+	}
+	if len(req.Ops) > maxBulkOps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d ops", maxBulkOps)})
+		return
+	}
+
+	var playlistIDs, movieIDs []uint
+	for _, op := range req.Ops {
+		playlistIDs = append(playlistIDs, op.PlaylistID)
+		if op.FromID != 0 {
+			playlistIDs = append(playlistIDs, op.FromID)
+		}
+		movieIDs = append(movieIDs, op.MovieID)
+	}
+
+	var playlistRows []models.Playlist
+	if err := db.Where("id IN ?", playlistIDs).Find(&playlistRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load playlists"})
+		return
+	}
+	playlists := map[uint]*models.Playlist{}
+	editable := map[uint]string{} // playlist id -> why it can't be edited, "" if it can
+	for i := range playlistRows {
+		p := &playlistRows[i]
+		playlists[p.ID] = p
+		switch {
+		case !canEditPlaylist(db, p, userID):
+			editable[p.ID] = "you can't edit this playlist"
+		case p.Rules != nil:
+			editable[p.ID] = errSmartPlaylist
+		default:
+			editable[p.ID] = ""
+		}
+	}
+
+	var movieRows []models.Movie
+	if err := db.Where("id IN ?", movieIDs).Find(&movieRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load movies"})
+		return
+	}
+	movies := map[uint]models.Movie{}
+	for _, m := range movieRows {
+		movies[m.ID] = m
+	}
+
+	results := make([]bulkResult, len(req.Ops))
+	failed := false
+	checkPlaylist := func(id uint) string {
+		if _, ok := playlists[id]; !ok {
+			return fmt.Sprintf("playlist %d not found", id)
+		}
+		return editable[id]
+	}
+	for i, op := range req.Ops {
+		results[i] = bulkResult{Index: i, Op: op.Op, PlaylistID: op.PlaylistID, MovieID: op.MovieID}
+		var reason string
+		switch {
+		case op.Op != "add" && op.Op != "remove" && op.Op != "move":
+			reason = "op must be add, remove or move"
+		case op.Op == "move" && op.FromID == 0:
+			reason = "move needs from_playlist_id"
+		case op.Op == "move" && op.FromID == op.PlaylistID:
+			reason = "from_playlist_id and playlist_id are the same"
+		case op.Op == "move" && checkPlaylist(op.FromID) != "":
+			reason = checkPlaylist(op.FromID)
+		case checkPlaylist(op.PlaylistID) != "":
+			reason = checkPlaylist(op.PlaylistID)
+		}
+		if _, ok := movies[op.MovieID]; reason == "" && !ok {
+			reason = fmt.Sprintf("movie %d not found", op.MovieID)
+		}
+		from := op.PlaylistID
+		if op.Op == "move" {
+			from = op.FromID
+		}
+		if reason == "" && op.Op != "add" && inDiary(db, playlists[from], op.MovieID) {
+			reason = errInDiary
+		}
+		if reason != "" {
+			results[i].Status, results[i].Error = "failed", reason
+			failed = true
+		}
+	}
+
+	added := map[uint][]models.Movie{} // by playlist, for the notifications
+	removed := map[uint]int{}
+	if !failed {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, op := range req.Ops {
+				status, err := applyBulkOp(tx, op, userID)
+				if errors.Is(err, errBulkItem) {
+					results[i].Status, results[i].Error = "failed", "movie is not in that playlist"
+					return err
+				}
+				if err != nil {
+					return err
+				}
+				results[i].Status = status
+				switch status {
+				case "added":
+					added[op.PlaylistID] = append(added[op.PlaylistID], movies[op.MovieID])
+				case "removed":
+					if op.Op == "move" {
+						removed[op.FromID]++
+					} else {
+						removed[op.PlaylistID]++
+					}
+				case "moved":
+					removed[op.FromID]++
+					added[op.PlaylistID] = append(added[op.PlaylistID], movies[op.MovieID])
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBulkItem) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply ops"})
+			return
+		}
+		failed = err != nil
+	}
+
+	if failed {
+		for i := range results {
+			if results[i].Status != "failed" {
+				results[i].Status = "not_applied"
+			}
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"applied": false, "results": results})
+		return
+	}
+
+	var owners []uint
+	for id, p := range playlists {
+		if len(added[id]) == 0 && removed[id] == 0 {
+			continue
+		}
+		owners = append(owners, p.OwnerID)
+		notifyPlaylist(db, hub, p, userID, map[string]interface{}{
+			"action":  "bulk",
+			"added":   len(added[id]),
+			"removed": removed[id],
+		})
+		notifySubscribers(db, hub, p, userID, added[id])
+	}
+	smart.Enqueue(owners...)
+
+	c.JSON(http.StatusOK, gin.H{"applied": true, "results": results})
+}
+
+// applyBulkOp runs one validated op inside the bulk transaction and returns its status.
+// A move of a movie that isn't in its source playlist returns errBulkItem.
+func applyBulkOp(tx *gorm.DB, op bulkOp, userID uint) (string, error) {
+	switch op.Op {
+	case "add":
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.PlaylistMovie{PlaylistID: op.PlaylistID, MovieID: op.MovieID, Description: op.Description, AddedBy: &userID})
+		if res.Error != nil {
+			return "", res.Error
+		}
+		if res.RowsAffected == 0 {
+			return "unchanged", nil
+		}
+		return "added", nil
+
+	case "remove":
+		res := tx.Where("playlist_id = ? AND movie_id = ?", op.PlaylistID, op.MovieID).Delete(&models.PlaylistMovie{})
+		if res.Error != nil {
+			return "", res.Error
+		}
+		if res.RowsAffected == 0 {
+			return "unchanged", nil
+		}
+		return "removed", nil
+	}
+
+	// move: the note goes along, or fills in the target entry's when the movie is already there
+	var entry models.PlaylistMovie
+	err := tx.Where("playlist_id = ? AND movie_id = ?", op.FromID, op.MovieID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", errBulkItem
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Where("playlist_id = ? AND movie_id = ?", op.FromID, op.MovieID).Delete(&models.PlaylistMovie{}).Error; err != nil {
+		return "", err
+	}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.PlaylistMovie{PlaylistID: op.PlaylistID, MovieID: op.MovieID, Description: entry.Description, AddedBy: &userID})
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected > 0 {
+		return "moved", nil
+	}
+	if entry.Description != "" {
+		if err := tx.Model(&models.PlaylistMovie{}).
+			Where("playlist_id = ? AND movie_id = ? AND description = ''", op.PlaylistID, op.MovieID).
+			Update("description", entry.Description).Error; err != nil {
+			return "", err
+		}
+	}
+	return "removed", nil
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// collaboratorRole is userID's accepted role on the playlist, "" for none.
+func collaboratorRole(db *gorm.DB, playlistID, userID uint) string {
+	if userID == 0 {
+		return ""
+	}
+	var roles []string
+	db.Model(&models.PlaylistCollaborator{}).
+		Where("playlist_id = ? AND user_id = ? AND accepted_at IS NOT NULL", playlistID, userID).
+		Pluck("role", &roles)
+	if len(roles) == 0 {
+		return ""
+	}
+	return roles[0]
+}
+
+// canEditPlaylist: the owner and accepted editors.
+func canEditPlaylist(db *gorm.DB, p *models.Playlist, userID uint) bool {
+	if p.OwnerID == userID {
+		return true
+	}
+	return collaboratorRole(db, p.ID, userID) == models.CollaboratorEditor
+}
+
+// loadEditablePlaylist loads the :id playlist for its owner or an editor, writing the error response otherwise.
+func loadEditablePlaylist(c *gin.Context, db *gorm.DB) (*models.Playlist, uint, bool) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, 0, false
+	}
+	userID := uid.(uint)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid playlist id"})
+		return nil, 0, false
+	}
+	var playlist models.Playlist
+	if err := db.First(&playlist, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return nil, 0, false
+	}
+	if !canEditPlaylist(db, &playlist, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can't edit this playlist"})
+		return nil, 0, false
+	}
+	return &playlist, userID, true
+}
+
+// notifyPlaylist sends msg to the owner and the accepted collaborators, except whoever made the change.
+func notifyPlaylist(db *gorm.DB, hub *ws.Hub, p *models.Playlist, actorID uint, msg map[string]interface{}) {
+	if hub == nil {
+		return
+	}
+	var members []uint
+	db.Model(&models.PlaylistCollaborator{}).
+		Where("playlist_id = ? AND accepted_at IS NOT NULL", p.ID).
+		Pluck("user_id", &members)
+	members = append(members, p.OwnerID)
+
+	var actor models.User
+	db.Select("id", "name").First(&actor, actorID)
+	msg["type"] = "playlist_updated"
+	msg["playlist_id"] = p.ID
+	msg["playlist_name"] = playlistNameIn("en", p)
+	msg["playlist_kind"] = p.Kind
+	msg["user_id"] = actorID
+	msg["user_name"] = actor.Name
+
+	for _, id := range members {
+		if id != actorID {
+			hub.Send(id, msg)
+		}
+	}
+}
+
+func validCollaboratorRole(role string) bool {
+	return role == models.CollaboratorViewer || role == models.CollaboratorEditor
+}
+
+// GET /api/playlists/:id/collaborators  the owner and collaborators
+func GetPlaylistCollaborators(c *gin.Context, db *gorm.DB) {
+	userID := viewerID(c)
+	var playlist models.Playlist
+	if err := db.First(&playlist, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+	if playlist.OwnerID != userID && collaboratorRole(db, playlist.ID, userID) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not a collaborator"})
+		return
+	}
+
+	type collaborator struct {
+		UserID     uint       `json:"user_id"`
+		Name       string     `json:"name"`
+		Avatar     string     `json:"avatar"`
+		Role       string     `json:"role"`
+		Pending    bool       `json:"pending"`
+		AcceptedAt *time.Time `json:"accepted_at"`
+	}
+	var rows []collaborator
+	if err := db.Table("playlist_collaborators").
+		Select(`playlist_collaborators.user_id, users.name, users.avatar, playlist_collaborators.role,
+			playlist_collaborators.accepted_at IS NULL AS pending, playlist_collaborators.accepted_at`).
+		Joins("JOIN users ON users.id = playlist_collaborators.user_id AND users.deleted_at IS NULL").
+		Where("playlist_collaborators.playlist_id = ?", playlist.ID).
+		Order("playlist_collaborators.created_at").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load collaborators"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"owner_id": playlist.OwnerID, "collaborators": rows})
+}
+
+// POST /api/playlists/:id/collaborators  {"user_id": 7, "role": "editor"}
+// invites a user, or changes the role of an existing invite or collaborator
+func InviteCollaborator(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	playlist, ok := loadOwnPlaylist(c, db)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID uint   `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.CollaboratorEditor
+	}
+	if !validCollaboratorRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be viewer or editor"})
+		return
+	}
+	if req.UserID == playlist.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the owner can't be a collaborator"})
+		return
+	}
+	var invitee models.User
+	if err := db.First(&invitee, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	var collab models.PlaylistCollaborator
+	err := db.Where("playlist_id = ? AND user_id = ?", playlist.ID, req.UserID).First(&collab).Error
+	switch {
+	case err == nil:
+		if err := db.Model(&collab).Update("role", req.Role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update collaborator"})
+			return
+		}
+		c.JSON(http.StatusOK, collab)
+		return
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	collab = models.PlaylistCollaborator{
+		PlaylistID: playlist.ID,
+		UserID:     req.UserID,
+		Role:       req.Role,
+		InvitedBy:  playlist.OwnerID,
+	}
+	if err := db.Create(&collab).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to invite"})
+		return
+	}
+
+	if hub != nil {
+		var owner models.User
+		db.Select("id", "name").First(&owner, playlist.OwnerID)
+		hub.Send(req.UserID, map[string]interface{}{
+			"type":          "playlist_invite",
+			"playlist_id":   playlist.ID,
+			"playlist_name": playlistNameIn("en", playlist),
+			"playlist_kind": playlist.Kind,
+			"role":          req.Role,
+			"owner_id":      owner.ID,
+			"owner_name":    owner.Name,
+			"text":          fmt.Sprintf("%s invited you to \"%s\"", owner.Name, playlistNameIn("en", playlist)),
+		})
+	}
+
+	c.JSON(http.StatusCreated, collab)
+}
+
+// POST /api/playlists/:id/collaborators/accept  the invited user
+func AcceptPlaylistInvite(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	var playlist models.Playlist
+	if err := db.First(&playlist, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+
+	now := time.Now()
+	res := db.Model(&models.PlaylistCollaborator{}).
+		Where("playlist_id = ? AND user_id = ? AND accepted_at IS NULL", playlist.ID, userID).
+		Update("accepted_at", now)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invite"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pending invite"})
+		return
+	}
+
+	notifyPlaylist(db, hub, &playlist, userID, map[string]interface{}{"action": "joined"})
+	c.JSON(http.StatusOK, gin.H{"message": "invite accepted", "playlist_id": playlist.ID})
+}
+
+// DELETE /api/playlists/:id/collaborators/:user_id
+// the owner removes anyone; a user can decline their invite or leave
+func RemoveCollaborator(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	target, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var playlist models.Playlist
+	if err := db.First(&playlist, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+	if playlist.OwnerID != userID && uint(target) != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+		return
+	}
+
+	res := db.Where("playlist_id = ? AND user_id = ?", playlist.ID, target).Delete(&models.PlaylistCollaborator{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove collaborator"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not a collaborator"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "collaborator removed"})
+}
+
+// GET /api/users/me/invites  pending playlist invites
+func GetMyPlaylistInvites(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	type invite struct {
+		PlaylistID   uint      `json:"playlist_id"`
+		PlaylistName string    `json:"playlist_name"`
+		PlaylistKind string    `json:"playlist_kind"`
+		DisplayName  string    `json:"display_name" gorm:"-"`
+		Role         string    `json:"role"`
+		OwnerID      uint      `json:"owner_id"`
+		OwnerName    string    `json:"owner_name"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+	var invites []invite
+	if err := db.Table("playlist_collaborators").
+		Select(`playlist_collaborators.playlist_id, playlists.name AS playlist_name, playlists.kind AS playlist_kind, playlist_collaborators.role,
+			playlists.owner_id, users.name AS owner_name, playlist_collaborators.created_at`).
+		Joins("JOIN playlists ON playlists.id = playlist_collaborators.playlist_id AND playlists.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = playlists.owner_id").
+		Where("playlist_collaborators.user_id = ? AND playlist_collaborators.accepted_at IS NULL", uid.(uint)).
+		Order("playlist_collaborators.created_at DESC").
+		Scan(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load invites"})
+		return
+	}
+	for i := range invites {
+		invites[i].DisplayName = playlistName(c, &models.Playlist{Name: invites[i].PlaylistName, Kind: invites[i].PlaylistKind})
+	}
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const diaryDateLayout = "2006-01-02"
+
+// DiaryEntryView is one diary line as the frontend shows it.
+type DiaryEntryView struct {
+	ID        uint         `json:"id"`
+	WatchedOn string       `json:"watched_on"` // YYYY-MM-DD
+	Rewatch   bool         `json:"rewatch"`
+	ReviewID  *uint        `json:"review_id"`
+	Rating    *int         `json:"rating"` // from the linked review
+	Movie     MovieSummary `json:"movie"`
+}
+
+type diaryRow struct {
+	EntryID      uint
+	WatchedOn    time.Time
+	Rewatch      bool
+	ReviewID     *uint
+	ReviewRating *int
+	MovieSummary
+}
+
+// diaryQuery selects the user's entries with their movie and linked review, newest first.
+func diaryQuery(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Table("diary_entries").
+		Select(`diary_entries.id AS entry_id, diary_entries.watched_on, diary_entries.rewatch,
+			diary_entries.review_id, reviews.rating AS review_rating,
+			movies.id, movies.omdb_id, movies.title, movies.year, movies.genre,
+			movies.rating, movies.votes, movies.avg_rating`).
+		Joins("JOIN movies ON movies.id = diary_entries.movie_id").
+		Joins("LEFT JOIN reviews ON reviews.id = diary_entries.review_id AND reviews.deleted_at IS NULL").
+		Where("diary_entries.user_id = ? AND diary_entries.deleted_at IS NULL", userID).
+		Order("diary_entries.watched_on DESC, diary_entries.id DESC")
+}
+
+func diaryViews(rows []diaryRow) []DiaryEntryView {
+	out := make([]DiaryEntryView, 0, len(rows))
+	for _, r := range rows {
+		r.Poster = posterURL(r.ID)
+		out = append(out, DiaryEntryView{
+			ID:        r.EntryID,
+			WatchedOn: r.WatchedOn.Format(diaryDateLayout),
+			Rewatch:   r.Rewatch,
+			ReviewID:  r.ReviewID,
+			Rating:    r.ReviewRating,
+			Movie:     r.MovieSummary,
+		})
+	}
+	return out
+}
+
+// parseDiaryDate reads YYYY-MM-DD, empty means today. Tomorrow is allowed for time zones ahead of the server.
+func parseDiaryDate(s string) (time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if s == "" {
+		return today, nil
+	}
+	day, err := time.Parse(diaryDateLayout, s)
+	if err != nil {
+		return day, errors.New("watched_on must be YYYY-MM-DD")
+	}
+	if day.After(today.AddDate(0, 0, 1)) {
+		return day, errors.New("watched_on is in the future")
+	}
+	return day, nil
+}
+
+// syncWatched keeps the "watched" playlist equal to the logged movies: a movie is added
+// with its first entry and taken out with its last one. It returns the playlist when the
+// movie was just added to it, nil otherwise.
+func syncWatched(tx *gorm.DB, userID, movieID uint) (*models.Playlist, error) {
+	playlist, err := systemPlaylist(tx, userID, models.PlaylistWatched)
+	if err != nil {
+		return nil, err
+	}
+	var entries int64
+	if err := tx.Model(&models.DiaryEntry{}).
+		Where("user_id = ? AND movie_id = ?", userID, movieID).
+		Count(&entries).Error; err != nil {
+		return nil, err
+	}
+	if entries > 0 {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.PlaylistMovie{PlaylistID: playlist.ID, MovieID: movieID})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return nil, res.Error
+		}
+		return playlist, nil
+	}
+	return nil, tx.Where("playlist_id = ? AND movie_id = ?", playlist.ID, movieID).
+		Delete(&models.PlaylistMovie{}).Error
+}
+
+const errInDiary = "the movie is in your diary, delete its diary entries to take it out of watched"
+
+// inDiary: movieID can't leave p, the owner's "watched" playlist, while the diary logs it.
+func inDiary(db *gorm.DB, p *models.Playlist, movieID uint) bool {
+	if p == nil || p.Kind != models.PlaylistWatched {
+		return false
+	}
+	var entries int64
+	db.Model(&models.DiaryEntry{}).
+		Where("user_id = ? AND movie_id = ?", p.OwnerID, movieID).
+		Count(&entries)
+	return entries > 0
+}
+
+// checkDiaryReview makes sure a linked review is the user's own review of the movie.
+func checkDiaryReview(db *gorm.DB, reviewID *uint, userID, movieID uint) error {
+	if reviewID == nil {
+		return nil
+	}
+	var review models.Review
+	if err := db.First(&review, *reviewID).Error; err != nil {
+		return errors.New("review not found")
+	}
+	if review.UserID != userID || review.MovieID != movieID {
+		return errors.New("review is not yours or is about another movie")
+	}
+	return nil
+}
+
+// GET /api/users/me/diary?page=1&limit=50&movie_id=
+func GetMyDiary(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+	page, limit := pageParams(c, 50, 200)
+
+	query := diaryQuery(db, userID)
+	if movieID := c.Query("movie_id"); movieID != "" {
+		query = query.Where("diary_entries.movie_id = ?", movieID)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diary"})
+		return
+	}
+	var rows []diaryRow
+	if err := query.Offset((page - 1) * limit).Limit(limit).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": diaryViews(rows),
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// POST /api/users/me/diary
+// body: {"movie_id": 1, "watched_on": "2024-05-01", "rewatch": false, "review_id": 3}
+// watched_on defaults to today; without "rewatch" it is true when the movie was logged on an earlier day
+func CreateDiaryEntry(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	var req struct {
+		MovieID   uint   `json:"movie_id"`
+		WatchedOn string `json:"watched_on"`
+		Rewatch   *bool  `json:"rewatch"`
+		ReviewID  *uint  `json:"review_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.MovieID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	day, err := parseDiaryDate(req.WatchedOn)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var movie models.Movie
+	if err := db.First(&movie, req.MovieID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+		return
+	}
+	if err := checkDiaryReview(db, req.ReviewID, userID, movie.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry := models.DiaryEntry{
+		UserID:    userID,
+		MovieID:   movie.ID,
+		WatchedOn: day,
+		ReviewID:  req.ReviewID,
+	}
+	var watched *models.Playlist
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if req.Rewatch != nil {
+			entry.Rewatch = *req.Rewatch
+		} else {
+			var earlier int64
+			if err := tx.Model(&models.DiaryEntry{}).
+				Where("user_id = ? AND movie_id = ? AND watched_on < ?", userID, movie.ID, day).
+				Count(&earlier).Error; err != nil {
+				return err
+			}
+			entry.Rewatch = earlier > 0
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		var err error
+		watched, err = syncWatched(tx, userID, movie.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log movie"})
+		return
+	}
+	if watched != nil {
+		notifySubscribers(db, hub, watched, userID, []models.Movie{movie})
+	}
+	smart.Enqueue(userID)
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// loadOwnDiaryEntry reads :entry_id and answers the request itself when it is not the user's.
+func loadOwnDiaryEntry(c *gin.Context, db *gorm.DB, userID uint) (*models.DiaryEntry, bool) {
+	id, err := strconv.ParseUint(c.Param("entry_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entry id"})
+		return nil, false
+	}
+	var entry models.DiaryEntry
+	if err := db.First(&entry, id).Error; err != nil || entry.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "diary entry not found"})
+		return nil, false
+	}
+	return &entry, true
+}
+
+// PUT /api/users/me/diary/:entry_id
+// body: any of {"watched_on": "2024-05-02", "rewatch": true, "review_id": 3}; "review_id": 0 unlinks
+func UpdateDiaryEntry(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	entry, ok := loadOwnDiaryEntry(c, db, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		WatchedOn *string `json:"watched_on"`
+		Rewatch   *bool   `json:"rewatch"`
+		ReviewID  *uint   `json:"review_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.WatchedOn != nil {
+		day, err := parseDiaryDate(*req.WatchedOn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["watched_on"] = day
+	}
+	if req.Rewatch != nil {
+		updates["rewatch"] = *req.Rewatch
+	}
+	if req.ReviewID != nil {
+		if *req.ReviewID == 0 {
+			updates["review_id"] = nil
+		} else {
+			if err := checkDiaryReview(db, req.ReviewID, userID, entry.MovieID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updates["review_id"] = *req.ReviewID
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := db.Model(entry).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update diary entry"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// DELETE /api/users/me/diary/:entry_id
+func DeleteDiaryEntry(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	entry, ok := loadOwnDiaryEntry(c, db, userID)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(entry).Error; err != nil {
+			return err
+		}
+		_, err := syncWatched(tx, userID, entry.MovieID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete diary entry"})
+		return
+	}
+	smart.Enqueue(userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "diary entry deleted"})
+}
+
+// GET /api/users/me/diary/calendar?month=2024-05 (default: this month)
+// every day of the month with what was watched on it
+func GetDiaryCalendar(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	month := time.Now().UTC()
+	if m := c.Query("month"); m != "" {
+		var err error
+		if month, err = time.Parse("2006-01", m); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+			return
+		}
+	}
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	next := first.AddDate(0, 1, 0)
+
+	var rows []diaryRow
+	if err := diaryQuery(db, userID).
+		Where("diary_entries.watched_on >= ? AND diary_entries.watched_on < ?", first, next).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diary"})
+		return
+	}
+
+	type calendarDay struct {
+		Date    string           `json:"date"`
+		Entries []DiaryEntryView `json:"entries"`
+	}
+	days := make([]calendarDay, 0, 31)
+	byDate := map[string]int{}
+	for d := first; d.Before(next); d = d.AddDate(0, 0, 1) {
+		byDate[d.Format(diaryDateLayout)] = len(days)
+		days = append(days, calendarDay{Date: d.Format(diaryDateLayout), Entries: []DiaryEntryView{}})
+	}
+	// rows are newest first, the calendar lists a day's entries in the order they were logged
+	views := diaryViews(rows)
+	for i := len(views) - 1; i >= 0; i-- {
+		if idx, ok := byDate[views[i].WatchedOn]; ok {
+			days[idx].Entries = append(days[idx].Entries, views[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month":   first.Format("2006-01"),
+		"days":    days,
+		"entries": len(views),
+	})
+}
+
+// GET /api/users/me/diary/years
+// which years have entries, newest first
+func GetDiaryYears(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	type yearCount struct {
+		Year    int `json:"year"`
+		Entries int `json:"entries"`
+	}
+	years := []yearCount{}
+	if err := db.Model(&models.DiaryEntry{}).
+		Select("EXTRACT(YEAR FROM watched_on)::int AS year, COUNT(*) AS entries").
+		Where("user_id = ?", userID).
+		Group("year").
+		Order("year DESC").
+		Scan(&years).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"years": years})
+}
+
+// GET /api/users/me/diary/years/:year
+// a year in review: totals, entries per month and the entries themselves
+func GetDiaryYear(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil || year < 1870 || year > 9999 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+		return
+	}
+	first := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var rows []diaryRow
+	if err := diaryQuery(db, userID).
+		Where("diary_entries.watched_on >= ? AND diary_entries.watched_on < ?", first, first.AddDate(1, 0, 0)).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diary"})
+		return
+	}
+
+	perMonth := make([]int, 12)
+	movies := map[uint]bool{}
+	rewatches := 0
+	for _, r := range rows {
+		perMonth[r.WatchedOn.Month()-1]++
+		movies[r.ID] = true
+		if r.Rewatch {
+			rewatches++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"year":      year,
+		"entries":   diaryViews(rows),
+		"total":     len(rows),
+		"movies":    len(movies),
+		"rewatches": rewatches,
+		"per_month": perMonth, // January first
+	})
+}
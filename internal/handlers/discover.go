@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"totallyguysproject/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// movieFilter is the set of ?filters of GET /api/movies.
+type movieFilter struct {
+	YearFrom     int      `json:"year_from,omitempty"`
+	YearTo       int      `json:"year_to,omitempty"`
+	Genres       []string `json:"genre,omitempty"` // slugs, all must match
+	Director     string   `json:"director,omitempty"`
+	Actor        string   `json:"actor,omitempty"`
+	MinRating    float64  `json:"min_rating,omitempty"`     // imdb
+	MinAvgRating float64  `json:"min_avg_rating,omitempty"` // community
+	Certificates []string `json:"certificate,omitempty"`    // any may match
+}
+
+func parseMovieFilter(c *gin.Context) (movieFilter, error) {
+	f := movieFilter{
+		Genres:   genreSlugs(c),
+		Director: strings.TrimSpace(c.Query("director")),
+		Actor:    strings.TrimSpace(c.Query("actor")),
+	}
+
+	ints := map[string]*int{"year_from": &f.YearFrom, "year_to": &f.YearTo}
+	for name, dst := range ints {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+	floats := map[string]*float64{"min_rating": &f.MinRating, "min_avg_rating": &f.MinAvgRating}
+	for name, dst := range floats {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+
+	for _, v := range c.QueryArray("certificate") {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				f.Certificates = append(f.Certificates, part)
+			}
+		}
+	}
+	return f, nil
+}
+
+// apply adds every filter except the one of dimension skip to query.
+// Facets of a dimension are counted without its own filter, so the other values stay visible.
+func (f movieFilter) apply(db *gorm.DB, query *gorm.DB, skip string) *gorm.DB {
+	if skip != "year" {
+		if f.YearFrom > 0 {
+			query = query.Where(movieYearExpr+" >= ?", f.YearFrom)
+		}
+		if f.YearTo > 0 {
+			query = query.Where(movieYearExpr+" <= ?", f.YearTo)
+		}
+	}
+	if len(f.Genres) > 0 {
+		// genres are intersected, so the genre facet narrows down like the list does
+		query = withAllGenres(db, query, f.Genres)
+	}
+	if f.Director != "" && skip != "director" {
+		query = query.Where("movies.director ILIKE ?", containsPattern(f.Director))
+	}
+	if f.Actor != "" && skip != "actor" {
+		query = query.Where("movies.actors ILIKE ?", containsPattern(f.Actor))
+	}
+	if f.MinRating > 0 && skip != "rating" {
+		query = query.Where(movieRatingExpr+" >= ?", f.MinRating)
+	}
+	if f.MinAvgRating > 0 && skip != "avg_rating" {
+		query = query.Where("movies.avg_rating >= ?", f.MinAvgRating)
+	}
+	if len(f.Certificates) > 0 && skip != "certificate" {
+		query = query.Where("movies.certificate IN ?", f.Certificates)
+	}
+	return query
+}
+
+// containsPattern is a LIKE pattern matching s anywhere, its own % and _ taken literally.
+func containsPattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+type facetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// facetLimit caps the long facets (people), the rest are small anyway.
+const facetLimit = 20
+
+// movieFacets counts the filtered movies per genre, decade, certificate, imdb rating, community
+// rating, director and actor. Ratings are counted per whole point, the value a min_rating or
+// min_avg_rating filter takes.
+func movieFacets(db *gorm.DB, f movieFilter) (map[string][]facetCount, error) {
+	base := func(skip string) *gorm.DB {
+		return f.apply(db, db.Model(&models.Movie{}), skip)
+	}
+	// people columns are comma-separated names
+	people := func(dimension, column string) *gorm.DB {
+		return base(dimension).
+			Joins(fmt.Sprintf("CROSS JOIN LATERAL unnest(string_to_array(movies.%s, ',')) AS p(name)", column)).
+			Select("trim(p.name) AS value, COUNT(DISTINCT movies.id) AS count").
+			Where("trim(p.name) NOT IN ('', 'N/A')").
+			Group("value").Order("count DESC, value").Limit(facetLimit)
+	}
+
+	queries := []struct {
+		name  string
+		query *gorm.DB
+	}{
+		{"genre", base("").
+			Joins("JOIN movie_genres ON movie_genres.movie_id = movies.id").
+			Joins("JOIN genres ON genres.id = movie_genres.genre_id").
+			Select("genres.slug AS value, genres.name AS label, COUNT(*) AS count").
+			Group("genres.slug, genres.name").Order("count DESC, value")},
+		{"decade", base("year").
+			Select(fmt.Sprintf("(%s / 10 * 10)::text AS value, COUNT(*) AS count", movieYearExpr)).
+			Where(movieYearExpr + " IS NOT NULL").
+			Group("value").Order("value")},
+		{"certificate", base("certificate").
+			Select("movies.certificate AS value, COUNT(*) AS count").
+			Where("movies.certificate NOT IN ('', 'N/A')").
+			Group("value").Order("count DESC, value")},
+		{"rating", base("rating").
+			Select(fmt.Sprintf("floor(%s)::int::text AS value, COUNT(*) AS count", movieRatingExpr)).
+			Where(movieRatingExpr + " IS NOT NULL").
+			Group("value").Order("value DESC")},
+		{"avg_rating", base("avg_rating").
+			Select("floor(movies.avg_rating)::int::text AS value, COUNT(*) AS count").
+			Where("movies.review_count > 0").
+			Group("value").Order("value DESC")},
+		{"director", people("director", "director")},
+		{"actor", people("actor", "actors")},
+	}
+
+	facets := make(map[string][]facetCount, len(queries))
+	for _, q := range queries {
+		var counts []facetCount
+		if err := q.query.Scan(&counts).Error; err != nil {
+			return nil, fmt.Errorf("%s facet: %w", q.name, err)
+		}
+		if counts == nil {
+			counts = []facetCount{}
+		}
+		facets[q.name] = counts
+	}
+	return facets, nil
+}
+
+// GET /api/movies?genre=drama&year_from=1990&year_to=1999&director=&actor=&min_rating=7.5
+// &min_avg_rating=8&certificate=R,PG-13&sort=rating|year|votes|title|avg_rating|certificate|director&order=desc&page=1&limit=20
+func DiscoverMovies(c *gin.Context, db *gorm.DB) {
+	filter, err := parseMovieFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, limit := pageParams(c, 20, 100)
+	order, ok := movieOrder(c, "rating")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort"})
+		return
+	}
+
+	query := filter.apply(db, db.Model(&models.Movie{}), "").Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count movies"})
+		return
+	}
+
+	var movies []models.Movie
+	if err := query.Order(order).Offset((page - 1) * limit).Limit(limit).Find(&movies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load movies"})
+		return
+	}
+
+	facets, err := movieFacets(db, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count facets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movies":  movieSummaries(movies),
+		"filters": filter,
+		"facets":  facets,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 	"totallyguysproject/internal/banned"
 	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
 	"totallyguysproject/internal/ws"
 )
 
@@ -82,6 +83,7 @@ func FollowUser(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 		}
 	}
 
+	smart.Enqueue(myID)
 	c.JSON(http.StatusOK, gin.H{"message": "followed"})
 }
 
@@ -107,6 +109,7 @@ func UnfollowUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	smart.Enqueue(myID)
 	c.JSON(http.StatusOK, gin.H{"message": "unfollowed"})
 }
 
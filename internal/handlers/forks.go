@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// POST /api/playlists/:id/fork  {"name": "optional"}
+// copies a public playlist (movies, order and descriptions) into the caller's account.
+// A smart playlist is copied as a plain list of what it currently matches.
+func ForkPlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	// the body is optional
+	_ = c.ShouldBindJSON(&req)
+	req.Name = strings.TrimSpace(req.Name)
+	if len([]rune(req.Name)) > maxPlaylistName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be 1 to %d characters", maxPlaylistName)})
+		return
+	}
+
+	var source models.Playlist
+	if err := db.First(&source, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+	if source.OwnerID != userID && source.Visibility != models.VisibilityPublic && source.Visibility != "" {
+		// same answer as GetPlaylist for lists the caller can't see
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+
+	var owner models.User
+	if err := db.Select("id", "name").First(&owner, source.OwnerID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load owner"})
+		return
+	}
+
+	entries := "playlist_movies"
+	if source.Rules != nil {
+		if source.RefreshedAt == nil {
+			if err := smart.Refresh(db, &source); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute smart playlist"})
+				return
+			}
+		}
+		entries = smartEntries
+	}
+
+	fork := models.Playlist{
+		Name:         req.Name,
+		Description:  source.Description,
+		Tags:         source.Tags,
+		OwnerID:      userID,
+		Cover:        source.Cover,
+		Visibility:   defaultVisibility(db, userID),
+		ForkedFromID: &source.ID,
+	}
+	if fork.Name == "" {
+		fork.Name = source.Name
+		// "Liked" alone would read like the caller's own
+		if isSystemPlaylist(&source) {
+			fork.Name = fmt.Sprintf("%s's %s", owner.Name, playlistName(c, &source))
+		}
+		if name := []rune(fork.Name); len(name) > maxPlaylistName {
+			fork.Name = string(name[:maxPlaylistName])
+		}
+	}
+	// an uploaded cover is a file of the source playlist, replacing or deleting it on
+	// either side would remove it from both; only the bundled images are shared
+	if isSystemPlaylist(&source) || !strings.HasPrefix(fork.Cover, "/src/") {
+		fork.Cover = "/src/default-playlist.jpg"
+	}
+	if fork.Visibility == models.VisibilityUnlisted {
+		token, err := newShareToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share token"})
+			return
+		}
+		fork.ShareToken = token
+	}
+
+	var copied int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fork).Error; err != nil {
+			return err
+		}
+		// added_at is kept so the fork sorts like the original
+		res := tx.Exec(`INSERT INTO playlist_movies (playlist_id, movie_id, description, position, added_at, added_by)
+			SELECT ?, playlist_movies.movie_id, playlist_movies.description, playlist_movies.position,
+				COALESCE(playlist_movies.added_at, now()), ?
+			FROM `+entries+`
+			JOIN movies ON movies.id = playlist_movies.movie_id AND movies.deleted_at IS NULL
+			WHERE playlist_movies.playlist_id = ?`, fork.ID, userID, source.ID)
+		copied = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fork playlist"})
+		return
+	}
+	smart.Enqueue(userID)
+
+	if hub != nil && source.OwnerID != userID {
+		var forker models.User
+		db.Select("id", "name").First(&forker, userID)
+		hub.Send(source.OwnerID, map[string]interface{}{
+			"type":          "playlist_forked",
+			"playlist_id":   source.ID,
+			"playlist_name": playlistNameIn("en", &source),
+			"playlist_kind": source.Kind,
+			"user_id":       userID,
+			"user_name":     forker.Name,
+			"text":          fmt.Sprintf("%s copied \"%s\"", forker.Name, playlistNameIn("en", &source)),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":             fork.ID,
+		"name":           fork.Name,
+		"cover":          fork.Cover,
+		"visibility":     fork.Visibility,
+		"share_token":    shareTokenValue(&fork),
+		"forked_from_id": source.ID,
+		"movies":         copied,
+	})
+}
+
+// forkedFrom describes the playlist p was copied from for whoever views p,
+// nil when there is none or viewer may not see it.
+func forkedFrom(db *gorm.DB, p *models.Playlist, viewer uint) gin.H {
+	if p.ForkedFromID == nil {
+		return nil
+	}
+	var source models.Playlist
+	if err := db.First(&source, *p.ForkedFromID).Error; err != nil || !listedFor(&source, viewer) {
+		return nil
+	}
+	var owner models.User
+	db.Select("id", "name").First(&owner, source.OwnerID)
+	return gin.H{"id": source.ID, "name": source.Name, "kind": source.Kind, "owner_id": source.OwnerID, "owner_name": owner.Name}
+}
@@ -1 +1,23 @@
-package handlers
\ No newline at end of file
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageParams reads ?page= (1-based) and ?limit=, limit is clamped to [1, maxLimit].
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (page, limit int) {
+	page, _ = strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return page, limit
+}
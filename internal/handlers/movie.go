@@ -1,193 +1,44 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"os"
-	"sort"
 	"strconv"
 	"strings"
+	"totallyguysproject/internal/catalog"
+	"totallyguysproject/internal/enrich"
 	"totallyguysproject/internal/models"
-	"encoding/csv"
+	"totallyguysproject/internal/provider"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
 )
 
 var errorloadingenv = godotenv.Load()
-var omdbAPIKey = os.Getenv("OMDB_API")
+var movieProvider provider.MovieProvider = provider.FromEnv()
 
-// GET /api/movies/search?title=...
-func SearchAndSaveMovie(c *gin.Context, db *gorm.DB) {
-	title := strings.TrimSpace(c.Query("title"))
-	if title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "title required"})
-		return
-	}
-
-	exactMatch := c.Query("exact") == "true"
-	//looking for exact match in db first
-	var cached []models.Movie
-	query := db.Model(&models.Movie{})
-
-	if exactMatch {
-		query = query.Where("LOWER(title) = LOWER(?)", title)
-	} else {
-		query = query.Where("title ILIKE ? OR title ILIKE ?",
-			title+"%",
-			"% "+title+"%")
-	}
-
-	if err := query.Find(&cached).Error; err == nil && len(cached) > 0 {
-		//sorting by relevance
-		sort.Slice(cached, func(i, j int) bool {
-			iTitle := strings.ToLower(cached[i].Title)
-			jTitle := strings.ToLower(cached[j].Title)
-
-			//Priority: exact match > starts with > contains
-			if iTitle == strings.ToLower(title) && jTitle != strings.ToLower(title) {
-				return true
-			}
-			if strings.HasPrefix(iTitle, strings.ToLower(title)) &&
-				!strings.HasPrefix(jTitle, strings.ToLower(title)) {
-				return true
-			}
-			return cached[i].Title < cached[j].Title
-		})
-
-		results := make([]interface{}, len(cached))
-		for i, m := range cached {
-			results[i] = struct {
-				ID        uint   `json:"id"`
-				OMDBID    string `json:"omdb_id"`
-				Title     string `json:"title"`
-				Year      string `json:"year"`
-				Poster    string `json:"poster"`
-				Relevance string `json:"relevance,omitempty"`
-			}{
-				ID:     m.ID,
-				OMDBID: m.OMDBID,
-				Title:  m.Title,
-				Year:   m.Year,
-				Poster: m.Poster,
-			}
-		}
-		c.JSON(http.StatusOK, gin.H{
-			"Search": results,
-			"source": "database",
-			"total":  len(results),
-		})
-		return
-	}
-
-	// not in db -> load from OMDb
-	escapedTitle := url.QueryEscape(title)
-	var omdbURL string
-	if exactMatch {
-		omdbURL = fmt.Sprintf("http://www.omdbapi.com/?apikey=%s&s=%s&type=movie", omdbAPIKey, escapedTitle)
-	} else {
-		// regular search with pagination
-		omdbURL = fmt.Sprintf("http://www.omdbapi.com/?apikey=%s&s=%s&type=movie&page=1", omdbAPIKey, escapedTitle)
-	}
-
-	resp, err := http.Get(omdbURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch OMDb"})
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var omdbResp map[string]interface{}
-	if err := json.Unmarshal(body, &omdbResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse OMDb"})
-		return
-	}
-
-	if omdbResp["Response"] != "True" {
-		if errorMsg, ok := omdbResp["Error"].(string); ok && strings.Contains(errorMsg, "not found") {
-			c.JSON(http.StatusOK, gin.H{
-				"Search": []interface{}{},
-				"source": "omdb",
-				"total":  0,
-			})
-			return
-		}
-		c.JSON(http.StatusNotFound, gin.H{"error": omdbResp["Error"]})
-		return
-	}
-
-	moviesData, ok := omdbResp["Search"].([]interface{})
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected OMDb response"})
-		return
-	}
-
-	//sorting OMDb results by relevance
-	sort.Slice(moviesData, func(i, j int) bool {
-		iMap, iOk := moviesData[i].(map[string]interface{})
-		jMap, jOk := moviesData[j].(map[string]interface{})
-		if !iOk || !jOk {
-			return false
-		}
-
-		iTitle := strings.ToLower(fmt.Sprintf("%v", iMap["Title"]))
-		jTitle := strings.ToLower(fmt.Sprintf("%v", jMap["Title"]))
-		searchTerm := strings.ToLower(title)
-
-		//Priority: exact match > starts with > contains
-		if iTitle == searchTerm && jTitle != searchTerm {
-			return true
-		}
-		if strings.HasPrefix(iTitle, searchTerm) && !strings.HasPrefix(jTitle, searchTerm) {
-			return true
-		}
-		return iTitle < jTitle
-	})
-
-	var movies []models.Movie
-	for _, m := range moviesData {
-		mMap, ok := m.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		newMovie := models.Movie{
-			Title:  fmt.Sprintf("%v", mMap["Title"]),
-			Year:   fmt.Sprintf("%v", mMap["Year"]),
-			OMDBID: fmt.Sprintf("%v", mMap["imdbID"]),
-			Poster: fmt.Sprintf("%v", mMap["Poster"]),
-		}
-
-		db.FirstOrCreate(&newMovie, models.Movie{OMDBID: newMovie.OMDBID})
-		movies = append(movies, newMovie)
-	}
+// SetMovieProvider swaps the metadata source (fake fixtures in tests, other APIs later).
+func SetMovieProvider(p provider.MovieProvider) {
+	movieProvider = p
+}
 
-	results := make([]interface{}, len(movies))
-	for i, m := range movies {
-		results[i] = struct {
-			ID     uint   `json:"id"`
-			OMDBID string `json:"omdb_id"`
-			Title  string `json:"title"`
-			Year   string `json:"year"`
-			Poster string `json:"poster"`
-		}{
-			ID:     m.ID,
-			OMDBID: m.OMDBID,
-			Title:  m.Title,
-			Year:   m.Year,
-			Poster: m.Poster,
-		}
+// movieFromDetails maps a provider record onto a new (unsaved) Movie row.
+func movieFromDetails(d *provider.MovieDetails) models.Movie {
+	return models.Movie{
+		OMDBID:   d.IMDbID,
+		Title:    d.Title,
+		Year:     d.Year,
+		Poster:   d.Poster,
+		Plot:     d.Plot,
+		Genre:    d.Genre,
+		Director: d.Director,
+		Actors:   d.Actors,
+		Rating:   d.Rating,
+
+		Certificate: d.Rated,
+		Runtime:     d.Runtime,
+		Votes:       d.VotesCount(),
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"Search": results,
-		"source": "omdb",
-		"total":  len(results),
-	})
 }
 
 // GET /api/movies/:id  db/local id
@@ -218,44 +69,21 @@ func GetMovie(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if movie.Plot == "" || movie.Genre == "" || movie.Director == "" {
-		detailsURL := fmt.Sprintf("http://www.omdbapi.com/?apikey=%s&i=%s", omdbAPIKey, movie.OMDBID)
-		resp, err := http.Get(detailsURL)
-		if err == nil {
-			defer resp.Body.Close()
-
-			body, _ := io.ReadAll(resp.Body)
-			var details map[string]interface{}
-			if err := json.Unmarshal(body, &details); err == nil && details["Response"] == "True" {
-
-				updates := make(map[string]interface{})
-
-				if movie.Plot == "" {
-					movie.Plot = fmt.Sprintf("%v", details["Plot"])
-					updates["plot"] = movie.Plot
-				}
-				if movie.Genre == "" {
-					movie.Genre = fmt.Sprintf("%v", details["Genre"])
-					updates["genre"] = movie.Genre
-				}
-				if movie.Director == "" {
-					movie.Director = fmt.Sprintf("%v", details["Director"])
-					updates["director"] = movie.Director
-				}
-				if movie.Actors == "" {
-					movie.Actors = fmt.Sprintf("%v", details["Actors"])
-					updates["actors"] = movie.Actors
-				}
-				if movie.Rating == "" {
-					movie.Rating = fmt.Sprintf("%v", details["imdbRating"])
-					updates["rating"] = movie.Rating
-				}
-
-				if len(updates) > 0 {
-					db.Model(&movie).Updates(updates)
-				}
-			}
-		}
+	// missing details are fetched by the enrichment worker, not on the request path
+	if enrich.NeedsEnrichment(&movie) {
+		enrich.Enqueue(movie.ID)
+	}
+
+	credits, err := movieCredits(db, movie.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load credits"})
+		return
+	}
+
+	var poster models.MoviePoster
+	if err := db.Where("movie_id = ?", movie.ID).Limit(1).Find(&poster).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load poster"})
+		return
 	}
 
 	c.JSON(http.StatusOK, struct {
@@ -264,135 +92,197 @@ func GetMovie(c *gin.Context, db *gorm.DB) {
 		Title    string `json:"title"`
 		Year     string `json:"year"`
 		Plot     string `json:"plot"`
-		Poster   string `json:"poster"`
+		Poster   string `json:"poster"` // /media/posters/:id/medium
 		Genre    string `json:"genre"`
 		Director string `json:"director"`
 		Actors   string `json:"actors"`
 		Rating   string `json:"rating"`
+		// "pending"/"failed" mean details may still arrive, refetch later
+		EnrichStatus string `json:"enrich_status"`
+
+		AvgRating       float64                `json:"avg_rating"`
+		ReviewCount     int                    `json:"review_count"`
+		RatingHistogram models.RatingHistogram `json:"rating_histogram"` // reviews per rating 1..10
+
+		Credits []CreditSummary `json:"credits"` // link to /api/people/:id
+
+		// of the original poster, zero until it is mirrored
+		PosterWidth  int    `json:"poster_width"`
+		PosterHeight int    `json:"poster_height"`
+		PosterColor  string `json:"poster_color"`
 	}{
 		ID:       movie.ID,
 		OMDBID:   movie.OMDBID,
 		Title:    movie.Title,
 		Year:     movie.Year,
 		Plot:     movie.Plot,
-		Poster:   movie.Poster,
+		Poster:   posterURL(movie.ID),
 		Genre:    movie.Genre,
 		Director: movie.Director,
 		Actors:   movie.Actors,
 		Rating:   movie.Rating,
+
+		EnrichStatus: movie.EnrichStatus,
+
+		AvgRating:       movie.AvgRating,
+		ReviewCount:     movie.ReviewCount,
+		RatingHistogram: movie.RatingHistogram,
+
+		Credits: credits,
+
+		PosterWidth:  poster.Width,
+		PosterHeight: poster.Height,
+		PosterColor:  poster.Color,
 	})
 }
 
-// GET /api/movies/load-by-genre?genre=Action&page=1
+// rating and year are strings in the db, these read them as numbers ("N/A" and "" are NULL)
+const (
+	movieRatingExpr = "NULLIF(NULLIF(movies.rating, ''), 'N/A')::numeric"
+	movieYearExpr   = "NULLIF(substring(movies.year from '^[0-9]{4}'), '')::int"
+)
+
+// movieSortColumns maps ?sort= to an ORDER BY expression
+var movieSortColumns = map[string]string{
+	"rating":      movieRatingExpr,
+	"year":        movieYearExpr,
+	"votes":       "movies.votes",
+	"title":       "movies.title",
+	"avg_rating":  "movies.avg_rating",
+	"certificate": "NULLIF(movies.certificate, '')",
+	"director":    "NULLIF(movies.director, '')",
+}
+
+// movieOrder builds the ORDER BY for ?sort=&order=, ok is false for an unknown sort.
+func movieOrder(c *gin.Context, defaultSort string) (string, bool) {
+	expr, ok := movieSortColumns[c.DefaultQuery("sort", defaultSort)]
+	if !ok {
+		return "", false
+	}
+	dir := "DESC"
+	if strings.ToLower(c.Query("order")) == "asc" {
+		dir = "ASC"
+	}
+	return fmt.Sprintf("%s %s NULLS LAST, movies.id", expr, dir), true
+}
+
+// genreSlugs reads ?genre=Action,Drama (or repeated ?genre=) into unique slugs.
+func genreSlugs(c *gin.Context) []string {
+	seen := map[string]bool{}
+	var slugs []string
+	for _, g := range c.QueryArray("genre") {
+		for _, part := range strings.Split(g, ",") {
+			slug := catalog.GenreSlug(part)
+			if slug != "" && !seen[slug] {
+				seen[slug] = true
+				slugs = append(slugs, slug)
+			}
+		}
+	}
+	return slugs
+}
+
+// withAllGenres keeps movies linked to every one of the genre slugs.
+func withAllGenres(db *gorm.DB, query *gorm.DB, slugs []string) *gorm.DB {
+	return query.Where("movies.id IN (?)", db.Table("movie_genres").
+		Select("movie_genres.movie_id").
+		Joins("JOIN genres ON genres.id = movie_genres.genre_id").
+		Where("genres.slug IN ?", slugs).
+		Group("movie_genres.movie_id").
+		Having("COUNT(DISTINCT movie_genres.genre_id) = ?", len(slugs)))
+}
+
+// GET /api/movies/load-by-genre?genre=Film-Noir,Drama&page=1&limit=20&sort=rating|year|votes|title&order=desc
+// several genres are intersected (movies having all of them)
 func LoadMoviesByGenre(c *gin.Context, db *gorm.DB) {
-    genre := c.Query("genre")
-    if genre == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "genre required"})
-        return
-    }
-
-    pageStr := c.Query("page")
-    page, _ := strconv.Atoi(pageStr)
-    if page < 1 {
-        page = 1
-    }
-
-    limit := 5
-    offset := (page - 1) * limit
-
-    // CSV 
-    filePath := fmt.Sprintf("data/%s.csv", strings.ToLower(genre))
-    f, err := os.Open(filePath)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "genre CSV not found"})
-        return
-    }
-    defer f.Close()
-
-    reader := csv.NewReader(f)
-    rows, _ := reader.ReadAll()
-
-    type csvMovie struct {
-        Title string
-        Year  string
-    }
-    var csvMovies []csvMovie
-    for i, row := range rows {
-        if i == 0 {
-            continue 
-        }
-        if len(row) < 3 {
-            continue
-        }
-        csvMovies = append(csvMovies, csvMovie{
-            Title: row[1],
-            Year:  row[2],
-        })
-    }
-
-    start := offset
-    end := offset + limit
-    if start >= len(csvMovies) {
-        c.JSON(http.StatusOK, []models.Movie{})
-        return
-    }
-    if end > len(csvMovies) {
-        end = len(csvMovies)
-    }
-    pageMovies := csvMovies[start:end]
-
-    var movies []models.Movie
-    for _, m := range pageMovies {
-        var dbMovie models.Movie
-        if err := db.Where("title = ? AND year = ?", m.Title, m.Year).First(&dbMovie).Error; err != nil {
-            // fetch OMDb по title+year
-            omdbURL := fmt.Sprintf("http://www.omdbapi.com/?apikey=%s&t=%s&y=%s", omdbAPIKey, url.QueryEscape(m.Title), m.Year)
-            resp, err := http.Get(omdbURL)
-            if err != nil {
-                continue
-            }
-            body, _ := io.ReadAll(resp.Body)
-            resp.Body.Close()
-
-            var omdbResp map[string]interface{}
-            if err := json.Unmarshal(body, &omdbResp); err != nil || omdbResp["Response"] != "True" {
-                continue
-            }
-
-            dbMovie = models.Movie{
-                Title:    m.Title,
-                Year:     m.Year,
-                OMDBID:   fmt.Sprintf("%v", omdbResp["imdbID"]),
-                Poster:   fmt.Sprintf("%v", omdbResp["Poster"]),
-                Plot:     fmt.Sprintf("%v", omdbResp["Plot"]),
-                Genre:    fmt.Sprintf("%v", omdbResp["Genre"]),
-                Director: fmt.Sprintf("%v", omdbResp["Director"]),
-                Actors:   fmt.Sprintf("%v", omdbResp["Actors"]),
-                Rating:   fmt.Sprintf("%v", omdbResp["imdbRating"]),
-            }
-            db.Create(&dbMovie)
-        }
-		
-        movies = append(movies, dbMovie)
-    }
-
-	results := make([]interface{}, len(movies))
-	for i, m := range movies {
-		results[i] = struct {
-			ID     uint   `json:"id"`
-			OMDBID string `json:"omdb_id"`
-			Title  string `json:"title"`
-			Year   string `json:"year"`
-			Poster string `json:"poster"`
-		}{
+	slugs := genreSlugs(c)
+	if len(slugs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "genre required"})
+		return
+	}
+
+	page, limit := pageParams(c, 5, 100)
+	order, ok := movieOrder(c, "rating")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort"})
+		return
+	}
+
+	query := withAllGenres(db, db.Model(&models.Movie{}), slugs).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count movies"})
+		return
+	}
+
+	var movies []models.Movie
+	if err := query.Order(order).Offset((page - 1) * limit).Limit(limit).Find(&movies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load movies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movies": movieSummaries(movies),
+		"genres": slugs,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GET /api/genres
+func ListGenres(c *gin.Context, db *gorm.DB) {
+	type genreWithCount struct {
+		ID     uint   `json:"id"`
+		Name   string `json:"name"`
+		Slug   string `json:"slug"`
+		Movies int64  `json:"movies"`
+	}
+
+	var genres []genreWithCount
+	if err := db.Table("genres").
+		Select("genres.id, genres.name, genres.slug, COUNT(movie_genres.movie_id) AS movies").
+		Joins("LEFT JOIN movie_genres ON movie_genres.genre_id = genres.id").
+		Group("genres.id").
+		Order("genres.name").
+		Scan(&genres).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load genres"})
+		return
+	}
+
+	c.JSON(http.StatusOK, genres)
+}
+
+// MovieSummary is the short movie shape used in lists.
+type MovieSummary struct {
+	ID     uint   `json:"id"`
+	OMDBID string `json:"omdb_id"`
+	Title  string `json:"title"`
+	Year   string `json:"year"`
+	Poster string `json:"poster"`
+	Genre  string `json:"genre"`
+	Rating string `json:"rating"`
+	Votes  int    `json:"votes"`
+
+	AvgRating float64 `json:"avg_rating"` // community rating from reviews
+}
+
+func movieSummaries(movies []models.Movie) []MovieSummary {
+	out := make([]MovieSummary, 0, len(movies))
+	for _, m := range movies {
+		out = append(out, MovieSummary{
 			ID:     m.ID,
 			OMDBID: m.OMDBID,
 			Title:  m.Title,
 			Year:   m.Year,
-			Poster: m.Poster,
-		}
-	}
+			Poster: posterURL(m.ID),
+			Genre:  m.Genre,
+			Rating: m.Rating,
+			Votes:  m.Votes,
 
-    c.JSON(http.StatusOK, results)
+			AvgRating: m.AvgRating,
+		})
+	}
+	return out
 }
-
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"totallyguysproject/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreditSummary is one person on a movie page.
+type CreditSummary struct {
+	PersonID uint   `json:"person_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Billing  int    `json:"billing"`
+}
+
+// movieCredits lists directors first, then actors, each in billing order.
+func movieCredits(db *gorm.DB, movieID uint) ([]CreditSummary, error) {
+	credits := []CreditSummary{}
+	err := db.Table("movie_credits").
+		Select("movie_credits.person_id, people.name, movie_credits.role, movie_credits.billing").
+		Joins("JOIN people ON people.id = movie_credits.person_id").
+		Where("movie_credits.movie_id = ?", movieID).
+		Order("movie_credits.role = 'director' DESC, movie_credits.billing").
+		Scan(&credits).Error
+	return credits, err
+}
+
+// GET /api/people/:id
+func GetPerson(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid person id"})
+		return
+	}
+
+	var person models.Person
+	if err := db.First(&person, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "person not found"})
+		return
+	}
+
+	type filmographyEntry struct {
+		MovieSummary
+		Role    string `json:"role"`
+		Billing int    `json:"billing"`
+	}
+	var entries []filmographyEntry
+	if err := db.Table("movie_credits").
+		Select(`movies.id, movies.omdb_id, movies.title, movies.year, movies.poster, movies.genre,
+			movies.rating, movies.votes, movies.avg_rating, movie_credits.role, movie_credits.billing`).
+		Joins("JOIN movies ON movies.id = movie_credits.movie_id AND movies.deleted_at IS NULL").
+		Where("movie_credits.person_id = ?", person.ID).
+		Order(movieYearExpr + " DESC NULLS LAST, movies.title").
+		Scan(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load filmography"})
+		return
+	}
+
+	filmography := map[string][]filmographyEntry{
+		models.RoleDirector: {},
+		models.RoleActor:    {},
+	}
+	for _, e := range entries {
+		e.Poster = posterURL(e.ID)
+		filmography[e.Role] = append(filmography[e.Role], e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          person.ID,
+		"imdb_id":     person.IMDbID,
+		"name":        person.Name,
+		"filmography": filmography,
+	})
+}
+
+// GET /api/people/search?q=...&page=1&limit=20
+// matches name substrings and typos, best match first
+func SearchPeople(c *gin.Context, db *gorm.DB) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q required"})
+		return
+	}
+	page, limit := pageParams(c, 20, 100)
+
+	match := db.Table("people").Where("people.name ILIKE ? OR ? <% people.name", "%"+q+"%", q)
+
+	var total int64
+	if err := match.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search people"})
+		return
+	}
+
+	type personResult struct {
+		ID     uint    `json:"id"`
+		IMDbID *string `json:"imdb_id"`
+		Name   string  `json:"name"`
+		Movies int     `json:"movies"`
+	}
+	people := []personResult{}
+	if err := match.
+		Select("people.id, people.imdb_id, people.name, COUNT(DISTINCT movie_credits.movie_id) AS movies").
+		Joins("LEFT JOIN movie_credits ON movie_credits.person_id = people.id").
+		Group("people.id").
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "word_similarity(?, people.name) DESC, movies DESC, people.id",
+			Vars: []interface{}{q},
+		}}).
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&people).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search people"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"people": people,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
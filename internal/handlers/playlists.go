@@ -1,14 +1,174 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const errSmartPlaylist = "a smart playlist's movies come from its rules"
+
+const errDefaultPlaylist = "default playlists can't be renamed or deleted"
+
+// limits for POST /api/playlists and PATCH /api/playlists/:id
+const (
+	maxPlaylistName        = 100
+	maxPlaylistDescription = 2000
+	maxPlaylistTags        = 10
+	maxPlaylistTag         = 30
+)
+
+// smartEntries reads a smart playlist's cached matches in the shape of playlist_movies.
+const smartEntries = `(SELECT playlist_id, movie_id, '' AS description, position, added_at, NULL::bigint AS added_by
+	FROM smart_playlist_movies) playlist_movies`
+
+// systemPlaylists are created with every account. Name is what gets stored,
+// responses show playlistName.
+var systemPlaylists = []struct {
+	Kind, Name, Cover, Visibility string
+}{
+	{models.PlaylistWatchlist, "watch-later", "/src/watch-later-playlist.jpg", models.VisibilityPrivate},
+	{models.PlaylistWatched, "watched", "/src/watched-playlist.jpg", models.VisibilityPublic},
+	{models.PlaylistLiked, "liked", "/src/liked-playlist.jpg", models.VisibilityPublic},
+}
+
+// playlistNames are the display names of the system playlists by language (see LanguageMiddleware).
+var playlistNames = map[string]map[string]string{
+	"en": {
+		models.PlaylistWatchlist: "Watch later",
+		models.PlaylistWatched:   "Watched",
+		models.PlaylistLiked:     "Liked",
+	},
+	"ru": {
+		models.PlaylistWatchlist: "Посмотреть позже",
+		models.PlaylistWatched:   "Просмотрено",
+		models.PlaylistLiked:     "Понравилось",
+	},
+}
+
+// createSystemPlaylists gives a new account its watchlist, watched and liked playlists.
+func createSystemPlaylists(db *gorm.DB, ownerID uint) error {
+	for _, sp := range systemPlaylists {
+		if err := db.Create(&models.Playlist{
+			Name:       sp.Name,
+			Kind:       sp.Kind,
+			OwnerID:    ownerID,
+			Cover:      sp.Cover,
+			Visibility: sp.Visibility,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSystemPlaylist: the playlists every account is created with; they can't be renamed or deleted.
+func isSystemPlaylist(p *models.Playlist) bool {
+	return p.Kind != "" && p.Kind != models.PlaylistCustom
+}
+
+// systemPlaylist loads one of the user's system playlists by kind.
+func systemPlaylist(db *gorm.DB, userID uint, kind string) (*models.Playlist, error) {
+	var playlist models.Playlist
+	if err := db.Where("owner_id = ? AND kind = ?", userID, kind).First(&playlist).Error; err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// playlistName is p's name as the request's language shows it; custom playlists keep their own.
+func playlistName(c *gin.Context, p *models.Playlist) string {
+	return playlistNameIn(c.GetString("language"), p)
+}
+
+// playlistNameIn is p's name in lang. Notifications, which don't know the recipient's
+// language, use "en" and send the kind for clients to localize.
+func playlistNameIn(lang string, p *models.Playlist) string {
+	if !isSystemPlaylist(p) {
+		return p.Name
+	}
+	names, ok := playlistNames[lang]
+	if !ok {
+		names = playlistNames["en"]
+	}
+	if name, ok := names[p.Kind]; ok {
+		return name
+	}
+	return p.Name
+}
+
+// playlistCover: system playlists have fixed covers.
+func playlistCover(p *models.Playlist) string {
+	for _, sp := range systemPlaylists {
+		if sp.Kind == p.Kind {
+			return sp.Cover
+		}
+	}
+	return p.Cover
+}
+
+// normalizeTags trims, lowercases and dedupes tags, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len([]rune(t)) > maxPlaylistTag {
+			return nil, fmt.Errorf("tags are at most %d characters", maxPlaylistTag)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxPlaylistTags {
+		return nil, fmt.Errorf("at most %d tags", maxPlaylistTags)
+	}
+	return out, nil
+}
+
+// playlistManualOrder: reordered entries by position, anything added since after them, oldest first
+const playlistManualOrder = "playlist_movies.position ASC NULLS LAST, playlist_movies.added_at ASC NULLS FIRST, playlist_movies.movie_id"
+
+// playlistSortColumns maps ?sort= on playlist reads to an ORDER BY expression and its default direction
+var playlistSortColumns = map[string]struct{ expr, dir string }{
+	"added":  {"playlist_movies.added_at", "DESC"},
+	"year":   {movieYearExpr, "DESC"},
+	"rating": {movieRatingExpr, "DESC"},
+}
+
+// playlistOrder builds the ORDER BY for ?sort=&order= (manual by default, which ignores order),
+// ok is false for an unknown sort. Ties keep the manual order.
+func playlistOrder(c *gin.Context) (string, bool) {
+	sort := c.DefaultQuery("sort", "manual")
+	if sort == "manual" {
+		return playlistManualOrder, true
+	}
+	col, ok := playlistSortColumns[sort]
+	if !ok {
+		return "", false
+	}
+	dir := col.dir
+	switch strings.ToLower(c.Query("order")) {
+	case "asc":
+		dir = "ASC"
+	case "desc":
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s NULLS LAST, %s", col.expr, dir, playlistManualOrder), true
+}
+
 // POST /api/playlists authorized only
 func CreatePlaylist(c *gin.Context, db *gorm.DB) {
 	userID, ok := c.Get("userID")
@@ -18,45 +178,112 @@ func CreatePlaylist(c *gin.Context, db *gorm.DB) {
 	}
 
 	var req struct {
-		Name  string `json:"name"`
-		Cover string `json:"cover"` //
+		Name        string             `json:"name"`
+		Description string             `json:"description"`
+		Tags        []string           `json:"tags"`
+		Cover       string             `json:"cover"` //
+		Visibility  string             `json:"visibility"`
+		Rules       *models.SmartRules `json:"rules"` // makes it a smart playlist
 	}
-	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxPlaylistName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be 1 to %d characters", maxPlaylistName)})
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if len([]rune(req.Description)) > maxPlaylistDescription {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("description is at most %d characters", maxPlaylistDescription)})
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Rules != nil {
+		if err := smart.Validate(req.Rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	if req.Cover == "" {
 		req.Cover = "/src/default-playlist.jpg"
 	}
+	if req.Visibility == "" {
+		req.Visibility = defaultVisibility(db, userID.(uint))
+	} else if !validVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, unlisted or private"})
+		return
+	}
 
 	playlist := models.Playlist{
-		Name:    req.Name,
-		OwnerID: userID.(uint),
-		Cover:   req.Cover,
+		Name:        req.Name,
+		Description: req.Description,
+		Tags:        tags,
+		OwnerID:     userID.(uint),
+		Cover:       req.Cover,
+		Visibility:  req.Visibility,
+		Rules:       req.Rules,
+	}
+	if req.Visibility == models.VisibilityUnlisted {
+		token, err := newShareToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share token"})
+			return
+		}
+		playlist.ShareToken = token
 	}
 	if err := db.Create(&playlist).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create playlist"})
 		return
 	}
+	if playlist.Rules != nil {
+		// a failure here is retried by the first read
+		if err := smart.Refresh(db, &playlist); err != nil {
+			fmt.Println("smart playlist refresh failed:", err)
+		}
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"id":    playlist.ID,
-		"name":  playlist.Name,
-		"cover": playlist.Cover,
+		"id":          playlist.ID,
+		"name":        playlist.Name,
+		"description": playlist.Description,
+		"tags":        playlist.Tags,
+		"cover":       playlist.Cover,
+		"visibility":  playlist.Visibility,
+		"share_token": shareTokenValue(&playlist),
+		"smart":       playlist.Rules != nil,
 	})
 
 }
 
-// GET /api/playlists/:id
+// GET /api/playlists/:id?token=&sort=manual|added|year|rating&order=asc|desc
+// the token opens unlisted playlists; private and unlisted ones look missing to everybody else
 func GetPlaylist(c *gin.Context, db *gorm.DB) {
 	id := c.Param("id")
+	viewer := viewerID(c)
 
 	var playlist models.Playlist
 	if err := db.First(&playlist, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
 		return
 	}
+	role := ""
+	switch {
+	case viewer != 0 && viewer == playlist.OwnerID:
+		role = "owner"
+	case viewer != 0:
+		role = collaboratorRole(db, playlist.ID, viewer)
+	}
+	if role == "" && !canViewPlaylist(&playlist, viewer, c.Query("token")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
 
 	var owner models.User
 	if err := db.First(&owner, playlist.OwnerID).Error; err != nil {
@@ -64,46 +291,83 @@ func GetPlaylist(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	order, ok := playlistOrder(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be manual, added, year or rating"})
+		return
+	}
+
 	type MovieWithDescription struct {
 		models.Movie
-		Description string `json:"description"`
+		Description string     `json:"description"`
+		Position    *int       `json:"position"`
+		AddedAt     *time.Time `json:"added_at"`
+		AddedBy     *uint      `json:"added_by"`
+		AddedByName string     `json:"added_by_name,omitempty"`
+	}
+
+	entries := "playlist_movies"
+	if playlist.Rules != nil {
+		// computed on first read; afterwards the smart worker keeps it fresh
+		if playlist.RefreshedAt == nil {
+			if err := smart.Refresh(db, &playlist); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute smart playlist"})
+				return
+			}
+		}
+		entries = smartEntries
 	}
 
 	var movies []MovieWithDescription
 	if err := db.Table("movies").
-		Select("movies.*, playlist_movies.description").
-		Joins("JOIN playlist_movies ON playlist_movies.movie_id = movies.id").
+		Select(`movies.*, playlist_movies.description, playlist_movies.position, playlist_movies.added_at,
+			playlist_movies.added_by, adder.name AS added_by_name`).
+		Joins("JOIN "+entries+" ON playlist_movies.movie_id = movies.id").
+		Joins("LEFT JOIN users adder ON adder.id = playlist_movies.added_by").
 		Where("playlist_movies.playlist_id = ?", playlist.ID).
+		Order(order).
 		Scan(&movies).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load movies"})
 		return
 	}
-
-	//static covers for default playlists
-	var cover string
-	switch playlist.Name {
-	case "watched":
-		cover = "/src/watched-playlist.jpg"
-	case "watch-later":
-		cover = "/src/watch-later-playlist.jpg"
-	case "liked":
-		cover = "/src/liked-playlist.jpg"
-	default:
-		cover = playlist.Cover
+	for i := range movies {
+		movies[i].Poster = posterURL(movies[i].ID)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":         playlist.ID,
-		"name":       playlist.Name,
-		"ownerId":    playlist.OwnerID,
-		"movies":     movies,
-		"owner_name": owner.Name,
-		"cover":      cover,
-	})
+	resp := gin.H{
+		"id":           playlist.ID,
+		"name":         playlist.Name,
+		"kind":         playlist.Kind,
+		"display_name": playlistName(c, &playlist),
+		"ownerId":      playlist.OwnerID,
+		"movies":       movies,
+		"owner_name":   owner.Name,
+		"cover":        playlistCover(&playlist),
+		"visibility":   playlist.Visibility,
+
+		"description":   playlist.Description,
+		"tags":          playlist.Tags,
+		"order_version": playlist.OrderVersion,
+		"role":          role,
+		"smart":         playlist.Rules != nil,
+	}
+	if playlist.Rules != nil {
+		resp["rules"] = playlist.Rules
+		resp["refreshed_at"] = playlist.RefreshedAt
+	}
+	if from := forkedFrom(db, &playlist, viewer); from != nil {
+		resp["forked_from"] = from
+	}
+	if role == "owner" {
+		resp["share_token"] = shareTokenValue(&playlist)
+	} else if viewer != 0 {
+		resp["subscribed"] = isSubscribed(db, playlist.ID, viewer)
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// POST /api/playlists/:id/add
-func AddMovieToPlaylist(c *gin.Context, db *gorm.DB) {
+// POST /api/playlists/:id/add  the owner and editors
+func AddMovieToPlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 	//authenticated only
 	uid, ok := c.Get("userID")
 	if !ok {
@@ -138,9 +402,12 @@ func AddMovieToPlaylist(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	// ownership check
-	if playlist.OwnerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+	if !canEditPlaylist(db, &playlist, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can't edit this playlist"})
+		return
+	}
+	if playlist.Rules != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSmartPlaylist})
 		return
 	}
 
@@ -169,12 +436,19 @@ func AddMovieToPlaylist(c *gin.Context, db *gorm.DB) {
 		}
 	}
 
-	// append association
-	if err := db.Model(&playlist).Association("Movies").Append(&movie); err != nil {
+	entry := models.PlaylistMovie{PlaylistID: playlist.ID, MovieID: movie.ID, AddedBy: &userID}
+	if err := db.Create(&entry).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add movie to playlist"})
 		return
 	}
 
+	smart.Enqueue(playlist.OwnerID)
+	notifyPlaylist(db, hub, &playlist, userID, map[string]interface{}{
+		"action":      "added",
+		"movie_id":    movie.ID,
+		"movie_title": movie.Title,
+	})
+	notifySubscribers(db, hub, &playlist, userID, []models.Movie{movie})
 	c.JSON(http.StatusOK, gin.H{"message": "movie added", "movie": movie})
 }
 
@@ -205,11 +479,27 @@ func DeletePlaylist(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
 		return
 	}
+	if isSystemPlaylist(&playlist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errDefaultPlaylist})
+		return
+	}
 
 	if err := db.Model(&playlist).Association("Movies").Clear(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear playlist movies"})
 		return
 	}
+	if err := db.Where("playlist_id = ?", playlist.ID).Delete(&models.PlaylistCollaborator{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove collaborators"})
+		return
+	}
+	if err := db.Where("playlist_id = ?", playlist.ID).Delete(&models.SmartPlaylistMovie{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear playlist movies"})
+		return
+	}
+	if err := db.Where("playlist_id = ?", playlist.ID).Delete(&models.PlaylistSubscription{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove subscriptions"})
+		return
+	}
 
 	if err := db.Unscoped().Delete(&playlist).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete playlist"})
@@ -219,8 +509,8 @@ func DeletePlaylist(c *gin.Context, db *gorm.DB) {
 	c.JSON(http.StatusOK, gin.H{"message": "playlist deleted"})
 }
 
-// DELETE /api/playlists/:id/movies/:movie_id
-func RemoveMovieFromPlaylist(c *gin.Context, db *gorm.DB) {
+// DELETE /api/playlists/:id/movies/:movie_id  the owner and editors
+func RemoveMovieFromPlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 	uid, ok := c.Get("userID")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -250,8 +540,12 @@ func RemoveMovieFromPlaylist(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if playlist.OwnerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+	if !canEditPlaylist(db, &playlist, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can't edit this playlist"})
+		return
+	}
+	if playlist.Rules != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSmartPlaylist})
 		return
 	}
 
@@ -261,16 +555,27 @@ func RemoveMovieFromPlaylist(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	if inDiary(db, &playlist, movie.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": errInDiary})
+		return
+	}
+
 	if err := db.Model(&playlist).Association("Movies").Unscoped().Delete(&movie); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove movie"})
 		return
 	}
 
+	smart.Enqueue(playlist.OwnerID)
+	notifyPlaylist(db, hub, &playlist, userID, map[string]interface{}{
+		"action":      "removed",
+		"movie_id":    movie.ID,
+		"movie_title": movie.Title,
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "movie removed from playlist"})
 }
 
 // POST /api/movies/:id/like
-func LikeMovie(c *gin.Context, db *gorm.DB) {
+func LikeMovie(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 	uid, ok := c.Get("userID")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -286,9 +591,9 @@ func LikeMovie(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	// find default playlist "liked"
+	// the user's liked playlist
 	var playlist models.Playlist
-	if err := db.Where("owner_id = ? AND name = ?", userID, "liked").Preload("Movies").First(&playlist).Error; err != nil {
+	if err := db.Where("owner_id = ? AND kind = ?", userID, models.PlaylistLiked).Preload("Movies").First(&playlist).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find liked playlist"})
 		return
 	}
@@ -305,6 +610,8 @@ func LikeMovie(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	notifySubscribers(db, hub, &playlist, userID, []models.Movie{movie})
+	smart.Enqueue(userID)
 	c.JSON(http.StatusOK, gin.H{"message": "liked", "movie": movie})
 }
 
@@ -326,7 +633,7 @@ func UnlikeMovie(c *gin.Context, db *gorm.DB) {
 	}
 
 	var playlist models.Playlist
-	if err := db.Where("owner_id = ? AND name = ?", userID, "liked").Preload("Movies").First(&playlist).Error; err != nil {
+	if err := db.Where("owner_id = ? AND kind = ?", userID, models.PlaylistLiked).Preload("Movies").First(&playlist).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find liked playlist"})
 		return
 	}
@@ -336,11 +643,12 @@ func UnlikeMovie(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	smart.Enqueue(userID)
 	c.JSON(http.StatusOK, gin.H{"message": "unliked", "movie": movie})
 }
 
-// PUT /api/playlists/:id/movies/:movie_id/description
-func UpdateMovieDescriptionInPlaylist(c *gin.Context, db *gorm.DB) {
+// PUT /api/playlists/:id/movies/:movie_id/description  the owner and editors
+func UpdateMovieDescriptionInPlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 	uid, ok := c.Get("userID")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -369,8 +677,12 @@ func UpdateMovieDescriptionInPlaylist(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
 		return
 	}
-	if playlist.OwnerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+	if !canEditPlaylist(db, &playlist, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can't edit this playlist"})
+		return
+	}
+	if playlist.Rules != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSmartPlaylist})
 		return
 	}
 
@@ -388,6 +700,7 @@ func UpdateMovieDescriptionInPlaylist(c *gin.Context, db *gorm.DB) {
 			PlaylistID:  playlistID,
 			MovieID:     movieID,
 			Description: req.Description,
+			AddedBy:     &userID,
 		}
 		if err := db.Create(&link).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
@@ -401,8 +714,220 @@ func UpdateMovieDescriptionInPlaylist(c *gin.Context, db *gorm.DB) {
 		}
 	}
 
+	notifyPlaylist(db, hub, &playlist, userID, map[string]interface{}{
+		"action":      "described",
+		"movie_id":    movieID,
+		"description": link.Description,
+	})
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "description updated",
 		"description": link.Description,
 	})
 }
+
+// PUT /api/playlists/:id/order  {"movie_ids": [...], "order_version": 3}  the owner and editors
+// movie_ids must be exactly the playlist's movies in their new order. A list that misses or adds
+// movies (someone changed the playlist meanwhile) or a stale order_version is a 409 carrying the
+// current order, so the client can merge and retry.
+func ReorderPlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	playlist, userID, ok := loadEditablePlaylist(c, db)
+	if !ok {
+		return
+	}
+	if playlist.Rules != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSmartPlaylist})
+		return
+	}
+
+	var req struct {
+		MovieIDs     []uint `json:"movie_ids"`
+		OrderVersion *int   `json:"order_version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	var current []uint
+	version := 0
+	conflict := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.Playlist
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, playlist.ID).Error; err != nil {
+			return err
+		}
+		version = locked.OrderVersion
+		if err := tx.Model(&models.PlaylistMovie{}).
+			Where("playlist_id = ?", playlist.ID).
+			Order(playlistManualOrder).
+			Pluck("movie_id", &current).Error; err != nil {
+			return err
+		}
+		if (req.OrderVersion != nil && *req.OrderVersion != version) || !sameMovies(req.MovieIDs, current) {
+			conflict = true
+			return nil
+		}
+
+		ids := make([]string, len(req.MovieIDs))
+		for i, id := range req.MovieIDs {
+			ids[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		if err := tx.Exec(`UPDATE playlist_movies SET position = o.pos
+			FROM unnest(?::bigint[]) WITH ORDINALITY AS o(movie_id, pos)
+			WHERE playlist_movies.playlist_id = ? AND playlist_movies.movie_id = o.movie_id`,
+			"{"+strings.Join(ids, ",")+"}", playlist.ID).Error; err != nil {
+			return err
+		}
+		version++
+		current = req.MovieIDs
+		return tx.Model(&locked).UpdateColumn("order_version", version).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder playlist"})
+		return
+	}
+	if conflict {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "playlist changed, reload and retry",
+			"movie_ids":     current,
+			"order_version": version,
+		})
+		return
+	}
+
+	notifyPlaylist(db, hub, playlist, userID, map[string]interface{}{
+		"action":        "reordered",
+		"order_version": version,
+	})
+	c.JSON(http.StatusOK, gin.H{"movie_ids": current, "order_version": version})
+}
+
+// sameMovies: want is a permutation of have.
+func sameMovies(want, have []uint) bool {
+	if len(want) != len(have) {
+		return false
+	}
+	left := make(map[uint]int, len(have))
+	for _, id := range have {
+		left[id]++
+	}
+	for _, id := range want {
+		if left[id] == 0 {
+			return false
+		}
+		left[id]--
+	}
+	return true
+}
+
+// PUT /api/playlists/:id/rules  the owner of a smart playlist
+// body: {"match": "all", "rules": [{"field": "genre", "op": "contains", "value": "noir"}], "sort": "rating", "limit": 50}
+func UpdatePlaylistRules(c *gin.Context, db *gorm.DB) {
+	playlist, ok := loadOwnPlaylist(c, db)
+	if !ok {
+		return
+	}
+	if playlist.Rules == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not a smart playlist"})
+		return
+	}
+
+	var rules models.SmartRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := smart.Validate(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	playlist.Rules = &rules
+	if err := db.Model(playlist).Select("rules").Updates(playlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rules"})
+		return
+	}
+	if err := smart.Refresh(db, playlist); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute smart playlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": playlist.Rules, "refreshed_at": playlist.RefreshedAt})
+}
+
+// PATCH /api/playlists/:id  {"name": "...", "description": "...", "tags": ["noir", "1940s"]}
+// the owner; fields left out are kept. Default playlists can't be renamed.
+func UpdatePlaylist(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	playlist, ok := loadOwnPlaylist(c, db)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string   `json:"name"`
+		Description *string   `json:"description"`
+		Tags        *[]string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		switch {
+		case name == playlist.Name:
+		case isSystemPlaylist(playlist):
+			c.JSON(http.StatusForbidden, gin.H{"error": errDefaultPlaylist})
+			return
+		case name == "" || len([]rune(name)) > maxPlaylistName:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be 1 to %d characters", maxPlaylistName)})
+			return
+		default:
+			updates["name"] = name
+		}
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if len([]rune(description)) > maxPlaylistDescription {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("description is at most %d characters", maxPlaylistDescription)})
+			return
+		}
+		updates["description"] = description
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// map updates skip the json serializer
+		encoded, _ := json.Marshal(tags)
+		updates["tags"] = string(encoded)
+		playlist.Tags = tags
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := db.Model(playlist).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update playlist"})
+		return
+	}
+	if name, ok := updates["name"].(string); ok {
+		playlist.Name = name
+	}
+	if description, ok := updates["description"].(string); ok {
+		playlist.Description = description
+	}
+
+	notifyPlaylist(db, hub, playlist, playlist.OwnerID, map[string]interface{}{"action": "edited"})
+	c.JSON(http.StatusOK, gin.H{
+		"id":          playlist.ID,
+		"name":        playlist.Name,
+		"description": playlist.Description,
+		"tags":        playlist.Tags,
+	})
+}
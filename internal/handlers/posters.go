@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/posters"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// posterURL is what list and detail responses send as "poster": the mirrored copy,
+// never the OMDb hotlink. The frontend may swap the size segment.
+func posterURL(movieID uint) string {
+	return posters.URL(movieID, posters.DefaultSize)
+}
+
+// GET /media/posters/:id/:size   size: small|medium|large|original
+// mirrored posters are cached for a week (ETag changes when the poster does);
+// anything else gets a short-lived placeholder and is queued for mirroring
+func GetPoster(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid movie id"})
+		return
+	}
+	size := c.Param("size")
+	if _, ok := posters.Sizes[size]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be one of small, medium, large, original"})
+		return
+	}
+
+	var poster models.MoviePoster
+	if err := db.Where("movie_id = ?", id).Limit(1).Find(&poster).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load poster"})
+		return
+	}
+
+	if poster.Status == posters.StatusMirrored {
+		path := posters.File(uint(id), size)
+		if _, err := os.Stat(path); err == nil {
+			c.Header("Cache-Control", "public, max-age=604800")
+			c.Header("ETag", fmt.Sprintf(`"%d-%s-%d"`, id, size, poster.UpdatedAt.Unix()))
+			if poster.Color != "" {
+				c.Header("X-Poster-Color", poster.Color)
+			}
+			c.File(path) // answers If-None-Match / If-Modified-Since itself
+			return
+		}
+	}
+	if poster.MovieID == 0 || poster.Status != posters.StatusMissing {
+		posters.Enqueue(uint(id))
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "image/svg+xml", posters.Placeholder(size))
+}
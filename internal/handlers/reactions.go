@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"totallyguysproject/internal/banned"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/reactions"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// POST /api/reviews/:id/reactions  {"type": "helpful"}
+// helpful and unhelpful replace each other, the other types stack.
+func AddReviewReaction(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	if banned.IsBanned(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are banned from posting"})
+		return
+	}
+
+	review, ok := reactionReview(c, db)
+	if !ok {
+		return
+	}
+	if review.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't react to your own review"})
+		return
+	}
+
+	var req struct {
+		Type string `json:"type"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !reactions.Valid(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of " + strings.Join(reactions.Types, ", ")})
+		return
+	}
+
+	var added bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if opposite := reactions.Opposite(req.Type); opposite != "" {
+			if err := tx.Where("review_id = ? AND user_id = ? AND type = ?", review.ID, userID, opposite).
+				Delete(&models.ReviewReaction{}).Error; err != nil {
+				return err
+			}
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ReviewReaction{ReviewID: review.ID, UserID: userID, Type: req.Type})
+		added = res.RowsAffected > 0
+		return res.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save reaction"})
+		return
+	}
+	if added {
+		reactions.Enqueue(review.ID)
+	}
+
+	respondReactions(c, db, review.ID, userID)
+}
+
+// DELETE /api/reviews/:id/reactions/:type
+func RemoveReviewReaction(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	review, ok := reactionReview(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Where("review_id = ? AND user_id = ? AND type = ?", review.ID, userID, c.Param("type")).
+		Delete(&models.ReviewReaction{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove reaction"})
+		return
+	}
+
+	respondReactions(c, db, review.ID, userID)
+}
+
+// reactionReview loads the review of the :id param, answering the request itself when it can't.
+func reactionReview(c *gin.Context, db *gorm.DB) (*models.Review, bool) {
+	rid64, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return nil, false
+	}
+	var review models.Review
+	if err := db.First(&review, uint(rid64)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+		return nil, false
+	}
+	return &review, true
+}
+
+// respondReactions answers with the review's counts and the caller's own reactions.
+func respondReactions(c *gin.Context, db *gorm.DB, reviewID, userID uint) {
+	counts, err := reactions.Counts(db, []uint{reviewID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reactions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"review_id":    reviewID,
+		"reactions":    counts[reviewID],
+		"helpfulness":  reactions.Wilson(counts[reviewID][reactions.Helpful], counts[reviewID][reactions.Unhelpful]),
+		"my_reactions": reactions.Mine(db, reviewID, userID),
+	})
+}
+
+// withReactions fills in the reaction counts and helpfulness of a review listing.
+func withReactions(db *gorm.DB, reviews []ReviewWithMovieAndUser) error {
+	ids := make([]uint, len(reviews))
+	for i, r := range reviews {
+		ids[i] = r.ID
+	}
+	counts, err := reactions.Counts(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range reviews {
+		n := counts[reviews[i].ID]
+		reviews[i].Reactions = n
+		reviews[i].Helpfulness = reactions.Wilson(n[reactions.Helpful], n[reactions.Unhelpful])
+	}
+	return nil
+}
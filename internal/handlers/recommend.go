@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/recommend"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RecommendedMovie is one feed entry with why it was picked.
+type RecommendedMovie struct {
+	MovieSummary
+	Score         float64 `json:"score"`
+	BecauseID     *uint   `json:"because_id"`
+	BecauseTitle  string  `json:"because_title,omitempty"`
+	FollowedCount int     `json:"followed_count"`
+	Reason        string  `json:"reason"`
+}
+
+func recommendationReason(m RecommendedMovie) string {
+	var parts []string
+	if m.BecauseTitle != "" {
+		parts = append(parts, fmt.Sprintf("Because you liked «%s»", m.BecauseTitle))
+	}
+	switch {
+	case m.FollowedCount == 1:
+		parts = append(parts, "rated highly by someone you follow")
+	case m.FollowedCount > 1:
+		parts = append(parts, fmt.Sprintf("rated highly by %d people you follow", m.FollowedCount))
+	}
+	reason := strings.Join(parts, ", ")
+	if reason != "" {
+		reason = strings.ToUpper(reason[:1]) + reason[1:]
+	}
+	return reason
+}
+
+// loadRecommendations skips picks the user has reviewed or playlisted since they were computed.
+func loadRecommendations(db *gorm.DB, userID uint, offset, limit int) ([]RecommendedMovie, int64, time.Time, error) {
+	type row struct {
+		RecommendedMovie
+		ComputedAt time.Time
+	}
+	query := db.Table("recommendations").
+		Joins("JOIN movies ON movies.id = recommendations.movie_id AND movies.deleted_at IS NULL").
+		Where("recommendations.user_id = ?", userID).
+		Where(`NOT EXISTS (SELECT 1 FROM reviews
+			WHERE reviews.user_id = recommendations.user_id AND reviews.movie_id = recommendations.movie_id
+				AND reviews.deleted_at IS NULL)`).
+		Where(`NOT EXISTS (SELECT 1 FROM playlist_movies
+			JOIN playlists ON playlists.id = playlist_movies.playlist_id AND playlists.deleted_at IS NULL
+			WHERE playlists.owner_id = recommendations.user_id AND playlist_movies.movie_id = recommendations.movie_id)`)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	var rows []row
+	err := query.
+		Select(`movies.id, movies.omdb_id, movies.title, movies.year, movies.poster, movies.genre,
+			movies.rating, movies.votes, movies.avg_rating,
+			recommendations.score, recommendations.because_id, because.title AS because_title,
+			recommendations.followed_count, recommendations.computed_at`).
+		Joins("LEFT JOIN movies because ON because.id = recommendations.because_id AND because.deleted_at IS NULL").
+		Order("recommendations.score DESC, movies.id").
+		Offset(offset).Limit(limit).
+		Scan(&rows).Error
+
+	out := make([]RecommendedMovie, 0, len(rows))
+	var computedAt time.Time
+	for _, r := range rows {
+		r.Poster = posterURL(r.ID)
+		r.Reason = recommendationReason(r.RecommendedMovie)
+		out = append(out, r.RecommendedMovie)
+		computedAt = r.ComputedAt
+	}
+	return out, total, computedAt, err
+}
+
+// GET /api/users/me/recommendations?page=1&limit=20
+// precomputed by internal/recommend; a user the job has never reached is computed on the spot
+func GetMyRecommendations(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+	page, limit := pageParams(c, 20, 50)
+
+	movies, total, computedAt, err := loadRecommendations(db, userID, (page-1)*limit, limit)
+	if err == nil && total == 0 {
+		var user models.User
+		db.Select("id", "recommendations_computed_at").First(&user, userID)
+		if user.RecommendationsComputedAt == nil {
+			if err = recommend.ComputeUsers(db, []uint{userID}, recommend.DefaultConfig()); err == nil {
+				movies, total, computedAt, err = loadRecommendations(db, userID, (page-1)*limit, limit)
+			}
+		} else {
+			computedAt = *user.RecommendationsComputedAt
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recommendations": movies,
+		"total":           total,
+		"page":            page,
+		"limit":           limit,
+		"computed_at":     computedAt,
+	})
+}
@@ -1,17 +1,24 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 	"totallyguysproject/internal/banned"
 	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ratings"
+	"totallyguysproject/internal/reactions"
+	"totallyguysproject/internal/recommend"
+	"totallyguysproject/internal/smart"
 	"totallyguysproject/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ReviewWithMovie struct {
@@ -39,6 +46,9 @@ type ReviewWithMovieAndUser struct {
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 	ContainsSpoiler bool      `json:"contains_spoiler"`
+
+	Reactions   map[string]int64 `json:"reactions" gorm:"-"`
+	Helpfulness float64          `json:"helpfulness" gorm:"-"` // see reactions.Wilson
 }
 
 // POST /api/movies/:id/reviews
@@ -87,7 +97,13 @@ func CreateReview(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 		ContainsSpoiler: req.ContainsSpoiler,
 	}
 
-	if err := db.Create(&review).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return ratings.Add(tx, movieID, review.Rating)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create review"})
 		return
 	}
@@ -98,6 +114,8 @@ func CreateReview(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 		for _, f := range followers {
 			followerIDs = append(followerIDs, f.FollowerID)
 		}
+		recommend.Enqueue(movieID, append([]uint{userID}, followerIDs...)...)
+		smart.Enqueue(append([]uint{userID}, followerIDs...)...)
 
 		var author models.User
 		if err := db.First(&author, userID).Error; err != nil {
@@ -122,7 +140,8 @@ func CreateReview(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
 	c.JSON(http.StatusCreated, review)
 }
 
-// GET /api/movies/:id/reviews
+// GET /api/movies/:id/reviews?sort=newest|helpful
+// helpful puts the reviews most found helpful first, newest first among equals.
 func GetReviewsForMovie(c *gin.Context, db *gorm.DB) {
 	movieIDStr := c.Param("id")
 	movieID64, err := strconv.ParseUint(movieIDStr, 10, 64)
@@ -132,8 +151,18 @@ func GetReviewsForMovie(c *gin.Context, db *gorm.DB) {
 	}
 	movieID := uint(movieID64)
 
+	sortBy := c.Query("sort")
+	if sortBy != "" && sortBy != "newest" && sortBy != "helpful" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest or helpful"})
+		return
+	}
+
+	query := db.Table("reviews")
+	if sortBy != "" {
+		query = query.Order("reviews.created_at DESC")
+	}
 	var reviews []ReviewWithMovieAndUser
-	if err := db.Table("reviews").
+	if err := query.
 		Select(`
 			reviews.id, reviews.movie_id, movies.title AS movie_title,
 			reviews.user_id, users.name AS user_name, users.avatar AS user_avatar,
@@ -146,6 +175,15 @@ func GetReviewsForMovie(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reviews"})
 		return
 	}
+	if err := withReactions(db, reviews); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reactions"})
+		return
+	}
+	if sortBy == "helpful" {
+		sort.SliceStable(reviews, func(i, j int) bool {
+			return reviews[i].Helpfulness > reviews[j].Helpfulness
+		})
+	}
 
 	c.JSON(http.StatusOK, reviews)
 }
@@ -182,6 +220,16 @@ func GetReview(c *gin.Context, db *gorm.DB) {
 	var commentsCount int64
 	db.Model(&models.Comment{}).Where("review_id = ?", reviewID).Count(&commentsCount)
 
+	counts, err := reactions.Counts(db, []uint{reviewID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reactions"})
+		return
+	}
+	myReactions := []string{}
+	if uid, ok := c.Get("userID"); ok {
+		myReactions = reactions.Mine(db, reviewID, uid.(uint))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id":               review.ID,
 		"user_id":          review.UserID,
@@ -194,6 +242,9 @@ func GetReview(c *gin.Context, db *gorm.DB) {
 		"contains_spoiler": review.ContainsSpoiler,
 		"created_at":       review.CreatedAt,
 		"comments_count":   commentsCount,
+		"reactions":        counts[reviewID],
+		"helpfulness":      reactions.Wilson(counts[reviewID][reactions.Helpful], counts[reviewID][reactions.Unhelpful]),
+		"my_reactions":     myReactions,
 	})
 }
 
@@ -235,14 +286,29 @@ func UpdateReview(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	review.Content = req.Content
-	review.Rating = req.Rating
-	review.ContainsSpoiler = req.ContainsSpoiler
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// re-read under lock, the old rating is what the movie counts now
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&review, reviewID).Error; err != nil {
+			return err
+		}
+		oldRating := review.Rating
 
-	if err := db.Save(&review).Error; err != nil {
+		review.Content = req.Content
+		review.Rating = req.Rating
+		review.ContainsSpoiler = req.ContainsSpoiler
+
+		if err := tx.Save(&review).Error; err != nil {
+			return err
+		}
+		return ratings.Change(tx, review.MovieID, oldRating, review.Rating)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update review"})
 		return
 	}
+	recommend.Enqueue(review.MovieID, userID)
+	// followers' smart playlists can match on the rating
+	smart.Enqueue(append([]uint{userID}, followerIDs(db, userID)...)...)
 
 	c.JSON(http.StatusOK, review)
 }
@@ -275,25 +341,60 @@ func DeleteReview(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if err := db.Exec(`
-        DELETE FROM comment_votes 
-        WHERE comment_id IN (SELECT id FROM comments WHERE review_id = ?)
-    `, reviewID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comment votes"})
+	if err := deleteReviewTx(db, &review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	smart.Enqueue(append([]uint{userID}, followerIDs(db, userID)...)...)
 
-	if err := db.Where("review_id = ?", reviewID).Unscoped().Delete(&models.Comment{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comments"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted"})
+}
 
-	if err := db.Unscoped().Delete(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete review"})
-		return
-	}
+// followerIDs are the users following userID, none when they can't be loaded.
+func followerIDs(db *gorm.DB, userID uint) []uint {
+	var ids []uint
+	db.Model(&models.Follow{}).Where("followed_id = ?", userID).Pluck("follower_id", &ids)
+	return ids
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "review deleted"})
+// deleteReviewTx removes a review with its comments, votes and reactions and uncounts its rating.
+// Errors are client-facing messages.
+func deleteReviewTx(db *gorm.DB, review *models.Review) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			DELETE FROM comment_votes
+			WHERE comment_id IN (SELECT id FROM comments WHERE review_id = ?)
+		`, review.ID).Error; err != nil {
+			return errors.New("failed to delete comment votes")
+		}
+
+		if err := tx.Where("review_id = ?", review.ID).Delete(&models.ReviewReaction{}).Error; err != nil {
+			return errors.New("failed to delete reactions")
+		}
+
+		if err := tx.Where("review_id = ?", review.ID).Unscoped().Delete(&models.Comment{}).Error; err != nil {
+			return errors.New("failed to delete comments")
+		}
+
+		// the viewing stays in the diary, only the link goes
+		if err := tx.Model(&models.DiaryEntry{}).Where("review_id = ?", review.ID).
+			Update("review_id", nil).Error; err != nil {
+			return errors.New("failed to unlink diary entries")
+		}
+
+		res := tx.Unscoped().Delete(review)
+		if res.Error != nil {
+			return errors.New("failed to delete review")
+		}
+		// a concurrent delete already uncounted it
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		if err := ratings.Remove(tx, review.MovieID, review.Rating); err != nil {
+			return errors.New("failed to update movie rating")
+		}
+		return nil
+	})
 }
 
 // GET /api/users/:id/reviews
@@ -314,6 +415,10 @@ func GetReviewsByUser(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reviews"})
 		return
 	}
+	if err := withReactions(db, reviews); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reactions"})
+		return
+	}
 
 	c.JSON(http.StatusOK, reviews)
 }
@@ -341,6 +446,10 @@ func GetMyReviews(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reviews"})
 		return
 	}
+	if err := withReactions(db, reviews); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reactions"})
+		return
+	}
 
 	c.JSON(http.StatusOK, reviews)
 }
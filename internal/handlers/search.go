@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/provider"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// searchFallbackThreshold: below this many local hits the provider is asked even for page 1.
+var searchFallbackThreshold = 3
+
+// maxProviderPages is how deep OMDb lets a search go.
+const maxProviderPages = 100
+
+// maxSkippedProviderPages: a page= request may skip this many provider pages to reach
+// its hits, deeper pages have to follow next_cursor so one request can't spend the quota.
+const maxSkippedProviderPages = 2
+
+// searchField says, for one ?field= value, which document is matched,
+// which text gets highlighted and which column is matched by trigrams (typos).
+type searchField struct {
+	vector   string
+	headline string
+	fuzzy    string
+}
+
+var searchFields = map[string]searchField{
+	"all": {
+		vector:   "movies.search_vector",
+		headline: "concat_ws(' · ', movies.title, movies.director, movies.actors, movies.plot)",
+		fuzzy:    "movies.title",
+	},
+	"title":    {"to_tsvector('english', movies.title)", "movies.title", "movies.title"},
+	"director": {"to_tsvector('english', movies.director)", "movies.director", "movies.director"},
+	"actors":   {"to_tsvector('english', movies.actors)", "movies.actors", "movies.actors"},
+	"plot":     {"to_tsvector('english', movies.plot)", "movies.plot", ""},
+}
+
+type searchHit struct {
+	ID        uint    `json:"id"`
+	OMDBID    string  `json:"omdb_id"`
+	Title     string  `json:"title"`
+	Year      string  `json:"year"`
+	Poster    string  `json:"poster"`
+	Relevance float64 `json:"relevance,omitempty"`
+	Snippet   string  `json:"snippet,omitempty"`
+}
+
+// localSearch is one search over the movies table. It only sees movies with id <= maxID,
+// so movies saved from provider pages do not shift the local results between pages.
+type localSearch struct {
+	db    *gorm.DB
+	term  string
+	field searchField
+	exact bool
+	maxID uint
+}
+
+// from is the FROM/WHERE shared by count, page and overlap queries, with its args.
+func (s localSearch) from() (string, []interface{}) {
+	match := "lower(movies.title) = lower(q.raw)"
+	if !s.exact {
+		fuzzyCond := "false"
+		if s.field.fuzzy != "" {
+			fuzzyCond = "q.raw <% " + s.field.fuzzy
+		}
+		match = fmt.Sprintf("%s @@ q.tsq OR %s", s.field.vector, fuzzyCond)
+	}
+	sql := fmt.Sprintf(`
+		FROM movies, (SELECT websearch_to_tsquery('english', ?) AS tsq, ?::text AS raw) AS q
+		WHERE movies.deleted_at IS NULL AND movies.id <= ? AND (%s)`, match)
+	return sql, []interface{}{s.term, s.term, s.maxID}
+}
+
+func (s localSearch) count() (int, error) {
+	from, args := s.from()
+	var n int
+	err := s.db.Raw("SELECT COUNT(*)"+from, args...).Scan(&n).Error
+	return n, err
+}
+
+// page ranks full-text matches and fuzzy title/name matches together.
+// An exact title match always comes first.
+func (s localSearch) page(offset, limit int) ([]searchHit, error) {
+	similarity := "0"
+	if s.field.fuzzy != "" {
+		similarity = "word_similarity(q.raw, " + s.field.fuzzy + ")"
+	}
+	from, args := s.from()
+	sql := fmt.Sprintf(`
+		SELECT movies.id, movies.omdb_id, movies.title, movies.year, movies.poster,
+			ts_rank_cd(%[1]s, q.tsq) + %[2]s
+				+ CASE WHEN lower(movies.title) = lower(q.raw) THEN 1 ELSE 0 END AS relevance,
+			ts_headline('english', %[3]s, q.tsq,
+				'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet`,
+		s.field.vector, similarity, s.field.headline) + from + `
+		ORDER BY relevance DESC, movies.id
+		LIMIT ? OFFSET ?`
+
+	var hits []searchHit
+	err := s.db.Raw(sql, append(args, limit, offset)...).Scan(&hits).Error
+	return hits, err
+}
+
+// matched returns which of omdbIDs are among the local results.
+func (s localSearch) matched(omdbIDs []string) (map[string]bool, error) {
+	out := make(map[string]bool, len(omdbIDs))
+	if len(omdbIDs) == 0 {
+		return out, nil
+	}
+	from, args := s.from()
+	var found []string
+	if err := s.db.Raw("SELECT movies.omdb_id"+from+" AND movies.omdb_id IN ?", append(args, omdbIDs)...).
+		Scan(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		out[id] = true
+	}
+	return out, nil
+}
+
+// searchCursor is where the next page starts in the merged list (local hits, then
+// provider hits that are not local). It is handed out base64-encoded as next_cursor.
+type searchCursor struct {
+	Offset    int  `json:"o"` // position in the merged list
+	RemotePos int  `json:"r"` // provider hits already walked, including skipped duplicates
+	MaxID     uint `json:"m"` // local snapshot, see localSearch
+	Total     int  `json:"t"` // merged total, 0 until the provider has been asked
+}
+
+func (cur searchCursor) encode() string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSearchCursor(s string) (searchCursor, error) {
+	var cur searchCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &cur)
+	}
+	if err != nil || cur.Offset < 0 || cur.RemotePos < 0 {
+		return cur, errors.New("invalid cursor")
+	}
+	return cur, nil
+}
+
+// remoteWalk is what walkProvider found.
+type remoteWalk struct {
+	hits      []searchHit
+	pos       int
+	total     int // provider total, -1 when the provider was not reached
+	overlap   int // hits on the fetched provider pages that were local results
+	exhausted bool
+}
+
+// walkProvider collects need provider hits from raw position pos on, leaving out movies the
+// local search already listed. The first skip remaining hits are passed over (page= without cursor).
+func walkProvider(db *gorm.DB, local localSearch, title string, pos, skip, need int) (*remoteWalk, error) {
+	walk := &remoteWalk{pos: pos, total: -1}
+	for {
+		page := walk.pos/provider.PageSize + 1
+		if page > maxProviderPages {
+			walk.exhausted = true
+			return walk, nil
+		}
+		found, err := movieProvider.Search(title, page)
+		if err == provider.ErrNotFound {
+			if walk.total < 0 {
+				walk.total = 0
+			}
+			walk.exhausted = true
+			return walk, nil
+		}
+		if err != nil {
+			return walk, err
+		}
+		walk.total = found.Total
+
+		ids := make([]string, 0, len(found.Items))
+		for _, m := range found.Items {
+			ids = append(ids, m.IMDbID)
+		}
+		matched, err := local.matched(ids)
+		if err != nil {
+			return walk, err
+		}
+		walk.overlap += len(matched)
+
+		for i := walk.pos % provider.PageSize; i < len(found.Items) && need > 0; i++ {
+			walk.pos++
+			m := found.Items[i]
+			if matched[m.IMDbID] {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			newMovie := models.Movie{
+				Title:  m.Title,
+				Year:   m.Year,
+				OMDBID: m.IMDbID,
+				Poster: m.Poster,
+			}
+			db.FirstOrCreate(&newMovie, models.Movie{OMDBID: newMovie.OMDBID})
+
+			walk.hits = append(walk.hits, searchHit{
+				ID:     newMovie.ID,
+				OMDBID: newMovie.OMDBID,
+				Title:  newMovie.Title,
+				Year:   newMovie.Year,
+				Poster: newMovie.Poster,
+			})
+			need--
+		}
+
+		pageEnd := (page-1)*provider.PageSize + len(found.Items)
+		if walk.pos >= found.Total || (len(found.Items) < provider.PageSize && walk.pos >= pageEnd) {
+			walk.exhausted = true
+		}
+		if walk.exhausted || need == 0 {
+			return walk, nil
+		}
+	}
+}
+
+// GET /api/movies/search?title=...&field=all|title|director|actors|plot&exact=true&page=1&limit=20
+// or &cursor=<next_cursor> instead of page. Local hits come first, then provider hits
+// that are not already listed; the provider only searches titles.
+func SearchAndSaveMovie(c *gin.Context, db *gorm.DB) {
+	title := strings.TrimSpace(c.Query("title"))
+	if title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title required"})
+		return
+	}
+
+	fieldName := c.DefaultQuery("field", "all")
+	field, ok := searchFields[fieldName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "field must be one of all, title, director, actors, plot"})
+		return
+	}
+	useProvider := fieldName == "all" || fieldName == "title"
+
+	page, limit := pageParams(c, 20, 100)
+	skip := 0
+	var cur searchCursor
+	if raw := c.Query("cursor"); raw != "" {
+		var err error
+		if cur, err = decodeSearchCursor(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		cur.Offset = (page - 1) * limit
+		if err := db.Model(&models.Movie{}).Select("COALESCE(MAX(id), 0)").Scan(&cur.MaxID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+	}
+
+	local := localSearch{db: db, term: title, field: field, exact: c.Query("exact") == "true", maxID: cur.MaxID}
+	localTotal, err := local.count()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+		return
+	}
+
+	results := []searchHit{}
+	if cur.Offset < localTotal {
+		if results, err = local.page(cur.Offset, limit); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+	}
+	if cur.RemotePos == 0 && cur.Offset > localTotal {
+		// page= past the local hits: skip the provider hits of the earlier pages
+		skip = cur.Offset - localTotal
+		if useProvider && skip >= maxSkippedProviderPages*provider.PageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page is too deep, follow next_cursor instead"})
+			return
+		}
+	}
+
+	fromLocal := len(results)
+	total := cur.Total
+	if total == 0 {
+		total = localTotal
+	}
+	more := cur.Offset+fromLocal < localTotal
+
+	// the provider fills the page once local hits run out; with few local hits it is asked up front
+	if useProvider && (fromLocal < limit || localTotal < searchFallbackThreshold) {
+		walk, err := walkProvider(db, local, title, cur.RemotePos, skip, limit-fromLocal)
+		if err != nil && len(results) == 0 && len(walk.hits) == 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch movies from provider"})
+			return
+		}
+		results = append(results, walk.hits...)
+		cur.RemotePos = walk.pos
+
+		if cur.Total == 0 && walk.total >= 0 {
+			cur.Total = localTotal + walk.total - walk.overlap
+		}
+		if cur.Total > 0 {
+			total = cur.Total
+		}
+		more = more || (err == nil && !walk.exhausted)
+		if !more {
+			// end of the list, the exact count is known now
+			total = cur.Offset + len(results)
+		}
+	} else if useProvider && !more {
+		// local hits end exactly here, the provider may still have more
+		more = true
+	}
+
+	source := "database"
+	switch {
+	case fromLocal == 0 && len(results) > 0:
+		source = movieProvider.Name()
+	case len(results) > fromLocal:
+		source = "database+" + movieProvider.Name()
+	}
+
+	for i := range results {
+		results[i].Poster = posterURL(results[i].ID)
+	}
+
+	nextCursor := ""
+	if more {
+		cur.Offset += len(results)
+		nextCursor = cur.encode()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Search":      results,
+		"source":      source,
+		"total":       total,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
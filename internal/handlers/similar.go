@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/similar"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SimilarMovie is a neighbour with the reasons it was picked.
+type SimilarMovie struct {
+	MovieSummary
+	Score           float64 `json:"score"`
+	SharedGenres    int     `json:"shared_genres"`
+	SharedDirectors int     `json:"shared_directors"`
+	SharedCast      int     `json:"shared_cast"`
+	CoPlaylists     int     `json:"co_playlists"`
+	CoLikes         int     `json:"co_likes"`
+}
+
+func loadSimilar(db *gorm.DB, movieID uint, limit int) ([]SimilarMovie, time.Time, error) {
+	type row struct {
+		SimilarMovie
+		ComputedAt time.Time
+	}
+	var rows []row
+	err := db.Table("movie_similarities").
+		Select(`movies.id, movies.omdb_id, movies.title, movies.year, movies.poster, movies.genre,
+			movies.rating, movies.votes, movies.avg_rating,
+			movie_similarities.score, movie_similarities.shared_genres, movie_similarities.shared_directors,
+			movie_similarities.shared_cast, movie_similarities.co_playlists, movie_similarities.co_likes,
+			movie_similarities.computed_at`).
+		Joins("JOIN movies ON movies.id = movie_similarities.similar_id AND movies.deleted_at IS NULL").
+		Where("movie_similarities.movie_id = ?", movieID).
+		Order("movie_similarities.score DESC, movies.id").
+		Limit(limit).
+		Scan(&rows).Error
+
+	out := make([]SimilarMovie, 0, len(rows))
+	var computedAt time.Time
+	for _, r := range rows {
+		r.Poster = posterURL(r.ID)
+		out = append(out, r.SimilarMovie)
+		computedAt = r.ComputedAt
+	}
+	return out, computedAt, err
+}
+
+// GET /api/movies/:id/similar?limit=10
+// precomputed by internal/similar; a movie the job has not reached yet is computed on the spot,
+// once: one with no neighbours waits for the next rebuild
+func GetSimilarMovies(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid movie id"})
+		return
+	}
+	_, limit := pageParams(c, 10, 50)
+
+	var movie models.Movie
+	if err := db.First(&movie, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "movie not found"})
+		return
+	}
+
+	movies, computedAt, err := loadSimilar(db, movie.ID, limit)
+	if err == nil && len(movies) == 0 && movie.SimilarComputedAt == nil {
+		// new since the last rebuild
+		if err = similar.Compute(db, []uint{movie.ID}, similar.DefaultConfig()); err == nil {
+			movies, computedAt, err = loadSimilar(db, movie.ID, limit)
+		}
+	} else if err == nil && len(movies) == 0 {
+		computedAt = *movie.SimilarComputedAt
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load similar movies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"movie_id":    movie.ID,
+		"similar":     movies,
+		"computed_at": computedAt,
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// isSubscribed: userID follows the playlist.
+func isSubscribed(db *gorm.DB, playlistID, userID uint) bool {
+	var n int64
+	db.Model(&models.PlaylistSubscription{}).
+		Where("playlist_id = ? AND user_id = ?", playlistID, userID).
+		Count(&n)
+	return n > 0
+}
+
+// notifySubscribers tells the playlist's subscribers that movies were added, in one message.
+// Members are left to notifyPlaylist, and nobody hears about a playlist that has since gone private.
+func notifySubscribers(db *gorm.DB, hub *ws.Hub, p *models.Playlist, actorID uint, movies []models.Movie) {
+	if hub == nil || len(movies) == 0 || p.Visibility == models.VisibilityPrivate {
+		return
+	}
+	var subscribers []uint
+	db.Model(&models.PlaylistSubscription{}).
+		Where("playlist_id = ? AND user_id <> ? AND user_id <> ?", p.ID, actorID, p.OwnerID).
+		Where("user_id NOT IN (?)", db.Model(&models.PlaylistCollaborator{}).
+			Select("user_id").Where("playlist_id = ? AND accepted_at IS NOT NULL", p.ID)).
+		Pluck("user_id", &subscribers)
+	if len(subscribers) == 0 {
+		return
+	}
+
+	var actor models.User
+	db.Select("id", "name").First(&actor, actorID)
+	added := make([]gin.H, len(movies))
+	for i, m := range movies {
+		added[i] = gin.H{"id": m.ID, "title": m.Title}
+	}
+	name := playlistNameIn("en", p)
+	text := fmt.Sprintf("%s added \"%s\" to \"%s\"", actor.Name, movies[0].Title, name)
+	if len(movies) > 1 {
+		text = fmt.Sprintf("%s added %d movies to \"%s\"", actor.Name, len(movies), name)
+	}
+	hub.SendToMany(subscribers, map[string]interface{}{
+		"type":          "playlist_movie_added",
+		"playlist_id":   p.ID,
+		"playlist_name": name,
+		"playlist_kind": p.Kind,
+		"movies":        added,
+		"user_id":       actorID,
+		"user_name":     actor.Name,
+		"text":          text,
+	})
+}
+
+// POST /api/playlists/:id/subscribe?token=  anyone who can see the playlist but its owner
+func SubscribePlaylist(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+
+	var playlist models.Playlist
+	if err := db.First(&playlist, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+	if playlist.OwnerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you can't subscribe to your own playlist"})
+		return
+	}
+	if !canViewPlaylist(&playlist, userID, c.Query("token")) && collaboratorRole(db, playlist.ID, userID) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return
+	}
+
+	sub := models.PlaylistSubscription{PlaylistID: playlist.ID, UserID: userID}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to subscribe"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "subscribed", "playlist_id": playlist.ID})
+}
+
+// DELETE /api/playlists/:id/subscribe
+func UnsubscribePlaylist(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := db.Where("playlist_id = ? AND user_id = ?", c.Param("id"), uid.(uint)).
+		Delete(&models.PlaylistSubscription{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unsubscribe"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "unsubscribed"})
+}
+
+// GET /api/users/me/subscriptions  playlists the user follows that they can still see
+func GetMySubscriptions(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	type subscription struct {
+		PlaylistID   uint      `json:"playlist_id"`
+		PlaylistName string    `json:"playlist_name"`
+		PlaylistKind string    `json:"playlist_kind"`
+		DisplayName  string    `json:"display_name" gorm:"-"`
+		Cover        string    `json:"cover"`
+		OwnerID      uint      `json:"owner_id"`
+		OwnerName    string    `json:"owner_name"`
+		CreatedAt    time.Time `json:"subscribed_at"`
+	}
+	var subs []subscription
+	if err := db.Table("playlist_subscriptions").
+		Select(`playlist_subscriptions.playlist_id, playlists.name AS playlist_name, playlists.kind AS playlist_kind, playlists.cover,
+			playlists.owner_id, users.name AS owner_name, playlist_subscriptions.created_at`).
+		Joins("JOIN playlists ON playlists.id = playlist_subscriptions.playlist_id AND playlists.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = playlists.owner_id").
+		Where("playlist_subscriptions.user_id = ? AND playlists.visibility <> ?", uid.(uint), models.VisibilityPrivate).
+		Order("playlist_subscriptions.created_at DESC").
+		Scan(&subs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load subscriptions"})
+		return
+	}
+	for i := range subs {
+		p := models.Playlist{Name: subs[i].PlaylistName, Kind: subs[i].PlaylistKind, Cover: subs[i].Cover}
+		subs[i].DisplayName = playlistName(c, &p)
+		subs[i].Cover = playlistCover(&p)
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/provider"
+	"totallyguysproject/internal/recommend"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/transfer"
+	"totallyguysproject/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// importLookup fetches films the catalog lacks from the movie provider and saves them.
+func importLookup(db *gorm.DB) transfer.Lookup {
+	return func(imdbID, title, year string) (*models.Movie, error) {
+		var details *provider.MovieDetails
+		var err error
+		if imdbID != "" {
+			details, err = movieProvider.ByID(imdbID)
+		} else {
+			details, err = movieProvider.ByTitle(title, year)
+		}
+		if err == provider.ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		movie := movieFromDetails(details)
+		if err := db.Where("omdb_id = ?", movie.OMDBID).FirstOrCreate(&movie).Error; err != nil {
+			return nil, err
+		}
+		return &movie, nil
+	}
+}
+
+// readUpload reads the multipart "file" field, bounded by transfer.MaxFileBytes.
+func readUpload(c *gin.Context) ([]byte, string, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file not provided"})
+		return nil, "", false
+	}
+	if file.Size > transfer.MaxFileBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large"})
+		return nil, "", false
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return nil, "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, transfer.MaxFileBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+		return nil, "", false
+	}
+	return data, file.Filename, true
+}
+
+// notifyImported tells the subscribers of the user's playlists which movies an import
+// added to them: the entries added since started, in database time.
+func notifyImported(db *gorm.DB, hub *ws.Hub, userID uint, started time.Time) {
+	var rows []struct {
+		PlaylistID uint
+		MovieID    uint
+		Title      string
+	}
+	db.Table("playlist_movies").
+		Select("playlist_movies.playlist_id, movies.id AS movie_id, movies.title").
+		Joins("JOIN movies ON movies.id = playlist_movies.movie_id").
+		Joins("JOIN playlists ON playlists.id = playlist_movies.playlist_id").
+		Where("playlists.owner_id = ? AND playlists.visibility <> ? AND playlist_movies.added_at >= ?",
+			userID, models.VisibilityPrivate, started).
+		Order("playlist_movies.playlist_id, playlist_movies.added_at, movies.id").
+		Scan(&rows)
+
+	added := map[uint][]models.Movie{}
+	var playlistIDs []uint
+	for _, r := range rows {
+		if len(added[r.PlaylistID]) == 0 {
+			playlistIDs = append(playlistIDs, r.PlaylistID)
+		}
+		movie := models.Movie{Title: r.Title}
+		movie.ID = r.MovieID
+		added[r.PlaylistID] = append(added[r.PlaylistID], movie)
+	}
+	if len(playlistIDs) == 0 {
+		return
+	}
+	var playlists []models.Playlist
+	db.Find(&playlists, playlistIDs)
+	for i := range playlists {
+		notifySubscribers(db, hub, &playlists[i], userID, added[playlists[i].ID])
+	}
+}
+
+// runImport writes rows for the user and saves the job with its report. It runs in the
+// request: films the catalog lacks are looked up at the provider, at most
+// transfer.Importer.MaxLookups of them.
+func runImport(c *gin.Context, db *gorm.DB, hub *ws.Hub, userID uint, source, filename string, rows []transfer.Row) {
+	var started time.Time
+	if hub != nil {
+		db.Raw("SELECT now()").Row().Scan(&started)
+	}
+	job := models.ImportJob{UserID: userID, Source: source, Filename: filename}
+	importer := transfer.NewImporter(db, userID, importLookup(db))
+	if err := importer.Apply(rows, &job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "import failed"})
+		return
+	}
+	if err := db.Create(&job).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save import"})
+		return
+	}
+	if hub != nil && !started.IsZero() {
+		notifyImported(db, hub, userID, started)
+	}
+	for _, movieID := range importer.MovieIDs() {
+		recommend.Enqueue(movieID, userID)
+	}
+	smart.Enqueue(userID)
+	c.JSON(http.StatusCreated, job)
+}
+
+// POST /api/users/me/import/letterboxd  multipart "file": the export ZIP
+func ImportLetterboxd(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	data, filename, ok := readUpload(c)
+	if !ok {
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not a zip file"})
+		return
+	}
+	rows, err := transfer.ParseLetterboxd(zr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	runImport(c, db, hub, uid.(uint), transfer.SourceLetterboxd, filename, rows)
+}
+
+// POST /api/users/me/import/imdb  multipart "file": ratings or list CSV, "list": target playlist
+// for list exports (default: watch-later)
+func ImportIMDb(c *gin.Context, db *gorm.DB, hub *ws.Hub) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	data, filename, ok := readUpload(c)
+	if !ok {
+		return
+	}
+	rows, err := transfer.ParseIMDb(bytes.NewReader(data), filename, c.PostForm("list"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	runImport(c, db, hub, uid.(uint), transfer.SourceIMDb, filename, rows)
+}
+
+// GET /api/users/me/imports
+func GetMyImports(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var jobs []models.ImportJob
+	if err := db.Omit("unmatched").Where("user_id = ?", uid.(uint)).Order("id DESC").Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load imports"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GET /api/users/me/imports/:import_id/report  CSV of the rows that matched nothing
+func GetImportReport(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("import_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import id"})
+		return
+	}
+	var job models.ImportJob
+	if err := db.Where("id = ? AND user_id = ?", id, uid.(uint)).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-unmatched.csv"`, job.ID))
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"file", "line", "kind", "title", "year", "imdb_id", "reason"})
+	for _, r := range job.Unmatched {
+		w.Write([]string{r.File, strconv.Itoa(r.Line), r.Kind, r.Title, r.Year, r.IMDbID, r.Reason})
+	}
+	w.Flush()
+}
+
+// GET /api/users/me/export?format=letterboxd|imdb
+// letterboxd (default) is a ZIP that the Letterboxd import reads back; imdb is a ratings CSV
+func ExportMyData(c *gin.Context, db *gorm.DB) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userID := uid.(uint)
+	stamp := time.Now().Format("2006-01-02")
+
+	var buf bytes.Buffer
+	var err error
+	var contentType, filename string
+	switch c.DefaultQuery("format", transfer.SourceLetterboxd) {
+	case transfer.SourceLetterboxd:
+		err = transfer.ExportLetterboxd(db, userID, &buf)
+		contentType, filename = "application/zip", fmt.Sprintf("letterboxd-%s.zip", stamp)
+	case transfer.SourceIMDb:
+		err = transfer.ExportIMDb(db, userID, &buf)
+		contentType, filename = "text/csv; charset=utf-8", fmt.Sprintf("ratings-%s.csv", stamp)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be letterboxd or imdb"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "export failed"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/trending"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TrendingMovie is a snapshot entry with the activity behind it.
+type TrendingMovie struct {
+	MovieSummary
+	Rank      int     `json:"rank"`
+	Score     float64 `json:"score"`
+	Reviews   int     `json:"reviews"`
+	Likes     int     `json:"likes"`
+	Additions int     `json:"additions"`
+	Comments  int     `json:"comments"`
+}
+
+func loadTrending(db *gorm.DB, window string, offset, limit int) ([]TrendingMovie, int64, time.Time, error) {
+	type row struct {
+		TrendingMovie
+		ComputedAt time.Time
+	}
+	query := db.Table("trending_scores").
+		Joins("JOIN movies ON movies.id = trending_scores.movie_id AND movies.deleted_at IS NULL").
+		Where("trending_scores.time_window = ?", window)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	var rows []row
+	err := query.
+		Select(`movies.id, movies.omdb_id, movies.title, movies.year, movies.poster, movies.genre,
+			movies.rating, movies.votes, movies.avg_rating,
+			trending_scores.rank, trending_scores.score, trending_scores.reviews, trending_scores.likes,
+			trending_scores.additions, trending_scores.comments, trending_scores.computed_at`).
+		Order("trending_scores.rank").
+		Offset(offset).Limit(limit).
+		Scan(&rows).Error
+
+	out := make([]TrendingMovie, 0, len(rows))
+	var computedAt time.Time
+	for _, r := range rows {
+		r.Poster = posterURL(r.ID)
+		out = append(out, r.TrendingMovie)
+		computedAt = r.ComputedAt
+	}
+	return out, total, computedAt, err
+}
+
+// GET /api/movies/trending?window=day|week|month&page=1&limit=20
+// served from the snapshot internal/trending refreshes; a window never refreshed is refreshed
+// on the spot, a quiet one stays empty until the next refresh
+func GetTrendingMovies(c *gin.Context, db *gorm.DB) {
+	window := c.DefaultQuery("window", models.WindowWeek)
+	cfg := trending.DefaultConfig()
+	if _, ok := cfg.Windows[window]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be one of day, week, month"})
+		return
+	}
+	page, limit := pageParams(c, 20, 100)
+
+	movies, total, computedAt, err := loadTrending(db, window, (page-1)*limit, limit)
+	if err == nil && total == 0 {
+		var snapshot models.TrendingSnapshot
+		if err = db.Where("time_window = ?", window).Limit(1).Find(&snapshot).Error; err == nil {
+			if snapshot.Window != "" {
+				computedAt = snapshot.ComputedAt
+			} else if _, err = trending.Refresh(db, window, cfg); err == nil {
+				movies, total, computedAt, err = loadTrending(db, window, (page-1)*limit, limit)
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load trending movies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":      window,
+		"movies":      movies,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"computed_at": computedAt,
+	})
+}
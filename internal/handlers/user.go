@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ratings"
 	"totallyguysproject/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -97,21 +98,13 @@ func GetCurrentUser(c *gin.Context, db *gorm.DB) {
 	// user playlists for frontend
 	collections := []map[string]interface{}{}
 	for _, p := range user.Playlists {
-		var cover string
-		switch p.Name {
-		case "watched":
-			cover = "/src/watched-playlist.jpg"
-		case "watch-later":
-			cover = "/src/watch-later-playlist.jpg"
-		case "liked":
-			cover = "/src/liked-playlist.jpg"
-		default:
-			cover = p.Cover
-		}
 		collections = append(collections, map[string]interface{}{
-			"id":    p.ID,
-			"name":  p.Name,
-			"cover": cover,
+			"id":           p.ID,
+			"name":         p.Name,
+			"kind":         p.Kind,
+			"display_name": playlistName(c, &p),
+			"cover":        playlistCover(&p),
+			"visibility":   p.Visibility,
 		})
 	}
 	// user friends for frontend
@@ -154,6 +147,8 @@ func GetCurrentUser(c *gin.Context, db *gorm.DB) {
 		"avatar":      user.Avatar,
 		"description": user.Description,
 		"collections": collections,
+
+		"default_visibility": user.DefaultVisibility,
 		//"friends":      friends,
 		"following": followingIDs,
 		"followers": followerIDs,
@@ -178,13 +173,18 @@ type SearchUsersResponse struct {
 func UpdateCurrentUser(c *gin.Context, db *gorm.DB) {
 	uid, _ := c.Get("userID")
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name              string `json:"name"`
+		Description       string `json:"description"`
+		DefaultVisibility string `json:"default_visibility"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	if req.DefaultVisibility != "" && !validVisibility(req.DefaultVisibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "default_visibility must be public, unlisted or private"})
+		return
+	}
 
 	var user models.User
 	if err := db.First(&user, uid.(uint)).Error; err != nil {
@@ -198,6 +198,9 @@ func UpdateCurrentUser(c *gin.Context, db *gorm.DB) {
 	if req.Description != "" {
 		user.Description = req.Description
 	}
+	if req.DefaultVisibility != "" {
+		user.DefaultVisibility = req.DefaultVisibility
+	}
 
 	db.Save(&user)
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
@@ -222,23 +225,19 @@ func GetProfile(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	viewer := viewerID(c)
 	playlists := []map[string]interface{}{}
 	for _, p := range user.Playlists {
-		var cover string
-		switch p.Name {
-		case "watched":
-			cover = "/src/watched-playlist.jpg"
-		case "watch-later":
-			cover = "/src/watch-later-playlist.jpg"
-		case "liked":
-			cover = "/src/liked-playlist.jpg"
-		default:
-			cover = p.Cover
+		if !listedFor(&p, viewer) {
+			continue
 		}
 		playlists = append(playlists, map[string]interface{}{
-			"id":    p.ID,
-			"name":  p.Name,
-			"cover": cover,
+			"id":           p.ID,
+			"name":         p.Name,
+			"kind":         p.Kind,
+			"display_name": playlistName(c, &p),
+			"cover":        playlistCover(&p),
+			"visibility":   p.Visibility,
 		})
 	}
 
@@ -478,7 +477,7 @@ func UploadPlaylistCover(c *gin.Context, db *gorm.DB) {
 		return
 	}
 	// Запретить изменение обложки для базовых плейлистов
-	if playlist.Name == "watched" || playlist.Name == "watch-later" || playlist.Name == "liked" {
+	if isSystemPlaylist(&playlist) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя менять обложку базового плейлиста"})
 		return
 	}
@@ -572,7 +571,7 @@ func DeletePlaylistCover(c *gin.Context, db *gorm.DB) {
 		return
 	}
 	// Запретить удаление обложки для базовых плейлистов
-	if playlist.Name == "watched" || playlist.Name == "watch-later" || playlist.Name == "liked" {
+	if isSystemPlaylist(&playlist) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя менять обложку базового плейлиста"})
 		return
 	}
@@ -645,21 +644,8 @@ func CreateUser(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	defaultPlaylists := []struct {
-		Name  string
-		Cover string
-	}{
-		{"watch-later", "/src/watch-later-playlist.jpg"},
-		{"watched", "/src/watched-playlist.jpg"},
-		{"liked", "/src/liked-playlist.jpg"},
-	}
-
-	for _, p := range defaultPlaylists {
-		db.Create(&models.Playlist{
-			Name:    p.Name,
-			OwnerID: user.ID,
-			Cover:   p.Cover,
-		})
+	if err := createSystemPlaylists(db, user.ID); err != nil {
+		fmt.Println("failed to create default playlists:", err)
 	}
 
 	c.JSON(http.StatusCreated, user)
@@ -680,13 +666,47 @@ func DeleteUser(c *gin.Context, db *gorm.DB) {
 
 	// Delete related data: playlists, reviews, follows, comments
 	// Use Unscoped to permanently delete if using soft deletes
-	db.Unscoped().Where("owner_id = ?", user.ID).Delete(&models.Playlist{})
-	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Review{})
-	db.Unscoped().Where("follower_id = ? OR followed_id = ?", user.ID, user.ID).Delete(&models.Follow{})
-	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Comment{})
-	db.Unscoped().Where("user_id = ?", user.ID).Delete(&models.CommentVote{})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		ownPlaylists := tx.Model(&models.Playlist{}).Select("id").Where("owner_id = ?", user.ID)
+		ownReviews := tx.Model(&models.Review{}).Select("id").Where("user_id = ?", user.ID)
+
+		// the movies whose rating columns count the user's reviews
+		var reviewedMovies []uint
+		if err := tx.Model(&models.Review{}).Where("user_id = ?", user.ID).
+			Distinct().Pluck("movie_id", &reviewedMovies).Error; err != nil {
+			return err
+		}
 
-	if err := db.Unscoped().Delete(&user).Error; err != nil {
+		deletes := []struct {
+			query *gorm.DB
+			model interface{}
+		}{
+			{tx.Where("user_id = ? OR playlist_id IN (?)", user.ID, ownPlaylists), &models.PlaylistCollaborator{}},
+			{tx.Where("user_id = ? OR playlist_id IN (?)", user.ID, ownPlaylists), &models.PlaylistSubscription{}},
+			{tx.Where("playlist_id IN (?)", ownPlaylists), &models.PlaylistMovie{}},
+			{tx.Where("playlist_id IN (?)", ownPlaylists), &models.SmartPlaylistMovie{}},
+			{tx.Unscoped().Where("owner_id = ?", user.ID), &models.Playlist{}},
+			{tx.Where("user_id = ? OR review_id IN (?)", user.ID, ownReviews), &models.ReviewReaction{}},
+			{tx.Unscoped().Where("user_id = ?", user.ID), &models.DiaryEntry{}},
+			{tx.Unscoped().Where("user_id = ?", user.ID), &models.Review{}},
+			{tx.Unscoped().Where("follower_id = ? OR followed_id = ?", user.ID, user.ID), &models.Follow{}},
+			{tx.Unscoped().Where("user_id = ?", user.ID), &models.Comment{}},
+			{tx.Unscoped().Where("user_id = ?", user.ID), &models.CommentVote{}},
+			{tx.Unscoped().Where("user_id = ?", user.ID), &models.ImportJob{}},
+		}
+		for _, d := range deletes {
+			if err := d.query.Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+		if len(reviewedMovies) > 0 {
+			if _, err := ratings.Recompute(tx, reviewedMovies); err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
 		return
 	}
@@ -722,17 +742,48 @@ func GetMyPlaylists(c *gin.Context, db *gorm.DB) {
 	resp := []map[string]interface{}{}
 	for _, p := range playlists {
 		resp = append(resp, map[string]interface{}{
-			"id":    p.ID,
-			"name":  p.Name,
-			"cover": p.Cover,
+			"id":           p.ID,
+			"name":         p.Name,
+			"kind":         p.Kind,
+			"display_name": playlistName(c, &p),
+			"cover":        playlistCover(&p),
+			"visibility":   p.Visibility,
+			"smart":        p.Rules != nil,
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{"playlists": resp})
+	// playlists shared with the user
+	type shared struct {
+		ID          uint   `json:"id"`
+		Name        string `json:"name"`
+		Kind        string `json:"kind"`
+		DisplayName string `json:"display_name" gorm:"-"`
+		Cover       string `json:"cover"`
+		OwnerID     uint   `json:"owner_id"`
+		Role        string `json:"role"`
+	}
+	sharedWith := []shared{}
+	if err := db.Table("playlists").
+		Select("playlists.id, playlists.name, playlists.kind, playlists.cover, playlists.owner_id, playlist_collaborators.role").
+		Joins("JOIN playlist_collaborators ON playlist_collaborators.playlist_id = playlists.id").
+		Where("playlist_collaborators.user_id = ? AND playlist_collaborators.accepted_at IS NOT NULL", uid.(uint)).
+		Where("playlists.deleted_at IS NULL").
+		Order("playlists.id").
+		Scan(&sharedWith).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch playlists"})
+		return
+	}
+	for i := range sharedWith {
+		p := models.Playlist{Name: sharedWith[i].Name, Kind: sharedWith[i].Kind, Cover: sharedWith[i].Cover}
+		sharedWith[i].DisplayName = playlistName(c, &p)
+		sharedWith[i].Cover = playlistCover(&p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"playlists": resp, "shared": sharedWith})
 }
 
 // @Summary Get user playlists
-// @Description  GET api/users/:id/playlists
+// @Description  GET api/users/:id/playlists, public ones only unless they are the caller's
 // @Tags playlists
 // @Accept json
 // @Produce json
@@ -743,8 +794,12 @@ func GetMyPlaylists(c *gin.Context, db *gorm.DB) {
 func GetUserPlaylists(c *gin.Context, db *gorm.DB) {
 	userID := c.Param("id")
 
+	query := db.Where("owner_id = ?", userID)
+	if viewer := viewerID(c); viewer == 0 || userID != strconv.FormatUint(uint64(viewer), 10) {
+		query = query.Where("visibility = ?", models.VisibilityPublic)
+	}
 	var playlists []models.Playlist
-	if err := db.Where("owner_id = ?", userID).Find(&playlists).Error; err != nil {
+	if err := query.Find(&playlists).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch playlists"})
 		return
 	}
@@ -752,9 +807,13 @@ func GetUserPlaylists(c *gin.Context, db *gorm.DB) {
 	resp := []map[string]interface{}{}
 	for _, p := range playlists {
 		resp = append(resp, map[string]interface{}{
-			"id":    p.ID,
-			"name":  p.Name,
-			"cover": p.Cover,
+			"id":           p.ID,
+			"name":         p.Name,
+			"kind":         p.Kind,
+			"display_name": playlistName(c, &p),
+			"cover":        playlistCover(&p),
+			"visibility":   p.Visibility,
+			"smart":        p.Rules != nil,
 		})
 	}
 
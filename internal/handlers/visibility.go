@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"totallyguysproject/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func validVisibility(v string) bool {
+	switch v {
+	case models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// viewerID is the signed-in user, 0 for guests (AuthMiddleware(true) or no middleware at all).
+func viewerID(c *gin.Context) uint {
+	if uid, ok := c.Get("userID"); ok {
+		if id, ok := uid.(uint); ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// canViewPlaylist: the owner sees everything, anyone a public playlist,
+// and an unlisted one whoever has its share token.
+func canViewPlaylist(p *models.Playlist, viewer uint, token string) bool {
+	if viewer != 0 && p.OwnerID == viewer {
+		return true
+	}
+	switch p.Visibility {
+	case models.VisibilityPublic, "":
+		return true
+	case models.VisibilityUnlisted:
+		return token != "" && p.ShareToken != nil &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(*p.ShareToken)) == 1
+	}
+	return false
+}
+
+// listedFor says whether p shows up in its owner's playlist lists (profile, /users/:id/playlists)
+// for viewer: all of them for the owner, public ones for everybody else.
+func listedFor(p *models.Playlist, viewer uint) bool {
+	if viewer != 0 && p.OwnerID == viewer {
+		return true
+	}
+	return p.Visibility == models.VisibilityPublic || p.Visibility == ""
+}
+
+// newShareToken is 192 random bits, URL-safe.
+func newShareToken() (*string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return &token, nil
+}
+
+// defaultVisibility is the user's setting for new playlists.
+func defaultVisibility(db *gorm.DB, userID uint) string {
+	var visibility string
+	db.Model(&models.User{}).Where("id = ?", userID).Pluck("default_visibility", &visibility)
+	if !validVisibility(visibility) {
+		return models.VisibilityPublic
+	}
+	return visibility
+}
+
+// loadOwnPlaylist loads the :id playlist for its owner, writing the error response otherwise.
+func loadOwnPlaylist(c *gin.Context, db *gorm.DB) (*models.Playlist, bool) {
+	uid, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid playlist id"})
+		return nil, false
+	}
+	var playlist models.Playlist
+	if err := db.First(&playlist, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "playlist not found"})
+		return nil, false
+	}
+	if playlist.OwnerID != uid.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not your playlist"})
+		return nil, false
+	}
+	return &playlist, true
+}
+
+func shareTokenValue(p *models.Playlist) string {
+	if p.ShareToken == nil {
+		return ""
+	}
+	return *p.ShareToken
+}
+
+// PUT /api/playlists/:id/visibility  {"visibility": "public"|"unlisted"|"private"}
+// making a playlist unlisted gives it a share token; GET /api/playlists/:id?token=... opens it
+func SetPlaylistVisibility(c *gin.Context, db *gorm.DB) {
+	playlist, ok := loadOwnPlaylist(c, db)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, unlisted or private"})
+		return
+	}
+
+	updates := map[string]interface{}{"visibility": req.Visibility}
+	if req.Visibility == models.VisibilityUnlisted && playlist.ShareToken == nil {
+		token, err := newShareToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share token"})
+			return
+		}
+		updates["share_token"] = *token
+		playlist.ShareToken = token
+	}
+	if err := db.Model(playlist).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update visibility"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          playlist.ID,
+		"visibility":  req.Visibility,
+		"share_token": shareTokenValue(playlist),
+	})
+}
+
+// POST /api/playlists/:id/share-token  replaces the token, old links stop working and the
+// subscriptions of an unlisted playlist go with them (members keep theirs)
+func RotatePlaylistShareToken(c *gin.Context, db *gorm.DB) {
+	playlist, ok := loadOwnPlaylist(c, db)
+	if !ok {
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share token"})
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(playlist).Update("share_token", *token).Error; err != nil {
+			return err
+		}
+		if playlist.Visibility != models.VisibilityUnlisted {
+			return nil
+		}
+		return tx.Where("playlist_id = ?", playlist.ID).
+			Where("user_id NOT IN (?)", tx.Model(&models.PlaylistCollaborator{}).
+				Select("user_id").Where("playlist_id = ? AND accepted_at IS NOT NULL", playlist.ID)).
+			Delete(&models.PlaylistSubscription{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update share token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          playlist.ID,
+		"visibility":  playlist.Visibility,
+		"share_token": *token,
+	})
+}
@@ -1,46 +1,270 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Name             string     `json:"name"`
-	Email            string     `json:"email" gorm:"uniqueIndex"`
-	Password         string     `json:"password"`
-	Role             string     `json:"role"` // guest(no token)/user/admin
-	Verified         bool       `json:"verified"`
-	VerificationCode string     `json:"verification_code"`
-	Avatar           string     `json:"avatar"`
-	Description      string     `json:"description"`
-	Playlists        []Playlist `gorm:"foreignKey:OwnerID"` // FK
+	Name              string     `json:"name"`
+	Email             string     `json:"email" gorm:"uniqueIndex"`
+	Password          string     `json:"password"`
+	Role              string     `json:"role"` // guest(no token)/user/admin
+	Verified          bool       `json:"verified"`
+	VerificationCode  string     `json:"verification_code"`
+	Avatar            string     `json:"avatar"`
+	Description       string     `json:"description"`
+	DefaultVisibility string     `json:"default_visibility" gorm:"default:public"` // of new playlists
+	Playlists         []Playlist `gorm:"foreignKey:OwnerID"`                       // FK
 	//Friends          []*User    `gorm:"many2many:user_friends;joinForeignKey:UserID;joinReferences:FriendID"`
 	Reviews   []Review `gorm:"foreignKey:UserID"`
 	Followers []Follow `gorm:"foreignKey:FollowedID"`
 	Following []Follow `gorm:"foreignKey:FollowerID"`
+	// when internal/recommend last computed the feed, also when it found nothing
+	RecommendationsComputedAt *time.Time `json:"-"`
 }
 
 type Movie struct {
 	gorm.Model
 	OMDBID string `json:"omdb_id" gorm:"uniqueIndex"` // imdb id
 	//TMDbID   uint   `json:"tmdb_id"`
-	Title     string   `json:"title"`
-	Year      string   `json:"year"`
-	Plot      string   `json:"plot"`
-	Poster    string   `json:"poster"`
-	Genre     string   `json:"genre"`
-	Director  string   `json:"director"`
-	Actors    string   `json:"actors"`
-	Rating    string   `json:"rating"` // imdbRating string
-	AvgRating float64  `json:"avg_rating"`
-	Reviews   []Review `gorm:"foreignKey:MovieID"`
+	Title     string  `json:"title"`
+	Year      string  `json:"year"`
+	Plot      string  `json:"plot"`
+	Poster    string  `json:"poster"`
+	Genre     string  `json:"genre"`
+	Director  string  `json:"director"`
+	Actors    string  `json:"actors"`
+	Rating    string  `json:"rating"` // imdbRating string
+	AvgRating float64 `json:"avg_rating"`
+	// catalog columns, filled by cmd/importer (and OMDb where it has them)
+	Certificate string `json:"certificate"`  // PG-13, R, ...
+	Runtime     string `json:"runtime"`      // "148 min"
+	Votes       int    `json:"votes"`        // imdb votes
+	Gross       int64  `json:"gross"`        // box office, $
+	DirectorIDs string `json:"director_ids"` // comma-separated imdb nm-ids
+	StarIDs     string `json:"star_ids"`     // comma-separated imdb nm-ids
+
+	// community ratings, kept in step with reviews by internal/ratings
+	ReviewCount     int             `json:"review_count" gorm:"default:0"`
+	RatingSum       int             `json:"-" gorm:"default:0"`
+	RatingHistogram RatingHistogram `json:"rating_histogram" gorm:"type:integer[];default:'{0,0,0,0,0,0,0,0,0,0}'"` // reviews per rating 1..10
+
+	Genres  []Genre  `json:"genres,omitempty" gorm:"many2many:movie_genres"` // normalized Genre column
+	Reviews []Review `gorm:"foreignKey:MovieID"`
+	// columns overridden by an admin, comma-separated; imports and enrichment leave them alone
+	LockedFields string `json:"locked_fields"`
+	// background enrichment bookkeeping (see internal/enrich)
+	EnrichStatus    string     `json:"enrich_status" gorm:"default:pending;index"` // pending/done/failed/not_found
+	EnrichAttempts  int        `json:"-"`
+	EnrichAttemptAt *time.Time `json:"-"` // last attempt
+	EnrichNextAt    *time.Time `json:"-"` // earliest retry after a failure
+	EnrichError     string     `json:"-"`
+	// when internal/similar last computed the neighbours, also when it found none
+	SimilarComputedAt *time.Time `json:"-"`
+}
+
+// Locked reports whether column was overridden by an admin.
+func (m *Movie) Locked(column string) bool {
+	for _, f := range strings.Split(m.LockedFields, ",") {
+		if f == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Genre is one normalized genre, linked to movies through movie_genres.
+type Genre struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"uniqueIndex" json:"name"` // "Film-Noir"
+	Slug string `gorm:"uniqueIndex" json:"slug"` // "film-noir"
+}
+
+// Person is a director or actor. IMDbID is empty for names only OMDb knows about.
+type Person struct {
+	ID     uint    `gorm:"primaryKey" json:"id"`
+	IMDbID *string `gorm:"column:imdb_id;uniqueIndex" json:"imdb_id"` // nm-id
+	Name   string  `gorm:"not null" json:"name"`
+}
+
+func (Person) TableName() string {
+	return "people"
+}
+
+const (
+	RoleDirector = "director"
+	RoleActor    = "actor"
+)
+
+// MovieCredit links a person to a movie, rebuilt from Movie.Director/Actors by catalog.SyncCredits.
+type MovieCredit struct {
+	MovieID  uint   `gorm:"primaryKey" json:"movie_id"`
+	PersonID uint   `gorm:"primaryKey;index" json:"person_id"`
+	Role     string `gorm:"primaryKey" json:"role"` // director/actor
+	Billing  int    `json:"billing"`                // 1-based order in the credits list
+}
+
+// MovieSimilarity is one precomputed neighbour of a movie, rebuilt by internal/similar.
+// The counts say why it is similar.
+type MovieSimilarity struct {
+	MovieID         uint      `gorm:"primaryKey" json:"movie_id"`
+	SimilarID       uint      `gorm:"primaryKey" json:"similar_id"`
+	Score           float64   `json:"score"`
+	SharedGenres    int       `json:"shared_genres"`
+	SharedDirectors int       `json:"shared_directors"`
+	SharedCast      int       `json:"shared_cast"`
+	CoPlaylists     int       `json:"co_playlists"` // playlists holding both
+	CoLikes         int       `json:"co_likes"`     // users who liked both
+	ComputedAt      time.Time `json:"computed_at"`
+}
+
+// ItemSimilarity is a collaborative-filtering neighbour: users who rate or keep one
+// movie tend to like the other. Rebuilt by internal/recommend.
+type ItemSimilarity struct {
+	MovieID uint    `gorm:"primaryKey" json:"movie_id"`
+	OtherID uint    `gorm:"primaryKey" json:"other_id"`
+	Score   float64 `json:"score"`
+	Support int     `json:"support"` // users behind the score
+}
+
+// Recommendation is one precomputed pick for a user, see internal/recommend.
+type Recommendation struct {
+	UserID        uint      `gorm:"primaryKey" json:"user_id"`
+	MovieID       uint      `gorm:"primaryKey" json:"movie_id"`
+	Score         float64   `json:"score"`
+	BecauseID     *uint     `json:"because_id"`     // the user's movie that contributed most
+	FollowedCount int       `json:"followed_count"` // followed users who rated it highly
+	ComputedAt    time.Time `json:"computed_at"`
+}
+
+// MoviePoster is the local copy of a movie's poster, see internal/posters.
+type MoviePoster struct {
+	MovieID   uint       `gorm:"primaryKey" json:"movie_id"`
+	SourceURL string     `json:"source_url"` // the movies.poster value it was made from
+	Status    string     `gorm:"size:16;index" json:"status"`
+	Width     int        `json:"width"` // of the original
+	Height    int        `json:"height"`
+	Color     string     `gorm:"size:7" json:"color"` // dominant colour, #rrggbb
+	Attempts  int        `json:"attempts"`
+	NextAt    *time.Time `json:"-"` // earliest retry after a failure
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
+// Trending windows, see internal/trending.
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+)
+
+// TrendingScore is one movie's place in a trending snapshot, rebuilt by internal/trending.
+type TrendingScore struct {
+	Window     string    `gorm:"column:time_window;primaryKey;size:8" json:"window"` // window is reserved in SQL
+	MovieID    uint      `gorm:"primaryKey" json:"movie_id"`
+	Rank       int       `json:"rank"`
+	Score      float64   `json:"score"`
+	Reviews    int       `json:"reviews"` // raw event counts inside the window
+	Likes      int       `json:"likes"`
+	Additions  int       `json:"additions"`
+	Comments   int       `json:"comments"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// TrendingSnapshot records that a window was refreshed, also when it came out empty.
+type TrendingSnapshot struct {
+	Window     string    `gorm:"column:time_window;primaryKey;size:8" json:"window"`
+	Movies     int64     `json:"movies"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// Playlist visibility: public playlists are listed on profiles, unlisted ones open
+// with their share token only, private ones to the owner only.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Playlist kinds: every account has one watchlist, one watched and one liked playlist
+// (the system playlists), everything users create is custom.
+const (
+	PlaylistCustom    = "custom"
+	PlaylistWatchlist = "watchlist"
+	PlaylistWatched   = "watched"
+	PlaylistLiked     = "liked"
+)
+
 type Playlist struct {
 	gorm.Model
-	Name    string  `json:"name"`
-	Cover   string  `json:"cover"`
-	OwnerID uint    `json:"owner_id"` //FK
-	Movies  []Movie `gorm:"many2many:playlist_movies"`
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind" gorm:"not null;default:custom"` // one of each system kind per owner
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags" gorm:"serializer:json;type:jsonb"`
+	Cover        string   `json:"cover"`
+	OwnerID      uint     `json:"owner_id"` //FK
+	Visibility   string   `json:"visibility" gorm:"default:public"`
+	ShareToken   *string  `json:"-" gorm:"uniqueIndex"`
+	OrderVersion int      `json:"order_version" gorm:"default:0"`        // bumped by every reorder
+	ForkedFromID *uint    `json:"forked_from_id,omitempty" gorm:"index"` // the playlist this one was copied from
+	Movies       []Movie  `gorm:"many2many:playlist_movies"`
+
+	// smart playlists have Rules; their movies are computed by internal/smart into
+	// smart_playlist_movies instead of being added by hand
+	Rules       *SmartRules `gorm:"serializer:json" json:"rules,omitempty"`
+	RefreshedAt *time.Time  `json:"refreshed_at,omitempty"`
+}
+
+// SmartRules select a smart playlist's movies, see internal/smart for the fields and ops.
+type SmartRules struct {
+	Match string      `json:"match"` // "all" (default) or "any"
+	Rules []SmartRule `json:"rules"`
+	Sort  string      `json:"sort,omitempty"`
+	Limit int         `json:"limit,omitempty"`
+}
+
+type SmartRule struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// SmartPlaylistMovie is a cached match of a smart playlist. AddedAt is when the movie first matched.
+type SmartPlaylistMovie struct {
+	PlaylistID uint      `gorm:"primaryKey" json:"playlist_id"`
+	MovieID    uint      `gorm:"primaryKey" json:"movie_id"`
+	Position   int       `json:"position"`
+	AddedAt    time.Time `gorm:"default:now()" json:"added_at"`
+}
+
+// Collaborator roles: viewers can open a playlist whatever its visibility, editors can also
+// add, remove, describe and reorder its movies. Settings stay with the owner.
+const (
+	CollaboratorViewer = "viewer"
+	CollaboratorEditor = "editor"
+)
+
+// PlaylistCollaborator is an invite until the user accepts it.
+type PlaylistCollaborator struct {
+	PlaylistID uint       `gorm:"primaryKey" json:"playlist_id"`
+	UserID     uint       `gorm:"primaryKey;index" json:"user_id"`
+	Role       string     `json:"role"`
+	InvitedBy  uint       `json:"invited_by"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PlaylistSubscription: the user is notified when movies are added to the playlist.
+type PlaylistSubscription struct {
+	PlaylistID uint      `gorm:"primaryKey" json:"playlist_id"`
+	UserID     uint      `gorm:"primaryKey;index" json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type Review struct {
@@ -75,16 +299,64 @@ type CommentVote struct {
 	Value     int  // +1 upvote -1 downvote
 }
 
+// ReviewReaction: one per user, review and type (see the reactions package for the types).
+type ReviewReaction struct {
+	ReviewID  uint      `gorm:"primaryKey;index" json:"review_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	Type      string    `gorm:"primaryKey;size:20" json:"type"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
 type Follow struct {
 	gorm.Model
 	FollowerID uint `gorm:"uniqueIndex:idx_follower_followed"`
 	FollowedID uint `gorm:"uniqueIndex:idx_follower_followed"`
 }
 
+// DiaryEntry is one viewing of a movie on a day. A movie can be logged any number of
+// times; every logged movie is also in the user's "watched" playlist.
+type DiaryEntry struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index:idx_diary_user_day" json:"user_id"`
+	MovieID   uint      `gorm:"not null;index" json:"movie_id"`
+	WatchedOn time.Time `gorm:"type:date;not null;index:idx_diary_user_day" json:"watched_on"`
+	Rewatch   bool      `gorm:"default:false" json:"rewatch"`
+	ReviewID  *uint     `json:"review_id"` // the review written about this viewing, if any
+}
+
+// ImportJob is one Letterboxd or IMDb import, kept for its report (see internal/transfer).
+type ImportJob struct {
+	gorm.Model
+	UserID         uint           `gorm:"index" json:"user_id"`
+	Source         string         `gorm:"size:16" json:"source"` // letterboxd, imdb
+	Filename       string         `json:"filename"`
+	Rows           int            `json:"rows"`
+	Imported       map[string]int `gorm:"serializer:json" json:"imported"` // rows written, by kind
+	UnmatchedCount int            `json:"unmatched"`
+	Unmatched      []UnmatchedRow `gorm:"serializer:json" json:"-"` // served as CSV
+}
+
+// UnmatchedRow is a line of an import that was not written, and why.
+type UnmatchedRow struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	Year   string `json:"year"`
+	IMDbID string `json:"imdb_id"`
+	Reason string `json:"reason"`
+}
+
 type PlaylistMovie struct {
 	PlaylistID  uint   `gorm:"primaryKey" json:"playlist_id"`
 	MovieID     uint   `gorm:"primaryKey" json:"movie_id"`
 	Description string `json:"description"`
+	// nil for entries older than the column, see database.playlistMovieMigrations
+	AddedAt *time.Time `gorm:"default:now()" json:"added_at"`
+	// manual order, set by PUT /api/playlists/:id/order; entries added since sort after the ordered ones
+	Position *int `json:"position"`
+	// who added the entry; nil for the owner's own lists (likes, diary, imports) and older entries
+	AddedBy *uint `json:"added_by"`
 }
 
 func (PlaylistMovie) TableName() string {
@@ -103,3 +375,58 @@ type Notification struct {
 type BannedUser struct {
 	UserID uint `gorm:"primaryKey"`
 }
+
+// ProviderCache stores raw movie provider responses keyed by normalized query.
+// NotFound rows are negative entries ("Movie not found!") with their own TTL.
+type ProviderCache struct {
+	Key       string    `gorm:"primaryKey"` // provider:op:normalized query
+	NotFound  bool      `gorm:"default:false"`
+	Payload   string    // json
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// RatingHistogram counts reviews per rating, index 0 is rating 1.
+// Stored as a Postgres integer[] so single buckets can be incremented in SQL.
+type RatingHistogram [10]int
+
+func (h RatingHistogram) Value() (driver.Value, error) {
+	parts := make([]string, len(h))
+	for i, n := range h {
+		parts[i] = strconv.Itoa(n)
+	}
+	return "{" + strings.Join(parts, ",") + "}", nil
+}
+
+func (h *RatingHistogram) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*h = RatingHistogram{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("rating histogram: unsupported type %T", src)
+	}
+
+	var out RatingHistogram
+	s = strings.Trim(s, "{}")
+	if s != "" {
+		parts := strings.Split(s, ",")
+		if len(parts) != len(out) {
+			return fmt.Errorf("rating histogram: want %d buckets, got %d", len(out), len(parts))
+		}
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return fmt.Errorf("rating histogram: %w", err)
+			}
+			out[i] = n
+		}
+	}
+	*h = out
+	return nil
+}
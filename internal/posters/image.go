@@ -0,0 +1,108 @@
+package posters
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// Resize scales img down to width, keeping the aspect ratio. Every target pixel
+// is the average of the source pixels it covers (a box filter).
+func Resize(img image.Image, width int) image.Image {
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// DominantColor returns the most common colour of img as #rrggbb. Pixels are bucketed
+// by their top 4 bits per channel and the fullest bucket's average wins, so a large
+// flat background beats a few bright details. Transparent pixels are ignored.
+func DominantColor(img image.Image) string {
+	if img.Bounds().Dx() > 64 {
+		img = Resize(img, 64)
+	}
+	src := toRGBA(img)
+
+	type bucket struct{ n, r, g, b uint32 }
+	var buckets [4096]bucket
+	best := -1
+	for y := 0; y < src.Rect.Dy(); y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < src.Rect.Dx(); x++ {
+			p := row[x*4 : x*4+4]
+			if p[3] < 128 {
+				continue
+			}
+			i := int(p[0]>>4)<<8 | int(p[1]>>4)<<4 | int(p[2]>>4)
+			bk := &buckets[i]
+			bk.n++
+			bk.r += uint32(p[0])
+			bk.g += uint32(p[1])
+			bk.b += uint32(p[2])
+			if best < 0 || bk.n > buckets[best].n {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	bk := buckets[best]
+	return fmt.Sprintf("#%02x%02x%02x", bk.r/bk.n, bk.g/bk.n, bk.b/bk.n)
+}
+
+// Placeholder is served for movies without a usable poster, in a size's proportions (2:3).
+func Placeholder(size string) []byte {
+	width := Sizes[size]
+	if width == 0 {
+		width = 300
+	}
+	height := width * 3 / 2
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[2]d" viewBox="0 0 %[1]d %[2]d">`+
+		`<rect width="%[1]d" height="%[2]d" fill="#2b2b2b"/>`+
+		`<circle cx="%[3]d" cy="%[4]d" r="%[5]d" fill="none" stroke="#5a5a5a" stroke-width="%[6]d"/>`+
+		`</svg>`,
+		width, height, width/2, height/2, width/6, max(width/40, 2)))
+}
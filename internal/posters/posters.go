@@ -0,0 +1,271 @@
+// Package posters mirrors movie posters into the uploads storage.
+//
+// OMDb hands out hotlinked Amazon URLs, or "N/A". Every poster is downloaded once,
+// stored as JPEG in a few widths under Dir/<movie id>/<size>.jpg and described by a
+// models.MoviePoster row (original dimensions, dominant colour). A poster is mirrored
+// again when movies.poster changes; broken ones are retried with a growing delay.
+package posters
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+	"totallyguysproject/internal/models"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusMirrored = "mirrored"
+	StatusMissing  = "missing" // the movie has no poster ("" or "N/A")
+	StatusFailed   = "failed"  // download or decode failed, retried later
+)
+
+// Sizes maps a size name to its width in pixels; 0 keeps the original. Posters are never upscaled.
+var Sizes = map[string]int{
+	"small":    154,
+	"medium":   342,
+	"large":    780,
+	"original": 0,
+}
+
+// DefaultSize is the size list endpoints link to.
+const DefaultSize = "medium"
+
+// Dir is where the files go, next to avatars and playlist covers. Start sets it to Config.Dir.
+var Dir = "/app/uploads/posters"
+
+// URL is the public address of a movie's poster.
+func URL(movieID uint, size string) string {
+	return fmt.Sprintf("/media/posters/%d/%s", movieID, size)
+}
+
+// File is where a mirrored size of a poster lives.
+func File(movieID uint, size string) string {
+	return filepath.Join(Dir, fmt.Sprint(movieID), size+".jpg")
+}
+
+type Config struct {
+	Dir         string        // where the files go, see Dir
+	Interval    time.Duration // how often to scan for posters to mirror
+	BatchSize   int           // posters per scan
+	Timeout     time.Duration // per download
+	MaxBytes    int64         // larger downloads are rejected
+	MaxAttempts int           // failed posters are given up after this many tries
+	FailDelay   time.Duration // first retry delay, doubled every failed attempt
+}
+
+// DefaultConfig reads POSTER_DIR (default: Dir).
+func DefaultConfig() Config {
+	cfg := Config{
+		Dir:         Dir,
+		Interval:    5 * time.Minute,
+		BatchSize:   50,
+		Timeout:     15 * time.Second,
+		MaxBytes:    10 << 20,
+		MaxAttempts: 5,
+		FailDelay:   time.Hour,
+	}
+	if d := os.Getenv("POSTER_DIR"); d != "" {
+		cfg.Dir = d
+	}
+	return cfg
+}
+
+// Mirrorer downloads and stores posters.
+type Mirrorer struct {
+	db     *gorm.DB
+	client *http.Client
+	cfg    Config
+	queue  chan uint
+}
+
+func NewMirrorer(db *gorm.DB, cfg Config) *Mirrorer {
+	return &Mirrorer{
+		db:     db,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		queue:  make(chan uint, 256),
+	}
+}
+
+var defaultMirrorer *Mirrorer
+
+// Start runs the default mirrorer, Enqueue sends movie ids to it.
+func Start(db *gorm.DB, cfg Config) *Mirrorer {
+	if cfg.Dir != "" {
+		Dir = cfg.Dir
+	}
+	m := NewMirrorer(db, cfg)
+	defaultMirrorer = m
+	go m.run()
+	return m
+}
+
+// Enqueue asks the default mirrorer to look at a movie's poster soon. Never blocks.
+func Enqueue(movieID uint) {
+	if defaultMirrorer == nil {
+		return
+	}
+	select {
+	case defaultMirrorer.queue <- movieID:
+	default:
+		// queue full, the periodic scan will pick it up
+	}
+}
+
+func (m *Mirrorer) run() {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	m.scan()
+	for {
+		select {
+		case id := <-m.queue:
+			if err := m.Process(id); err != nil {
+				fmt.Printf("poster of movie %d: %v\n", id, err)
+			}
+		case <-ticker.C:
+			m.scan()
+		}
+	}
+}
+
+// scan mirrors posters that were never mirrored, changed since, or are due for a retry.
+func (m *Mirrorer) scan() {
+	var ids []uint
+	err := m.db.Table("movies").
+		Joins("LEFT JOIN movie_posters ON movie_posters.movie_id = movies.id").
+		Where("movies.deleted_at IS NULL").
+		Where(`movie_posters.movie_id IS NULL OR movie_posters.source_url <> movies.poster
+			OR (movie_posters.status = ? AND movie_posters.attempts < ? AND movie_posters.next_at <= ?)`,
+			StatusFailed, m.cfg.MaxAttempts, time.Now()).
+		Order("movies.id").
+		Limit(m.cfg.BatchSize).
+		Pluck("movies.id", &ids).Error
+	if err != nil {
+		fmt.Println("poster scan failed:", err)
+		return
+	}
+	for _, id := range ids {
+		if err := m.Process(id); err != nil {
+			fmt.Printf("poster of movie %d: %v\n", id, err)
+		}
+	}
+}
+
+// Process mirrors one movie's current poster and records the outcome.
+// A poster that cannot be fetched is a recorded failure, not an error.
+func (m *Mirrorer) Process(movieID uint) error {
+	var movie models.Movie
+	if err := m.db.First(&movie, movieID).Error; err != nil {
+		return err
+	}
+	var row models.MoviePoster
+	if err := m.db.Where("movie_id = ?", movieID).Limit(1).Find(&row).Error; err != nil {
+		return err
+	}
+	if row.MovieID != 0 && row.SourceURL == movie.Poster {
+		if row.Status != StatusFailed {
+			return nil // up to date
+		}
+		if row.Attempts >= m.cfg.MaxAttempts || (row.NextAt != nil && row.NextAt.After(time.Now())) {
+			return nil // given up, or not due yet
+		}
+	} else {
+		row.Attempts = 0
+	}
+	row.MovieID = movieID
+	row.SourceURL = movie.Poster
+	row.NextAt = nil
+
+	if movie.Poster == "" || movie.Poster == "N/A" {
+		row.Status = StatusMissing
+		row.Width, row.Height, row.Color = 0, 0, ""
+		os.RemoveAll(filepath.Join(Dir, fmt.Sprint(movieID)))
+		return m.save(&row)
+	}
+
+	img, err := m.download(movie.Poster)
+	if err == nil {
+		err = writeSizes(movieID, img)
+	}
+	if err != nil {
+		row.Status = StatusFailed
+		row.Attempts++
+		next := time.Now().Add(m.cfg.FailDelay << (row.Attempts - 1))
+		row.NextAt = &next
+		if saveErr := m.save(&row); saveErr != nil {
+			return saveErr
+		}
+		fmt.Printf("poster of movie %d failed (attempt %d): %v\n", movieID, row.Attempts, err)
+		return nil
+	}
+
+	b := img.Bounds()
+	row.Status = StatusMirrored
+	row.Width, row.Height = b.Dx(), b.Dy()
+	row.Color = DominantColor(img)
+	row.Attempts = 0
+	return m.save(&row)
+}
+
+func (m *Mirrorer) save(row *models.MoviePoster) error {
+	return m.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error
+}
+
+func (m *Mirrorer) download(url string) (image.Image, error) {
+	resp, err := m.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("poster download: %s", resp.Status)
+	}
+	if resp.ContentLength > m.cfg.MaxBytes {
+		return nil, errors.New("poster too large")
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, m.cfg.MaxBytes))
+	return img, err
+}
+
+// writeSizes stores every size of img, each through a temp file so readers never see half a JPEG.
+func writeSizes(movieID uint, img image.Image) error {
+	dir := filepath.Join(Dir, fmt.Sprint(movieID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, width := range Sizes {
+		out := img
+		if width > 0 && img.Bounds().Dx() > width {
+			out = Resize(img, width)
+		}
+		tmp, err := os.CreateTemp(dir, name+"-*.tmp")
+		if err != nil {
+			return err
+		}
+		err = jpeg.Encode(tmp, out, &jpeg.Options{Quality: 85})
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), File(movieID, name))
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultCacheTTL    = 7 * 24 * time.Hour
+	defaultNegativeTTL = 24 * time.Hour
+)
+
+// CacheStats are counters since process start.
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"` // subset of Hits served from "not found" entries
+	Misses       int64 `json:"misses"`
+	Errors       int64 `json:"errors"` // cache table read/write failures
+}
+
+// Cached puts a Postgres-backed response cache in front of another provider.
+// Successful lookups live for TTL, "not found" answers for NegativeTTL.
+// Upstream errors other than ErrNotFound are never cached.
+type Cached struct {
+	Inner       MovieProvider
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	db           *gorm.DB
+	hits         int64
+	negativeHits int64
+	misses       int64
+	errors       int64
+}
+
+// NewCached wraps inner, TTLs come from OMDB_CACHE_TTL / OMDB_CACHE_NEGATIVE_TTL
+// (Go durations like "72h") or fall back to 7 days / 1 day.
+func NewCached(db *gorm.DB, inner MovieProvider) *Cached {
+	return &Cached{
+		Inner:       inner,
+		TTL:         durationFromEnv("OMDB_CACHE_TTL", defaultCacheTTL),
+		NegativeTTL: durationFromEnv("OMDB_CACHE_NEGATIVE_TTL", defaultNegativeTTL),
+		db:          db,
+	}
+}
+
+func (c *Cached) Name() string { return c.Inner.Name() }
+
+func (c *Cached) Stats() CacheStats {
+	return CacheStats{
+		Hits:         atomic.LoadInt64(&c.hits),
+		NegativeHits: atomic.LoadInt64(&c.negativeHits),
+		Misses:       atomic.LoadInt64(&c.misses),
+		Errors:       atomic.LoadInt64(&c.errors),
+	}
+}
+
+func (c *Cached) Search(query string, page int) (*SearchResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	var res SearchResult
+	key := c.key("search", normalizeQuery(query), strconv.Itoa(page))
+	err := c.through(key, &res, func() (interface{}, error) {
+		return c.Inner.Search(query, page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Cached) ByID(imdbID string) (*MovieDetails, error) {
+	var res MovieDetails
+	key := c.key("id", normalizeQuery(imdbID))
+	err := c.through(key, &res, func() (interface{}, error) {
+		return c.Inner.ByID(imdbID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Cached) ByTitle(title, year string) (*MovieDetails, error) {
+	var res MovieDetails
+	key := c.key("title", normalizeQuery(title), strings.TrimSpace(year))
+	err := c.through(key, &res, func() (interface{}, error) {
+		return c.Inner.ByTitle(title, year)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Cached) key(op string, parts ...string) string {
+	return c.Inner.Name() + ":" + op + ":" + strings.Join(parts, ":")
+}
+
+// through serves key from the cache table or calls fetch and stores its result into out.
+func (c *Cached) through(key string, out interface{}, fetch func() (interface{}, error)) error {
+	var entry models.ProviderCache
+	err := c.db.Where("key = ? AND expires_at > ?", key, time.Now()).Take(&entry).Error
+	switch {
+	case err == nil:
+		if entry.NotFound {
+			atomic.AddInt64(&c.hits, 1)
+			atomic.AddInt64(&c.negativeHits, 1)
+			return ErrNotFound
+		}
+		if err := json.Unmarshal([]byte(entry.Payload), out); err == nil {
+			atomic.AddInt64(&c.hits, 1)
+			return nil
+		}
+		// broken payload, refetch and overwrite
+		atomic.AddInt64(&c.errors, 1)
+	case err != gorm.ErrRecordNotFound:
+		atomic.AddInt64(&c.errors, 1)
+		fmt.Println("provider cache read failed:", err)
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	value, err := fetch()
+	if err == ErrNotFound {
+		c.store(models.ProviderCache{Key: key, NotFound: true, ExpiresAt: time.Now().Add(c.NegativeTTL)})
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.store(models.ProviderCache{Key: key, Payload: string(payload), ExpiresAt: time.Now().Add(c.TTL)})
+	return json.Unmarshal(payload, out)
+}
+
+func (c *Cached) store(entry models.ProviderCache) {
+	err := c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"not_found", "payload", "expires_at"}),
+	}).Create(&entry).Error
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		fmt.Println("provider cache write failed:", err)
+	}
+}
+
+// normalizeQuery lowercases and collapses whitespace so "The  Godfather " and "the godfather" share an entry.
+func normalizeQuery(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
+
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+// StartCacheCleanup deletes expired cache rows every hour.
+func StartCacheCleanup(db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for range ticker.C {
+			db.Where("expires_at < ?", time.Now()).Delete(&models.ProviderCache{})
+		}
+	}()
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fake serves movies from JSON fixtures on disk, no network and no API key.
+// Every *.json file in Dir holds either one OMDb detail object or an array of them.
+type Fake struct {
+	Dir string
+
+	once   sync.Once
+	err    error
+	movies []MovieDetails
+}
+
+func NewFake(dir string) *Fake {
+	return &Fake{Dir: dir}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) load() error {
+	f.once.Do(func() {
+		files, err := filepath.Glob(filepath.Join(f.Dir, "*.json"))
+		if err != nil {
+			f.err = err
+			return
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				f.err = fmt.Errorf("fake provider: %w", err)
+				return
+			}
+			var many []MovieDetails
+			if err := json.Unmarshal(data, &many); err == nil {
+				f.movies = append(f.movies, many...)
+				continue
+			}
+			var one MovieDetails
+			if err := json.Unmarshal(data, &one); err != nil {
+				f.err = fmt.Errorf("fake provider: bad fixture %s: %w", file, err)
+				return
+			}
+			f.movies = append(f.movies, one)
+		}
+	})
+	return f.err
+}
+
+func (f *Fake) Search(query string, page int) (*SearchResult, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	q := strings.ToLower(strings.TrimSpace(query))
+	var hits []SearchItem
+	for _, m := range f.movies {
+		if strings.Contains(strings.ToLower(m.Title), q) {
+			hits = append(hits, SearchItem{IMDbID: m.IMDbID, Title: m.Title, Year: m.Year, Poster: m.Poster})
+		}
+	}
+	if len(hits) == 0 {
+		return nil, ErrNotFound
+	}
+
+	start := (page - 1) * PageSize
+	if start >= len(hits) {
+		return &SearchResult{Total: len(hits)}, nil
+	}
+	end := start + PageSize
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return &SearchResult{Items: hits[start:end], Total: len(hits)}, nil
+}
+
+func (f *Fake) ByID(imdbID string) (*MovieDetails, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	for _, m := range f.movies {
+		if m.IMDbID == imdbID {
+			found := m
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (f *Fake) ByTitle(title, year string) (*MovieDetails, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	for _, m := range f.movies {
+		if strings.EqualFold(m.Title, title) && (year == "" || m.Year == year) {
+			found := m
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const omdbBaseURL = "http://www.omdbapi.com/"
+
+// OMDb talks to www.omdbapi.com.
+type OMDb struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOMDb(apiKey string) *OMDb {
+	return &OMDb{
+		APIKey:  apiKey,
+		BaseURL: omdbBaseURL,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (o *OMDb) Name() string { return "omdb" }
+
+func (o *OMDb) Search(query string, page int) (*SearchResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	params := url.Values{}
+	params.Set("s", query)
+	params.Set("type", "movie")
+	params.Set("page", strconv.Itoa(page))
+
+	var resp struct {
+		Response     string       `json:"Response"`
+		Error        string       `json:"Error"`
+		Search       []SearchItem `json:"Search"`
+		TotalResults string       `json:"totalResults"`
+	}
+	if err := o.get(params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Response != "True" {
+		return nil, omdbError(resp.Error)
+	}
+
+	total, _ := strconv.Atoi(resp.TotalResults)
+	return &SearchResult{Items: resp.Search, Total: total}, nil
+}
+
+func (o *OMDb) ByID(imdbID string) (*MovieDetails, error) {
+	params := url.Values{}
+	params.Set("i", imdbID)
+	return o.details(params)
+}
+
+func (o *OMDb) ByTitle(title, year string) (*MovieDetails, error) {
+	params := url.Values{}
+	params.Set("t", title)
+	if year != "" {
+		params.Set("y", year)
+	}
+	return o.details(params)
+}
+
+func (o *OMDb) details(params url.Values) (*MovieDetails, error) {
+	var resp struct {
+		MovieDetails
+		Response string `json:"Response"`
+		Error    string `json:"Error"`
+	}
+	if err := o.get(params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Response != "True" {
+		return nil, omdbError(resp.Error)
+	}
+	return &resp.MovieDetails, nil
+}
+
+func (o *OMDb) get(params url.Values, out interface{}) error {
+	params.Set("apikey", o.APIKey)
+
+	resp, err := o.Client.Get(o.BaseURL + "?" + params.Encode())
+	if err != nil {
+		return fmt.Errorf("omdb: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("omdb: unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("omdb: failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// omdbError maps OMDb "Error" strings, "Movie not found!" becomes ErrNotFound.
+func omdbError(msg string) error {
+	if strings.Contains(strings.ToLower(msg), "not found") {
+		return ErrNotFound
+	}
+	return fmt.Errorf("omdb: %s", msg)
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when the provider has no movie for the query.
+var ErrNotFound = errors.New("movie not found")
+
+// SearchItem is a single short search hit (what OMDb returns for ?s=).
+type SearchItem struct {
+	IMDbID string `json:"imdbID"`
+	Title  string `json:"Title"`
+	Year   string `json:"Year"`
+	Poster string `json:"Poster"`
+}
+
+// PageSize is the number of hits on a full Search page (fixed by OMDb).
+const PageSize = 10
+
+// SearchResult is one page of search hits plus the provider-side total.
+type SearchResult struct {
+	Items []SearchItem
+	Total int
+}
+
+// MovieDetails is the full record for one title.
+// json tags follow the OMDb response so fixtures can be raw OMDb dumps.
+type MovieDetails struct {
+	IMDbID   string `json:"imdbID"`
+	Title    string `json:"Title"`
+	Year     string `json:"Year"`
+	Rated    string `json:"Rated"`
+	Runtime  string `json:"Runtime"`
+	Genre    string `json:"Genre"`
+	Director string `json:"Director"`
+	Actors   string `json:"Actors"`
+	Plot     string `json:"Plot"`
+	Poster   string `json:"Poster"`
+	Rating   string `json:"imdbRating"`
+	Votes    string `json:"imdbVotes"`
+}
+
+// VotesCount parses "1,234,567" into a number, "N/A" gives 0.
+func (d *MovieDetails) VotesCount() int {
+	n, err := strconv.Atoi(strings.ReplaceAll(d.Votes, ",", ""))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// MovieProvider is an external source of movie metadata.
+type MovieProvider interface {
+	// Name identifies the provider ("omdb", "fake", ...)
+	Name() string
+	// Search returns one page (1-based) of title matches.
+	Search(query string, page int) (*SearchResult, error)
+	// ByID looks a movie up by its IMDb tt-id.
+	ByID(imdbID string) (*MovieDetails, error)
+	// ByTitle looks a movie up by exact title, year is optional.
+	ByTitle(title, year string) (*MovieDetails, error)
+}
+
+// FromEnv picks a provider from the environment:
+// MOVIE_PROVIDER=fake serves fixtures from MOVIE_FIXTURES (default data/fixtures/omdb),
+// anything else talks to OMDb with OMDB_API.
+func FromEnv() MovieProvider {
+	if os.Getenv("MOVIE_PROVIDER") == "fake" {
+		dir := os.Getenv("MOVIE_FIXTURES")
+		if dir == "" {
+			dir = "data/fixtures/omdb"
+		}
+		return NewFake(dir)
+	}
+	return NewOMDb(os.Getenv("OMDB_API"))
+}
@@ -0,0 +1,100 @@
+// Package ratings keeps the community rating columns of movies
+// (avg_rating, review_count, rating_sum, rating_histogram) in step with reviews.
+//
+// Handlers call Add/Remove/Change in the same transaction as the review write.
+// The updates are relative (count + 1, bucket + 1) so concurrent reviews of
+// one movie do not overwrite each other. Recompute rebuilds the columns from
+// the reviews table and is used by cmd/repair-ratings.
+package ratings
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Add counts a new review with the given rating.
+func Add(tx *gorm.DB, movieID uint, rating int) error {
+	return shift(tx, movieID, rating, 1)
+}
+
+// Remove uncounts a deleted review.
+func Remove(tx *gorm.DB, movieID uint, rating int) error {
+	return shift(tx, movieID, rating, -1)
+}
+
+// Change moves an edited review from one rating bucket to another.
+func Change(tx *gorm.DB, movieID uint, oldRating, newRating int) error {
+	if oldRating == newRating {
+		return nil
+	}
+	if err := Remove(tx, movieID, oldRating); err != nil {
+		return err
+	}
+	return Add(tx, movieID, newRating)
+}
+
+func shift(tx *gorm.DB, movieID uint, rating, delta int) error {
+	if rating < 1 || rating > 10 {
+		return fmt.Errorf("ratings: rating %d out of range", rating)
+	}
+	// right-hand sides see the old row, hence "+ ?" again in avg_rating
+	return tx.Exec(`
+		UPDATE movies SET
+			review_count = review_count + ?,
+			rating_sum = rating_sum + ?,
+			rating_histogram[?] = rating_histogram[?] + ?,
+			avg_rating = COALESCE(round((rating_sum + ?)::numeric / NULLIF(review_count + ?, 0), 2), 0)
+		WHERE id = ?`,
+		delta, delta*rating, rating, rating, delta, delta*rating, delta, movieID).Error
+}
+
+// Recompute rebuilds the rating columns from reviews and returns how many movies were wrong.
+// With movieIDs == nil every movie is checked.
+func Recompute(db *gorm.DB, movieIDs []uint) (int64, error) {
+	scope := ""
+	var args []interface{}
+	if movieIDs != nil {
+		if len(movieIDs) == 0 {
+			return 0, nil
+		}
+		scope = " AND m.id IN ?"
+		args = append(args, movieIDs)
+	}
+
+	buckets := make([]string, 10)
+	for i := range buckets {
+		buckets[i] = fmt.Sprintf("COUNT(*) FILTER (WHERE rating = %d)", i+1)
+	}
+
+	res := db.Exec(`
+		UPDATE movies SET
+			review_count = s.review_count,
+			rating_sum = s.rating_sum,
+			rating_histogram = s.rating_histogram,
+			avg_rating = s.avg_rating
+		FROM (
+			SELECT m.id,
+				COALESCE(r.review_count, 0) AS review_count,
+				COALESCE(r.rating_sum, 0) AS rating_sum,
+				COALESCE(r.rating_histogram, '{0,0,0,0,0,0,0,0,0,0}') AS rating_histogram,
+				COALESCE(round(r.rating_sum::numeric / NULLIF(r.review_count, 0), 2), 0) AS avg_rating
+			FROM movies m
+			LEFT JOIN (
+				SELECT movie_id, COUNT(*) AS review_count, SUM(rating) AS rating_sum,
+					ARRAY[`+strings.Join(buckets, ", ")+`]::integer[] AS rating_histogram
+				FROM reviews
+				WHERE deleted_at IS NULL AND rating BETWEEN 1 AND 10
+				GROUP BY movie_id
+			) r ON r.movie_id = m.id
+			WHERE TRUE`+scope+`
+		) s
+		WHERE movies.id = s.id AND (
+			movies.review_count IS DISTINCT FROM s.review_count OR
+			movies.rating_sum IS DISTINCT FROM s.rating_sum OR
+			movies.rating_histogram IS DISTINCT FROM s.rating_histogram OR
+			movies.avg_rating IS DISTINCT FROM s.avg_rating
+		)`, args...)
+	return res.RowsAffected, res.Error
+}
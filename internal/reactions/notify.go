@@ -0,0 +1,155 @@
+package reactions
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"totallyguysproject/internal/ws"
+
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	FlushEvery time.Duration // how often review authors hear about new reactions
+}
+
+// DefaultConfig reads REACTIONS_FLUSH (a Go duration, default 1m).
+func DefaultConfig() Config {
+	cfg := Config{FlushEvery: time.Minute}
+	if d, err := time.ParseDuration(os.Getenv("REACTIONS_FLUSH")); err == nil && d > 0 {
+		cfg.FlushEvery = d
+	}
+	return cfg
+}
+
+var queue chan uint
+
+// Start sends, every cfg.FlushEvery, one message to each author whose reviews Enqueue
+// reported, with the reactions they got since the last flush. A failed flush keeps its
+// reviews for the next one.
+func Start(db *gorm.DB, hub *ws.Hub, cfg Config) {
+	queue = make(chan uint, 1024)
+	go func() {
+		flush := time.NewTicker(cfg.FlushEvery)
+		defer flush.Stop()
+
+		pending := map[uint]bool{}
+		last := time.Now() // the newest reaction authors have heard about
+		for {
+			select {
+			case id := <-queue:
+				pending[id] = true
+			case <-flush.C:
+				if len(pending) == 0 {
+					continue
+				}
+				ids := make([]uint, 0, len(pending))
+				for id := range pending {
+					ids = append(ids, id)
+				}
+				_, latest, err := Notify(db, hub, ids, last)
+				if err != nil {
+					fmt.Println("reactions: notify failed:", err)
+					continue
+				}
+				pending = map[uint]bool{}
+				last = latest
+			}
+		}
+	}()
+}
+
+// Enqueue reports that the review got a reaction. Never blocks; when the queue is full
+// the author doesn't hear about it.
+func Enqueue(reviewID uint) {
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- reviewID:
+	default:
+	}
+}
+
+// Notify tells the authors of these reviews about the reactions they got after since,
+// one message per author. Reactions taken back in the meantime are not counted.
+// It returns how many authors it messaged and when the newest reaction it counted was
+// made, since itself when there were none.
+func Notify(db *gorm.DB, hub *ws.Hub, reviewIDs []uint, since time.Time) (int, time.Time, error) {
+	if hub == nil || len(reviewIDs) == 0 {
+		return 0, since, nil
+	}
+	var rows []struct {
+		ReviewID   uint
+		Type       string
+		N          int64
+		AuthorID   uint
+		MovieID    uint
+		MovieTitle string
+		Latest     time.Time
+	}
+	if err := db.Table("review_reactions").
+		Select(`review_reactions.review_id, review_reactions.type, count(*) AS n,
+			max(review_reactions.created_at) AS latest, reviews.user_id AS author_id, reviews.movie_id, movies.title AS movie_title`).
+		Joins("JOIN reviews ON reviews.id = review_reactions.review_id AND reviews.deleted_at IS NULL").
+		Joins("JOIN movies ON movies.id = reviews.movie_id").
+		Where("review_reactions.review_id IN ? AND review_reactions.created_at > ?", reviewIDs, since).
+		Group("review_reactions.review_id, review_reactions.type, reviews.user_id, reviews.movie_id, movies.title").
+		Order("review_reactions.review_id, review_reactions.type").
+		Scan(&rows).Error; err != nil {
+		return 0, since, err
+	}
+
+	type reviewReactions struct {
+		ReviewID   uint             `json:"review_id"`
+		MovieID    uint             `json:"movie_id"`
+		MovieTitle string           `json:"movie_title"`
+		Reactions  map[string]int64 `json:"reactions"`
+	}
+	byAuthor := map[uint][]*reviewReactions{}
+	totals := map[uint]int64{}
+	var authors []uint
+	latest := since
+	for _, r := range rows {
+		if r.Latest.After(latest) {
+			latest = r.Latest
+		}
+		reviews := byAuthor[r.AuthorID]
+		if len(reviews) == 0 {
+			authors = append(authors, r.AuthorID)
+		}
+		if len(reviews) == 0 || reviews[len(reviews)-1].ReviewID != r.ReviewID {
+			reviews = append(reviews, &reviewReactions{
+				ReviewID:   r.ReviewID,
+				MovieID:    r.MovieID,
+				MovieTitle: r.MovieTitle,
+				Reactions:  map[string]int64{},
+			})
+			byAuthor[r.AuthorID] = reviews
+		}
+		reviews[len(reviews)-1].Reactions[r.Type] = r.N
+		totals[r.AuthorID] += r.N
+	}
+
+	for _, author := range authors {
+		reviews := byAuthor[author]
+		text := fmt.Sprintf("Your reviews got %d new %s", totals[author], plural(totals[author]))
+		if len(reviews) == 1 {
+			text = fmt.Sprintf("Your review of «%s» got %d new %s", reviews[0].MovieTitle, totals[author], plural(totals[author]))
+		}
+		hub.Send(author, map[string]interface{}{
+			"type":    "review_reactions",
+			"reviews": reviews,
+			"count":   totals[author],
+			"text":    text,
+		})
+	}
+	return len(authors), latest, nil
+}
+
+func plural(n int64) string {
+	if n == 1 {
+		return "reaction"
+	}
+	return "reactions"
+}
@@ -0,0 +1,105 @@
+// Package reactions are the reactions users leave on reviews: one of each type per user
+// and review (models.ReviewReaction).
+//
+// "helpful" and "unhelpful" are votes on the review and exclude each other; they rank
+// reviews by the lower bound of the Wilson score interval, so a review 40 of 45 found
+// helpful beats one that 2 of 2 did. The other types are just counted. Review authors
+// hear about new reactions in one message per FlushEvery (see Start).
+package reactions
+
+import (
+	"math"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	Helpful    = "helpful"
+	Unhelpful  = "unhelpful"
+	Funny      = "funny"
+	Insightful = "insightful"
+	Disagree   = "disagree"
+)
+
+// Types are the reactions a review can get, in display order.
+var Types = []string{Helpful, Unhelpful, Funny, Insightful, Disagree}
+
+// Valid: t is one of Types.
+func Valid(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Opposite is the reaction that adding t takes back, "" if none.
+func Opposite(t string) string {
+	switch t {
+	case Helpful:
+		return Unhelpful
+	case Unhelpful:
+		return Helpful
+	}
+	return ""
+}
+
+// z for a 95% confidence interval
+const z = 1.96
+
+// Wilson is the lower bound of the Wilson score interval for helpful out of
+// helpful+unhelpful votes, 0 without votes.
+func Wilson(helpful, unhelpful int64) float64 {
+	n := float64(helpful + unhelpful)
+	if n == 0 {
+		return 0
+	}
+	p := float64(helpful) / n
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// Counts are the reactions of these reviews by type. Every review gets a map, with a
+// zero for every type it has none of.
+func Counts(db *gorm.DB, reviewIDs []uint) (map[uint]map[string]int64, error) {
+	counts := make(map[uint]map[string]int64, len(reviewIDs))
+	for _, id := range reviewIDs {
+		counts[id] = make(map[string]int64, len(Types))
+		for _, t := range Types {
+			counts[id][t] = 0
+		}
+	}
+	if len(reviewIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ReviewID uint
+		Type     string
+		N        int64
+	}
+	if err := db.Model(&models.ReviewReaction{}).
+		Select("review_id, type, count(*) AS n").
+		Where("review_id IN ?", reviewIDs).
+		Group("review_id, type").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if counts[r.ReviewID] != nil {
+			counts[r.ReviewID][r.Type] = r.N
+		}
+	}
+	return counts, nil
+}
+
+// Mine are the types userID reacted to the review with.
+func Mine(db *gorm.DB, reviewID, userID uint) []string {
+	mine := []string{}
+	db.Model(&models.ReviewReaction{}).
+		Where("review_id = ? AND user_id = ?", reviewID, userID).
+		Order("type").
+		Pluck("type", &mine)
+	return mine
+}
@@ -0,0 +1,317 @@
+// Package recommend precomputes a ranked feed of unseen movies for every user.
+//
+// It is item-based collaborative filtering: a user's affinity for a movie comes from
+// their review rating or, without a review, from the playlist it sits in ("liked" counts
+// most). Movies are neighbours when the same users feel the same about them (cosine over
+// affinities, item_similarities). A user's candidates are the neighbours of the movies
+// they like, weighted by how much they like them, plus a boost for movies the people they
+// follow rated highly. Movies the user reviewed or keeps in any playlist are left out.
+package recommend
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	Interval   time.Duration // time between full rebuilds
+	FlushEvery time.Duration // how often queued updates are applied
+	BatchSize  int           // movies or users per statement
+	Neighbours int           // item_similarities kept per movie
+	Keep       int           // recommendations kept per user
+	Shrink     float64       // pulls neighbours backed by few users towards 0
+	Damping    float64       // pulls candidates backed by few liked movies towards 0
+
+	// affinity of a movie kept in a playlist without a review, reviews map 1..10 to -1..1
+	Liked      float64
+	WatchLater float64
+	Watched    float64
+	Listed     float64 // any other playlist
+
+	Follow    float64 // weight of the followed-users boost, applied to ln(1 + n)
+	FollowMin int     // lowest rating of a followed user that counts as rated highly
+}
+
+// DefaultConfig reads RECOMMEND_INTERVAL (a Go duration, default 6h), the rest is fixed.
+func DefaultConfig() Config {
+	cfg := Config{
+		Interval:   6 * time.Hour,
+		FlushEvery: 30 * time.Second,
+		BatchSize:  200,
+		Neighbours: 50,
+		Keep:       50,
+		Shrink:     5,
+		Damping:    1,
+		Liked:      1,
+		WatchLater: 0.5,
+		Watched:    0.3,
+		Listed:     0.6,
+		Follow:     0.3,
+		FollowMin:  8,
+	}
+	if d, err := time.ParseDuration(os.Getenv("RECOMMEND_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	return cfg
+}
+
+type update struct {
+	movieID uint
+	userIDs []uint
+}
+
+var queue chan update
+
+// Start rebuilds everything now and then every cfg.Interval; between rebuilds it applies
+// what Enqueue reported, every cfg.FlushEvery.
+func Start(db *gorm.DB, cfg Config) {
+	queue = make(chan update, 256)
+	go func() {
+		rebuild := time.NewTicker(cfg.Interval)
+		defer rebuild.Stop()
+		flush := time.NewTicker(cfg.FlushEvery)
+		defer flush.Stop()
+
+		movies := map[uint]bool{}
+		users := map[uint]bool{}
+		runRebuild(db, cfg)
+		for {
+			select {
+			case u := <-queue:
+				if u.movieID != 0 {
+					movies[u.movieID] = true
+				}
+				for _, id := range u.userIDs {
+					users[id] = true
+				}
+			case <-flush.C:
+				if len(movies) == 0 && len(users) == 0 {
+					continue
+				}
+				if err := ComputeItems(db, keys(movies), cfg); err != nil {
+					fmt.Println("recommend: item update failed:", err)
+				}
+				if err := ComputeUsers(db, keys(users), cfg); err != nil {
+					fmt.Println("recommend: user update failed:", err)
+				}
+				movies = map[uint]bool{}
+				users = map[uint]bool{}
+			case <-rebuild.C:
+				runRebuild(db, cfg)
+			}
+		}
+	}()
+}
+
+// Enqueue reports that movieID got a new or changed review, and whose feeds it affects
+// (the author, their followers). Never blocks; a full queue waits for the next rebuild.
+func Enqueue(movieID uint, userIDs ...uint) {
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- update{movieID: movieID, userIDs: userIDs}:
+	default:
+		// queue full, the next rebuild catches up
+	}
+}
+
+func runRebuild(db *gorm.DB, cfg Config) {
+	start := time.Now()
+	movies, users, err := Rebuild(db, cfg)
+	if err != nil {
+		fmt.Println("recommend rebuild failed:", err)
+		return
+	}
+	fmt.Printf("recommend: rebuilt %d movies and %d users in %s\n",
+		movies, users, time.Since(start).Round(time.Millisecond))
+}
+
+func keys(set map[uint]bool) []uint {
+	out := make([]uint, 0, len(set))
+	for id := range set {
+		out = append(out, id)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Rebuild recomputes every movie's neighbours, then every user's feed, in id order.
+// It returns how many movies and users it did.
+func Rebuild(db *gorm.DB, cfg Config) (int, int, error) {
+	movies, err := inBatches(db, &models.Movie{}, cfg.BatchSize, func(ids []uint) error {
+		return ComputeItems(db, ids, cfg)
+	})
+	if err != nil {
+		return movies, 0, err
+	}
+	users, err := inBatches(db, &models.User{}, cfg.BatchSize, func(ids []uint) error {
+		return ComputeUsers(db, ids, cfg)
+	})
+	return movies, users, err
+}
+
+// inBatches walks the ids of model's table with a keyset, one fn call per batch.
+func inBatches(db *gorm.DB, model interface{}, size int, fn func([]uint) error) (int, error) {
+	var lastID uint
+	done := 0
+	for {
+		var ids []uint
+		if err := db.Model(model).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(size).
+			Pluck("id", &ids).Error; err != nil {
+			return done, err
+		}
+		if len(ids) == 0 {
+			return done, nil
+		}
+		if err := fn(ids); err != nil {
+			return done, err
+		}
+		done += len(ids)
+		lastID = ids[len(ids)-1]
+	}
+}
+
+func (cfg Config) args(extra map[string]interface{}) map[string]interface{} {
+	args := map[string]interface{}{
+		"liked":   cfg.Liked,
+		"later":   cfg.WatchLater,
+		"watched": cfg.Watched,
+		"listed":  cfg.Listed,
+	}
+	for k, v := range extra {
+		args[k] = v
+	}
+	return args
+}
+
+// ComputeItems replaces the stored collaborative neighbours of movieIDs.
+func ComputeItems(db *gorm.DB, movieIDs []uint, cfg Config) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("movie_id IN ?", movieIDs).Delete(&models.ItemSimilarity{}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf(itemsSQL, fmt.Sprintf(affinitySQL, "", "")), cfg.args(map[string]interface{}{
+			"ids":        movieIDs,
+			"shrink":     cfg.Shrink,
+			"neighbours": cfg.Neighbours,
+		})).Error
+	})
+}
+
+// ComputeUsers replaces the stored recommendations of userIDs and marks them computed
+// (User.RecommendationsComputedAt), so an empty feed isn't redone on every read.
+func ComputeUsers(db *gorm.DB, userIDs []uint, cfg Config) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id IN ?", userIDs).Delete(&models.Recommendation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id IN ?", userIDs).
+			UpdateColumn("recommendations_computed_at", now).Error; err != nil {
+			return err
+		}
+		affinity := fmt.Sprintf(affinitySQL, "AND user_id IN @users", "AND pl.owner_id IN @users")
+		return tx.Exec(fmt.Sprintf(usersSQL, affinity), cfg.args(map[string]interface{}{
+			"users":      userIDs,
+			"damping":    cfg.Damping,
+			"follow":     cfg.Follow,
+			"follow_min": cfg.FollowMin,
+			"keep":       cfg.Keep,
+			"now":        now,
+		})).Error
+	})
+}
+
+// affinitySQL is one row per (user, movie) the user has an opinion on; a review wins over
+// playlists, the strongest playlist over the others. %[1]s and %[2]s narrow it to some users.
+const affinitySQL = `
+	SELECT DISTINCT ON (user_id, movie_id) user_id, movie_id, a FROM (
+		SELECT user_id, movie_id, (rating - 5.5) / 4.5 AS a, 0 AS src
+		FROM reviews WHERE deleted_at IS NULL %[1]s
+		UNION ALL
+		SELECT pl.owner_id, pm.movie_id,
+			CASE pl.kind WHEN 'liked' THEN @liked WHEN 'watchlist' THEN @later
+				WHEN 'watched' THEN @watched ELSE @listed END, 1
+		FROM playlist_movies pm
+		JOIN playlists pl ON pl.id = pm.playlist_id AND pl.deleted_at IS NULL %[2]s
+	) x
+	ORDER BY user_id, movie_id, src, a DESC`
+
+const itemsSQL = `
+	WITH aff AS (%s),
+	norms AS (
+		SELECT movie_id, sqrt(SUM(a * a)) AS n FROM aff GROUP BY movie_id
+	),
+	pairs AS (
+		SELECT a1.movie_id, a2.movie_id AS other_id, SUM(a1.a * a2.a) AS dot, COUNT(*) AS support
+		FROM aff a1
+		JOIN aff a2 ON a2.user_id = a1.user_id AND a2.movie_id <> a1.movie_id
+		WHERE a1.movie_id IN @ids
+		GROUP BY a1.movie_id, a2.movie_id
+	),
+	scored AS (
+		SELECT p.movie_id, p.other_id, p.support,
+			p.dot / (n1.n * n2.n) * p.support / (p.support + @shrink) AS score
+		FROM pairs p
+		JOIN norms n1 ON n1.movie_id = p.movie_id
+		JOIN norms n2 ON n2.movie_id = p.other_id
+		JOIN movies m ON m.id = p.other_id AND m.deleted_at IS NULL
+		WHERE n1.n > 0 AND n2.n > 0
+	),
+	ranked AS (
+		SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY score DESC, other_id) AS rn
+		FROM scored WHERE score > 0
+	)
+	INSERT INTO item_similarities (movie_id, other_id, score, support)
+	SELECT movie_id, other_id, score, support FROM ranked WHERE rn <= @neighbours`
+
+const usersSQL = `
+	WITH aff AS (%s),
+	cand AS (
+		SELECT a.user_id, s.other_id AS movie_id,
+			SUM(s.score * a.a) AS cf, SUM(s.score) AS weight,
+			(array_agg(a.movie_id ORDER BY s.score * a.a DESC, a.movie_id))[1] AS because_id
+		FROM aff a
+		JOIN item_similarities s ON s.movie_id = a.movie_id
+		WHERE a.a > 0
+		GROUP BY a.user_id, s.other_id
+	),
+	followed AS (
+		SELECT f.follower_id AS user_id, r.movie_id, COUNT(*) AS n, AVG(r.rating) AS avg_rating
+		FROM follows f
+		JOIN reviews r ON r.user_id = f.followed_id AND r.deleted_at IS NULL AND r.rating >= @follow_min
+		WHERE f.follower_id IN @users AND f.deleted_at IS NULL
+		GROUP BY f.follower_id, r.movie_id
+	),
+	scored AS (
+		SELECT COALESCE(c.user_id, fo.user_id) AS user_id, COALESCE(c.movie_id, fo.movie_id) AS movie_id,
+			COALESCE(c.cf / (c.weight + @damping), 0)
+				+ COALESCE(ln(1 + fo.n) * (fo.avg_rating - 5.5) / 4.5, 0) * @follow AS score,
+			c.because_id, COALESCE(fo.n, 0) AS followed
+		FROM cand c
+		FULL JOIN followed fo ON fo.user_id = c.user_id AND fo.movie_id = c.movie_id
+	),
+	ranked AS (
+		SELECT s.*, row_number() OVER (PARTITION BY s.user_id ORDER BY s.score DESC, s.movie_id) AS rn
+		FROM scored s
+		JOIN movies m ON m.id = s.movie_id AND m.deleted_at IS NULL
+		WHERE s.score > 0
+			AND NOT EXISTS (SELECT 1 FROM aff x WHERE x.user_id = s.user_id AND x.movie_id = s.movie_id)
+	)
+	INSERT INTO recommendations (user_id, movie_id, score, because_id, followed_count, computed_at)
+	SELECT user_id, movie_id, score, because_id, followed, @now FROM ranked WHERE rn <= @keep`
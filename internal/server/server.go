@@ -5,7 +5,15 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"totallyguysproject/internal/enrich"
 	"totallyguysproject/internal/handlers"
+	"totallyguysproject/internal/provider"
+	"totallyguysproject/internal/posters"
+	"totallyguysproject/internal/reactions"
+	"totallyguysproject/internal/recommend"
+	"totallyguysproject/internal/similar"
+	"totallyguysproject/internal/smart"
+	"totallyguysproject/internal/trending"
 	"totallyguysproject/internal/utils"
 	"totallyguysproject/internal/ws"
 
@@ -68,9 +76,25 @@ func NewServer(db *gorm.DB) *Server {
 		AllowCredentials: true,
 	}))
 	ws.StartNotificationCleanup(db) //deletes checked notifications every hour
+
+	// movie metadata source, real OMDb calls go through the db cache
+	movieSource := provider.FromEnv()
+	if movieSource.Name() != "fake" {
+		movieSource = provider.NewCached(db, movieSource)
+		provider.StartCacheCleanup(db) //deletes expired cache rows every hour
+	}
+	handlers.SetMovieProvider(movieSource)
+	enrich.Start(db, movieSource, enrich.DefaultConfig()) //fills incomplete movies in background
+	similar.Start(db, similar.DefaultConfig())            //rebuilds movie_similarities daily
+	recommend.Start(db, recommend.DefaultConfig())        //per-user recommendation feeds
+	trending.Start(db, trending.DefaultConfig())          //trending snapshots every 15 minutes
+	posters.Start(db, posters.DefaultConfig())            //mirrors posters into /app/uploads/posters
+	smart.Start(db, smart.DefaultConfig())                //smart playlist contents
+	reactions.Start(db, hub, reactions.DefaultConfig())   //batched review reaction notifications
 	// web static (legacy static content)
 	r.Static("/legacy", "./public/legacy/web")
 	r.Static("/uploads", "/app/uploads")
+	r.GET("/media/posters/:id/:size", func(c *gin.Context) { handlers.GetPoster(c, db) })
 
 	// next js host
 	nextURL, _ := url.Parse("http://localhost:3000")
@@ -167,22 +191,31 @@ func NewServer(db *gorm.DB) *Server {
 		admin.POST("/users/:id/unban", func(c *gin.Context) {
 			handlers.AdminUnbanUser(c, hub)
 		})
+		admin.GET("/provider/cache", handlers.AdminGetProviderCacheStats)
+		admin.PUT("/movies/:id", func(c *gin.Context) { handlers.AdminUpdateMovie(c, db) })
+		admin.POST("/movies/:id/merge", func(c *gin.Context) { handlers.AdminMergeMovies(c, db) })
 
 		// Movies
 		movies := api.Group("/movies")
 		movies.Use(handlers.AuthMiddleware(false))
 		{
-			movies.POST("/:id/like", func(c *gin.Context) { handlers.LikeMovie(c, db) })
+			movies.POST("/:id/like", func(c *gin.Context) { handlers.LikeMovie(c, db, hub) })
 			movies.DELETE("/:id/like", func(c *gin.Context) { handlers.UnlikeMovie(c, db) })
 
 			// Reviews on moviepage
 
 			movies.POST("/:id/reviews", func(c *gin.Context) { handlers.CreateReview(c, db, hub) })
 		}
+		api.GET("/movies", func(c *gin.Context) { handlers.DiscoverMovies(c, db) })
 		api.GET("movies/load-by-genre", func(c *gin.Context) { handlers.LoadMoviesByGenre(c, db) })
+		api.GET("/genres", func(c *gin.Context) { handlers.ListGenres(c, db) })
 		api.GET("movies/:id/reviews", func(c *gin.Context) { handlers.GetReviewsForMovie(c, db) })
 		api.GET("/movies/search", func(c *gin.Context) { handlers.SearchAndSaveMovie(c, db) })
+		api.GET("/movies/trending", func(c *gin.Context) { handlers.GetTrendingMovies(c, db) })
 		api.GET("/movies/:id", func(c *gin.Context) { handlers.GetMovie(c, db) })
+		api.GET("/movies/:id/similar", func(c *gin.Context) { handlers.GetSimilarMovies(c, db) })
+		api.GET("/people/search", func(c *gin.Context) { handlers.SearchPeople(c, db) })
+		api.GET("/people/:id", func(c *gin.Context) { handlers.GetPerson(c, db) })
 
 		reviews := api.Group("/reviews")
 		reviews.Use(handlers.AuthMiddleware(false))
@@ -194,6 +227,10 @@ func NewServer(db *gorm.DB) *Server {
 			//comments nested under reviews
 			reviews.GET("/:id/comments", func(c *gin.Context) { handlers.GetCommentsForReview(c, db) })
 			reviews.POST("/:id/comments", func(c *gin.Context) { handlers.CreateComment(c, db) })
+
+			//reactions (helpful, funny, ...)
+			reviews.POST("/:id/reactions", func(c *gin.Context) { handlers.AddReviewReaction(c, db) })
+			reviews.DELETE("/:id/reactions/:type", func(c *gin.Context) { handlers.RemoveReviewReaction(c, db) })
 		}
 		// comments
 		comments := api.Group("/comments")
@@ -231,7 +268,25 @@ func NewServer(db *gorm.DB) *Server {
 				userAuth.POST("/me/playlists/:playlist_id/cover", func(c *gin.Context) { handlers.UploadPlaylistCover(c, db) })
 				userAuth.DELETE("/me/playlists/:playlist_id/cover", func(c *gin.Context) { handlers.DeletePlaylistCover(c, db) })
 				userAuth.GET("/me/playlists", func(c *gin.Context) { handlers.GetMyPlaylists(c, db) })
+				userAuth.GET("/me/invites", func(c *gin.Context) { handlers.GetMyPlaylistInvites(c, db) })
+				userAuth.GET("/me/subscriptions", func(c *gin.Context) { handlers.GetMySubscriptions(c, db) })
 				userAuth.GET("/me/reviews", func(c *gin.Context) { handlers.GetMyReviews(c, db) })
+				userAuth.GET("/me/recommendations", func(c *gin.Context) { handlers.GetMyRecommendations(c, db) })
+				// watch diary, keeps the "watched" playlist in sync
+				userAuth.GET("/me/diary", func(c *gin.Context) { handlers.GetMyDiary(c, db) })
+				userAuth.POST("/me/diary", func(c *gin.Context) { handlers.CreateDiaryEntry(c, db, hub) })
+				userAuth.PUT("/me/diary/:entry_id", func(c *gin.Context) { handlers.UpdateDiaryEntry(c, db) })
+				userAuth.DELETE("/me/diary/:entry_id", func(c *gin.Context) { handlers.DeleteDiaryEntry(c, db) })
+				userAuth.GET("/me/diary/calendar", func(c *gin.Context) { handlers.GetDiaryCalendar(c, db) })
+				userAuth.GET("/me/diary/years", func(c *gin.Context) { handlers.GetDiaryYears(c, db) })
+				userAuth.GET("/me/diary/years/:year", func(c *gin.Context) { handlers.GetDiaryYear(c, db) })
+
+				// Letterboxd / IMDb import and export
+				userAuth.POST("/me/import/letterboxd", func(c *gin.Context) { handlers.ImportLetterboxd(c, db, hub) })
+				userAuth.POST("/me/import/imdb", func(c *gin.Context) { handlers.ImportIMDb(c, db, hub) })
+				userAuth.GET("/me/imports", func(c *gin.Context) { handlers.GetMyImports(c, db) })
+				userAuth.GET("/me/imports/:import_id/report", func(c *gin.Context) { handlers.GetImportReport(c, db) })
+				userAuth.GET("/me/export", func(c *gin.Context) { handlers.ExportMyData(c, db) })
 
 				// follow/unfollow other users
 				userAuth.GET("/me/followers", func(c *gin.Context) { handlers.GetMyFollowers(c, db) })
@@ -243,25 +298,39 @@ func NewServer(db *gorm.DB) *Server {
 			}
 		}
 
-		api.GET("/users/:id/playlists", func(c *gin.Context) { handlers.GetUserPlaylists(c, db) })
+		api.GET("/users/:id/playlists", handlers.AuthMiddleware(true), func(c *gin.Context) { handlers.GetUserPlaylists(c, db) })
 		//other users search (no jwt)
 		api.GET("/users/search", func(c *gin.Context) { handlers.SearchUsers(c, db) })
-		api.GET("/users/:id", func(c *gin.Context) { handlers.GetProfile(c, db) })
+		api.GET("/users/:id", handlers.AuthMiddleware(true), func(c *gin.Context) { handlers.GetProfile(c, db) })
 
 		// playlists
 		playlist := api.Group("/playlists")
 		playlist.Use(handlers.AuthMiddleware(false))
 		{
 			playlist.POST("", func(c *gin.Context) { handlers.CreatePlaylist(c, db) })
-			playlist.POST("/:id/add", func(c *gin.Context) { handlers.AddMovieToPlaylist(c, db) })
+			playlist.POST("/bulk", func(c *gin.Context) { handlers.BulkPlaylistOps(c, db, hub) })
+			playlist.PATCH("/:id", func(c *gin.Context) { handlers.UpdatePlaylist(c, db, hub) })
+			playlist.POST("/:id/add", func(c *gin.Context) { handlers.AddMovieToPlaylist(c, db, hub) })
 			playlist.DELETE("/:id", func(c *gin.Context) { handlers.DeletePlaylist(c, db) })
-			playlist.DELETE("/:id/movies/:movie_id", func(c *gin.Context) { handlers.RemoveMovieFromPlaylist(c, db) })
-			playlist.PUT("/:id/movies/:movie_id/description", func(c *gin.Context) { handlers.UpdateMovieDescriptionInPlaylist(c, db) })
+			playlist.DELETE("/:id/movies/:movie_id", func(c *gin.Context) { handlers.RemoveMovieFromPlaylist(c, db, hub) })
+			playlist.PUT("/:id/movies/:movie_id/description", func(c *gin.Context) { handlers.UpdateMovieDescriptionInPlaylist(c, db, hub) })
+			playlist.PUT("/:id/order", func(c *gin.Context) { handlers.ReorderPlaylist(c, db, hub) })
+			playlist.PUT("/:id/visibility", func(c *gin.Context) { handlers.SetPlaylistVisibility(c, db) })
+			playlist.POST("/:id/share-token", func(c *gin.Context) { handlers.RotatePlaylistShareToken(c, db) })
+			playlist.PUT("/:id/rules", func(c *gin.Context) { handlers.UpdatePlaylistRules(c, db) })
+			playlist.POST("/:id/fork", func(c *gin.Context) { handlers.ForkPlaylist(c, db, hub) })
+			playlist.POST("/:id/subscribe", func(c *gin.Context) { handlers.SubscribePlaylist(c, db) })
+			playlist.DELETE("/:id/subscribe", func(c *gin.Context) { handlers.UnsubscribePlaylist(c, db) })
+			// collaborators: invite, accept, leave
+			playlist.GET("/:id/collaborators", func(c *gin.Context) { handlers.GetPlaylistCollaborators(c, db) })
+			playlist.POST("/:id/collaborators", func(c *gin.Context) { handlers.InviteCollaborator(c, db, hub) })
+			playlist.POST("/:id/collaborators/accept", func(c *gin.Context) { handlers.AcceptPlaylistInvite(c, db, hub) })
+			playlist.DELETE("/:id/collaborators/:user_id", func(c *gin.Context) { handlers.RemoveCollaborator(c, db) })
 
 			//playlist.POST("/:id/cover", func(c *gin.Context) { handlers.UploadPlaylistCover(c, db) }) // l8r
 
 		}
-		api.GET("playlists/:id", func(c *gin.Context) { handlers.GetPlaylist(c, db) })
+		api.GET("playlists/:id", handlers.AuthMiddleware(true), func(c *gin.Context) { handlers.GetPlaylist(c, db) })
 
 	}
 
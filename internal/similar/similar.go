@@ -0,0 +1,181 @@
+// Package similar precomputes the neighbours of every movie into movie_similarities.
+//
+// A neighbour scores for shared directors and cast (movie_credits), shared genres
+// (movie_genres), being in the same playlists and being liked by the same users
+// ("liked" playlists). Candidates come from the people and playlist signals plus
+// the best-voted movies of each genre, so a rebuild never compares every pair.
+package similar
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	Interval  time.Duration // time between full rebuilds
+	BatchSize int           // movies per statement
+	Keep      int           // neighbours stored per movie
+	GenreTop  int           // best-voted movies per genre used as genre-only candidates
+
+	// score weights
+	Director float64
+	Cast     float64
+	Genre    float64
+	Playlist float64 // applied to ln(1 + co_playlists)
+	Like     float64 // applied to ln(1 + co_likes)
+}
+
+// DefaultConfig reads SIMILAR_INTERVAL (a Go duration, default 24h), the rest is fixed.
+func DefaultConfig() Config {
+	cfg := Config{
+		Interval:  24 * time.Hour,
+		BatchSize: 500,
+		Keep:      20,
+		GenreTop:  200,
+		Director:  3,
+		Cast:      1,
+		Genre:     0.5,
+		Playlist:  1,
+		Like:      2,
+	}
+	if d, err := time.ParseDuration(os.Getenv("SIMILAR_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	return cfg
+}
+
+// Start rebuilds all similarities now and then every cfg.Interval.
+func Start(db *gorm.DB, cfg Config) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			start := time.Now()
+			if n, err := Rebuild(db, cfg); err != nil {
+				fmt.Println("similar rebuild failed:", err)
+			} else {
+				fmt.Printf("similar: rebuilt %d movies in %s\n", n, time.Since(start).Round(time.Millisecond))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Rebuild recomputes every movie in id order, one batch per transaction, and returns how many it did.
+func Rebuild(db *gorm.DB, cfg Config) (int, error) {
+	var lastID uint
+	done := 0
+	for {
+		var ids []uint
+		if err := db.Model(&models.Movie{}).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(cfg.BatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return done, err
+		}
+		if len(ids) == 0 {
+			return done, nil
+		}
+		if err := Compute(db, ids, cfg); err != nil {
+			return done, err
+		}
+		done += len(ids)
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// Compute replaces the stored neighbours of movieIDs and marks them computed
+// (Movie.SimilarComputedAt), so a movie without neighbours isn't redone until the next rebuild.
+func Compute(db *gorm.DB, movieIDs []uint, cfg Config) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("movie_id IN ?", movieIDs).Delete(&models.MovieSimilarity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Movie{}).Where("id IN ?", movieIDs).
+			UpdateColumn("similar_computed_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Exec(computeSQL, map[string]interface{}{
+			"ids":       movieIDs,
+			"keep":      cfg.Keep,
+			"genre_top": cfg.GenreTop,
+			"director":  cfg.Director,
+			"cast":      cfg.Cast,
+			"genre":     cfg.Genre,
+			"playlist":  cfg.Playlist,
+			"like":      cfg.Like,
+			"now":       now,
+		}).Error
+	})
+}
+
+const computeSQL = `
+	WITH src AS (
+		SELECT id FROM movies WHERE id IN @ids
+	),
+	genre_top AS (
+		SELECT genre_id, movie_id FROM (
+			SELECT mg.genre_id, mg.movie_id,
+				row_number() OVER (PARTITION BY mg.genre_id ORDER BY m.votes DESC, m.id) AS rn
+			FROM movie_genres mg JOIN movies m ON m.id = mg.movie_id AND m.deleted_at IS NULL
+		) t WHERE rn <= @genre_top
+	),
+	cand AS (
+		SELECT s.id AS movie_id, c2.movie_id AS similar_id,
+			COUNT(*) FILTER (WHERE c1.role = 'director') AS directors,
+			COUNT(*) FILTER (WHERE c1.role = 'actor') AS cast_members,
+			0 AS playlists, 0 AS likes
+		FROM src s
+		JOIN movie_credits c1 ON c1.movie_id = s.id
+		JOIN movie_credits c2 ON c2.person_id = c1.person_id AND c2.role = c1.role AND c2.movie_id <> s.id
+		GROUP BY s.id, c2.movie_id
+		UNION ALL
+		SELECT s.id, p2.movie_id, 0, 0,
+			COUNT(*) FILTER (WHERE pl.kind <> 'liked'),
+			COUNT(*) FILTER (WHERE pl.kind = 'liked')
+		FROM src s
+		JOIN playlist_movies p1 ON p1.movie_id = s.id
+		JOIN playlists pl ON pl.id = p1.playlist_id AND pl.deleted_at IS NULL
+		JOIN playlist_movies p2 ON p2.playlist_id = p1.playlist_id AND p2.movie_id <> s.id
+		GROUP BY s.id, p2.movie_id
+		UNION ALL
+		SELECT DISTINCT s.id, gt.movie_id, 0, 0, 0, 0
+		FROM src s
+		JOIN movie_genres mg ON mg.movie_id = s.id
+		JOIN genre_top gt ON gt.genre_id = mg.genre_id AND gt.movie_id <> s.id
+	),
+	agg AS (
+		SELECT movie_id, similar_id,
+			SUM(directors) AS directors, SUM(cast_members) AS cast_members,
+			SUM(playlists) AS playlists, SUM(likes) AS likes
+		FROM cand GROUP BY movie_id, similar_id
+	),
+	scored AS (
+		SELECT a.*, g.shared AS genres,
+			a.directors * @director + a.cast_members * @cast + g.shared * @genre
+				+ ln(1 + a.playlists) * @playlist + ln(1 + a.likes) * @like AS score
+		FROM agg a
+		JOIN movies m ON m.id = a.similar_id AND m.deleted_at IS NULL
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS shared FROM movie_genres g1
+			JOIN movie_genres g2 ON g2.genre_id = g1.genre_id AND g2.movie_id = a.similar_id
+			WHERE g1.movie_id = a.movie_id
+		) g
+	),
+	ranked AS (
+		SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY score DESC, similar_id) AS rn
+		FROM scored WHERE score > 0
+	)
+	INSERT INTO movie_similarities
+		(movie_id, similar_id, score, shared_genres, shared_directors, shared_cast, co_playlists, co_likes, computed_at)
+	SELECT movie_id, similar_id, score, genres, directors, cast_members, playlists, likes, @now
+	FROM ranked WHERE rn <= @keep`
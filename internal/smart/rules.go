@@ -0,0 +1,273 @@
+package smart
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 500
+	MaxRules     = 20
+)
+
+// rating and year are strings on movies, same reading as the movie lists in handlers
+const (
+	ratingExpr = "NULLIF(NULLIF(movies.rating, ''), 'N/A')::numeric"
+	yearExpr   = "NULLIF(substring(movies.year from '^[0-9]{4}'), '')::int"
+)
+
+var compareOps = map[string]string{
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+	"eq":  "=",
+}
+
+// sorts maps SmartRules.Sort to an ORDER BY
+var sorts = map[string]string{
+	"rating":     ratingExpr + " DESC NULLS LAST",
+	"avg_rating": "movies.avg_rating DESC",
+	"year":       yearExpr + " DESC NULLS LAST",
+	"votes":      "movies.votes DESC",
+	"title":      "movies.title",
+}
+
+// field is a rule field: the ops it accepts, how its value is read, and how op and value
+// become a condition for the playlist owner.
+type field struct {
+	ops   []string
+	value func(interface{}) (interface{}, error)
+	build func(op string, owner uint, v interface{}) (string, []interface{})
+}
+
+func text(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || strings.TrimSpace(s) == "" {
+		return nil, errors.New("needs a text value")
+	}
+	return "%" + strings.TrimSpace(s) + "%", nil
+}
+
+func number(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, errors.New("needs a number value")
+}
+
+// listRef is a playlist rule's value read: a system playlist by kind or any playlist by id.
+type listRef struct {
+	kind string
+	id   uint
+}
+
+var systemKinds = map[string]bool{
+	models.PlaylistWatchlist: true,
+	models.PlaylistWatched:   true,
+	models.PlaylistLiked:     true,
+}
+
+// playlistRef reads {"kind": "watched"} (or just "watched") for a system playlist and
+// a playlist id for the others. Names are not looked at, anyone can call a list "watched".
+func playlistRef(v interface{}) (interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["kind"]
+	}
+	switch p := v.(type) {
+	case string:
+		p = strings.TrimSpace(p)
+		if systemKinds[p] {
+			return listRef{kind: p}, nil
+		}
+		if id, err := strconv.ParseUint(p, 10, 64); err == nil && id > 0 {
+			return listRef{id: uint(id)}, nil
+		}
+	case float64:
+		if p > 0 && p == float64(uint(p)) {
+			return listRef{id: uint(p)}, nil
+		}
+	}
+	return nil, errors.New(`needs {"kind": "watchlist|watched|liked"} or a playlist id`)
+}
+
+func textField(column string) field {
+	return field{
+		ops:   []string{"contains", "not_contains"},
+		value: text,
+		build: func(op string, _ uint, v interface{}) (string, []interface{}) {
+			if op == "not_contains" {
+				return fmt.Sprintf("COALESCE(%s, '') NOT ILIKE ?", column), []interface{}{v}
+			}
+			return fmt.Sprintf("%s ILIKE ?", column), []interface{}{v}
+		},
+	}
+}
+
+func numberField(expr string) field {
+	return field{
+		ops:   []string{"lt", "lte", "gt", "gte", "eq"},
+		value: number,
+		build: func(op string, _ uint, v interface{}) (string, []interface{}) {
+			return fmt.Sprintf("%s %s ?", expr, compareOps[op]), []interface{}{v}
+		},
+	}
+}
+
+var fields = map[string]field{
+	"genre":    textField("movies.genre"),
+	"director": textField("movies.director"),
+	"actor":    textField("movies.actors"),
+	"title":    textField("movies.title"),
+	"year":     numberField(yearExpr),
+	"rating":   numberField(ratingExpr),
+	"avg_rating": {
+		ops:   []string{"lt", "lte", "gt", "gte", "eq"},
+		value: number,
+		build: func(op string, _ uint, v interface{}) (string, []interface{}) {
+			return fmt.Sprintf("movies.review_count > 0 AND movies.avg_rating %s ?", compareOps[op]), []interface{}{v}
+		},
+	},
+
+	// in one of the owner's own (manual) playlists, by kind (watchlist, watched, liked) or id
+	"playlist": {
+		ops:   []string{"in", "not_in"},
+		value: playlistRef,
+		build: func(op string, owner uint, v interface{}) (string, []interface{}) {
+			ref := v.(listRef)
+			match, arg := "pl.id = ?", interface{}(ref.id)
+			if ref.kind != "" {
+				match, arg = "pl.kind = ?", ref.kind
+			}
+			cond := `EXISTS (SELECT 1 FROM playlist_movies pm
+				JOIN playlists pl ON pl.id = pm.playlist_id AND pl.deleted_at IS NULL
+				WHERE pm.movie_id = movies.id AND pl.owner_id = ? AND ` + match + `)`
+			if op == "not_in" {
+				cond = "NOT " + cond
+			}
+			return cond, []interface{}{owner, arg}
+		},
+	},
+
+	// the owner's own review; "none" (any value) keeps movies they have not reviewed
+	"my_rating": {
+		ops: []string{"lt", "lte", "gt", "gte", "eq", "none"},
+		value: func(v interface{}) (interface{}, error) {
+			if v == nil {
+				return nil, nil
+			}
+			return number(v)
+		},
+		build: func(op string, owner uint, v interface{}) (string, []interface{}) {
+			if op == "none" {
+				return `NOT EXISTS (SELECT 1 FROM reviews r
+					WHERE r.movie_id = movies.id AND r.user_id = ? AND r.deleted_at IS NULL)`, []interface{}{owner}
+			}
+			return fmt.Sprintf(`EXISTS (SELECT 1 FROM reviews r
+				WHERE r.movie_id = movies.id AND r.user_id = ? AND r.deleted_at IS NULL AND r.rating %s ?)`,
+				compareOps[op]), []interface{}{owner, v}
+		},
+	},
+
+	// rated by at least one person the owner follows
+	"followed_rating": {
+		ops:   []string{"lt", "lte", "gt", "gte", "eq"},
+		value: number,
+		build: func(op string, owner uint, v interface{}) (string, []interface{}) {
+			return fmt.Sprintf(`EXISTS (SELECT 1 FROM reviews r
+				JOIN follows f ON f.followed_id = r.user_id AND f.deleted_at IS NULL
+				WHERE f.follower_id = ? AND r.movie_id = movies.id AND r.deleted_at IS NULL AND r.rating %s ?)`,
+				compareOps[op]), []interface{}{owner, v}
+		},
+	},
+}
+
+func allows(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks rules and fills in the defaults (match all, sort by rating, DefaultLimit).
+func Validate(rules *models.SmartRules) error {
+	if rules == nil || len(rules.Rules) == 0 {
+		return errors.New("at least one rule required")
+	}
+	if len(rules.Rules) > MaxRules {
+		return fmt.Errorf("at most %d rules", MaxRules)
+	}
+	switch rules.Match {
+	case "":
+		rules.Match = "all"
+	case "all", "any":
+	default:
+		return errors.New("match must be all or any")
+	}
+	if rules.Sort == "" {
+		rules.Sort = "rating"
+	}
+	if _, ok := sorts[rules.Sort]; !ok {
+		return errors.New("sort must be rating, avg_rating, year, votes or title")
+	}
+	if rules.Limit <= 0 {
+		rules.Limit = DefaultLimit
+	}
+	if rules.Limit > MaxLimit {
+		rules.Limit = MaxLimit
+	}
+	for i, r := range rules.Rules {
+		f, ok := fields[r.Field]
+		if !ok {
+			return fmt.Errorf("rule %d: unknown field %q", i+1, r.Field)
+		}
+		if !allows(f.ops, r.Op) {
+			return fmt.Errorf("rule %d: %s takes %s", i+1, r.Field, strings.Join(f.ops, ", "))
+		}
+		if r.Op == "none" {
+			continue
+		}
+		if _, err := f.value(r.Value); err != nil {
+			return fmt.Errorf("rule %d: %s %w", i+1, r.Field, err)
+		}
+	}
+	return nil
+}
+
+// Matches is the query for the movie ids a playlist's rules select, best first.
+// rules must have passed Validate.
+func Matches(db *gorm.DB, owner uint, rules *models.SmartRules) *gorm.DB {
+	var conds []string
+	var args []interface{}
+	for _, r := range rules.Rules {
+		f := fields[r.Field]
+		v, _ := f.value(r.Value)
+		cond, condArgs := f.build(r.Op, owner, v)
+		conds = append(conds, "("+cond+")")
+		args = append(args, condArgs...)
+	}
+	join := " AND "
+	if rules.Match == "any" {
+		join = " OR "
+	}
+	return db.Model(&models.Movie{}).
+		Select("movies.id").
+		Where(strings.Join(conds, join), args...).
+		Order(sorts[rules.Sort] + ", movies.id").
+		Limit(rules.Limit)
+}
@@ -0,0 +1,156 @@
+// Package smart computes smart playlists: playlists whose movies come from saved rules
+// (models.SmartRules) instead of manual adds.
+//
+// Every rule is one condition on a movie: its catalog columns (genre, year, rating, ...),
+// the owner's own reviews and playlists, or the reviews of the people the owner follows.
+// Matches are cached in smart_playlist_movies. Handlers report the owners whose inputs
+// changed with Enqueue; their playlists are refreshed on the next flush, and everything
+// is refreshed every Interval to pick up catalog changes.
+package smart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Config struct {
+	Interval   time.Duration // time between full refreshes
+	FlushEvery time.Duration // how often queued owners are refreshed
+}
+
+// DefaultConfig reads SMART_INTERVAL (a Go duration, default 1h).
+func DefaultConfig() Config {
+	cfg := Config{
+		Interval:   time.Hour,
+		FlushEvery: 30 * time.Second,
+	}
+	if d, err := time.ParseDuration(os.Getenv("SMART_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	return cfg
+}
+
+var queue chan []uint
+
+// Start refreshes every smart playlist every cfg.Interval and, in between, the playlists
+// of the owners Enqueue reported, every cfg.FlushEvery.
+func Start(db *gorm.DB, cfg Config) {
+	queue = make(chan []uint, 256)
+	go func() {
+		full := time.NewTicker(cfg.Interval)
+		flush := time.NewTicker(cfg.FlushEvery)
+		defer full.Stop()
+		defer flush.Stop()
+
+		owners := map[uint]bool{}
+		for {
+			select {
+			case ids := <-queue:
+				for _, id := range ids {
+					owners[id] = true
+				}
+			case <-flush.C:
+				if len(owners) == 0 {
+					continue
+				}
+				ids := make([]uint, 0, len(owners))
+				for id := range owners {
+					ids = append(ids, id)
+				}
+				if _, err := RefreshOwners(db, ids); err != nil {
+					fmt.Println("smart: refresh failed:", err)
+				}
+				owners = map[uint]bool{}
+			case <-full.C:
+				n, err := RefreshOwners(db, nil)
+				if err != nil {
+					fmt.Println("smart: full refresh failed for some playlists:", err)
+				}
+				fmt.Printf("smart: refreshed %d playlists\n", n)
+			}
+		}
+	}()
+}
+
+// Enqueue reports that the reviews, playlists or follows of these users changed.
+// Never blocks; a full queue waits for the next full refresh.
+func Enqueue(userIDs ...uint) {
+	if queue == nil || len(userIDs) == 0 {
+		return
+	}
+	select {
+	case queue <- userIDs:
+	default:
+	}
+}
+
+// RefreshOwners refreshes the smart playlists of these owners, all of them for nil.
+// A playlist that fails doesn't stop the others; it returns how many playlists it
+// refreshed and the failures joined.
+func RefreshOwners(db *gorm.DB, ownerIDs []uint) (int, error) {
+	query := db.Where("rules IS NOT NULL")
+	if ownerIDs != nil {
+		query = query.Where("owner_id IN ?", ownerIDs)
+	}
+	var playlists []models.Playlist
+	if err := query.Order("id").Find(&playlists).Error; err != nil {
+		return 0, err
+	}
+	var errs []error
+	refreshed := 0
+	for i := range playlists {
+		if err := Refresh(db, &playlists[i]); err != nil {
+			errs = append(errs, fmt.Errorf("playlist %d: %w", playlists[i].ID, err))
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, errors.Join(errs...)
+}
+
+// Refresh recomputes one smart playlist. Movies that still match keep their AddedAt.
+func Refresh(db *gorm.DB, playlist *models.Playlist) error {
+	if playlist.Rules == nil {
+		return nil
+	}
+	rules := *playlist.Rules
+	if err := Validate(&rules); err != nil {
+		return err
+	}
+
+	var ids []uint
+	if err := Matches(db, playlist.OwnerID, &rules).Pluck("movies.id", &ids).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("playlist_id = ?", playlist.ID)
+		if len(ids) > 0 {
+			stale = stale.Where("movie_id NOT IN ?", ids)
+		}
+		if err := stale.Delete(&models.SmartPlaylistMovie{}).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			rows := make([]models.SmartPlaylistMovie, len(ids))
+			for i, id := range ids {
+				rows[i] = models.SmartPlaylistMovie{PlaylistID: playlist.ID, MovieID: id, Position: i + 1, AddedAt: now}
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "playlist_id"}, {Name: "movie_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"position"}),
+			}).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		playlist.RefreshedAt = &now
+		return tx.Model(playlist).UpdateColumn("refreshed_at", now).Error
+	})
+}
@@ -0,0 +1,240 @@
+package transfer
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// exported is a film line as the exports write it.
+type exported struct {
+	Title   string
+	Year    string
+	OMDBID  string
+	Rating  int
+	Content string
+	Rewatch bool
+	Day     *time.Time // watched_on, added_at, ...
+	Created time.Time
+	Note    string
+}
+
+func (e exported) year() string {
+	return yearRe.FindString(e.Year)
+}
+
+func (e exported) stars() string {
+	if e.Rating == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(e.Rating)/2, 'f', -1, 64)
+}
+
+func day(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return ""
+}
+
+type playlistRef struct {
+	ID          uint
+	Name        string
+	Kind        string
+	Description string
+	CreatedAt   time.Time
+}
+
+// exporter reads one user's history.
+type exporter struct {
+	db     *gorm.DB
+	userID uint
+}
+
+func (ex *exporter) reviews() ([]exported, error) {
+	var rows []exported
+	err := ex.db.Table("reviews").
+		Select("movies.title, movies.year, movies.omdb_id, reviews.rating, reviews.content, reviews.created_at AS created").
+		Joins("JOIN movies ON movies.id = reviews.movie_id AND movies.deleted_at IS NULL").
+		Where("reviews.user_id = ? AND reviews.deleted_at IS NULL", ex.userID).
+		Order("reviews.created_at").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (ex *exporter) diary() ([]exported, error) {
+	var rows []exported
+	err := ex.db.Table("diary_entries").
+		Select(`movies.title, movies.year, movies.omdb_id, reviews.rating, diary_entries.rewatch,
+			diary_entries.watched_on AS day, diary_entries.created_at AS created`).
+		Joins("JOIN movies ON movies.id = diary_entries.movie_id AND movies.deleted_at IS NULL").
+		Joins(`LEFT JOIN reviews ON reviews.user_id = diary_entries.user_id AND reviews.movie_id = diary_entries.movie_id
+			AND reviews.deleted_at IS NULL`).
+		Where("diary_entries.user_id = ? AND diary_entries.deleted_at IS NULL", ex.userID).
+		Order("diary_entries.watched_on, diary_entries.id").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (ex *exporter) playlist(id uint) ([]exported, error) {
+	var rows []exported
+	err := ex.db.Table("playlist_movies").
+		Select("movies.title, movies.year, movies.omdb_id, playlist_movies.added_at AS day, playlist_movies.description AS note").
+		Joins("JOIN movies ON movies.id = playlist_movies.movie_id AND movies.deleted_at IS NULL").
+		Where("playlist_movies.playlist_id = ?", id).
+		Order("playlist_movies.position NULLS LAST, playlist_movies.added_at NULLS FIRST, movies.id").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (ex *exporter) playlists() ([]playlistRef, error) {
+	var lists []playlistRef
+	err := ex.db.Table("playlists").
+		Select("id, name, kind, description, created_at").
+		Where("owner_id = ? AND deleted_at IS NULL", ex.userID).
+		Order("id").
+		Scan(&lists).Error
+	return lists, err
+}
+
+func writeCSV(w io.Writer, header []string, lines [][]string) error {
+	cw := csv.NewWriter(w)
+	if header != nil {
+		cw.Write(header)
+	}
+	cw.WriteAll(lines)
+	return cw.Error()
+}
+
+var slugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ExportLetterboxd writes the user's history as a Letterboxd-style export ZIP that
+// ParseLetterboxd reads back. Every file gets an extra imdbID column.
+func ExportLetterboxd(db *gorm.DB, userID uint, w io.Writer) error {
+	ex := &exporter{db: db, userID: userID}
+	zw := zip.NewWriter(w)
+
+	add := func(name string, header []string, lines [][]string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		return writeCSV(f, header, lines)
+	}
+
+	diary, err := ex.diary()
+	if err != nil {
+		return err
+	}
+	var lines [][]string
+	for _, e := range diary {
+		lines = append(lines, []string{day(&e.Created), e.Title, e.year(), "", e.stars(), yesNo(e.Rewatch), "", day(e.Day), e.OMDBID})
+	}
+	if err := add("diary.csv", []string{"Date", "Name", "Year", "Letterboxd URI", "Rating", "Rewatch", "Tags", "Watched Date", "imdbID"}, lines); err != nil {
+		return err
+	}
+
+	reviews, err := ex.reviews()
+	if err != nil {
+		return err
+	}
+	var rated, written [][]string
+	for _, e := range reviews {
+		rated = append(rated, []string{day(&e.Created), e.Title, e.year(), "", e.stars(), e.OMDBID})
+		if e.Content != "" {
+			written = append(written, []string{day(&e.Created), e.Title, e.year(), "", e.stars(), "", e.Content, "", "", e.OMDBID})
+		}
+	}
+	if err := add("ratings.csv", []string{"Date", "Name", "Year", "Letterboxd URI", "Rating", "imdbID"}, rated); err != nil {
+		return err
+	}
+	if err := add("reviews.csv", []string{"Date", "Name", "Year", "Letterboxd URI", "Rating", "Rewatch", "Review", "Tags", "Watched Date", "imdbID"}, written); err != nil {
+		return err
+	}
+
+	lists, err := ex.playlists()
+	if err != nil {
+		return err
+	}
+	files := map[string]string{
+		models.PlaylistWatched:   "watched.csv",
+		models.PlaylistWatchlist: "watchlist.csv",
+		models.PlaylistLiked:     "likes/films.csv",
+	}
+	used := map[string]bool{}
+	for _, list := range lists {
+		entries, err := ex.playlist(list.ID)
+		if err != nil {
+			return err
+		}
+		if name, ok := files[list.Kind]; ok {
+			var lines [][]string
+			for _, e := range entries {
+				lines = append(lines, []string{day(e.Day), e.Title, e.year(), "", e.OMDBID})
+			}
+			if err := add(name, []string{"Date", "Name", "Year", "Letterboxd URI", "imdbID"}, lines); err != nil {
+				return err
+			}
+			continue
+		}
+
+		slug := strings.Trim(slugRe.ReplaceAllString(strings.ToLower(list.Name), "-"), "-")
+		if slug == "" || used[slug] {
+			slug = fmt.Sprintf("%s-%d", slug, list.ID)
+		}
+		used[slug] = true
+		f, err := zw.Create("lists/" + slug + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := writeCSV(f, nil, [][]string{
+			{"Letterboxd list export v7"},
+			{"Date", "Name", "Tags", "URL", "Description"},
+			{day(&list.CreatedAt), list.Name, "", "", list.Description},
+			{""},
+		}); err != nil {
+			return err
+		}
+		lines := make([][]string, 0, len(entries))
+		for i, e := range entries {
+			lines = append(lines, []string{strconv.Itoa(i + 1), e.Title, e.year(), "", e.Note, e.OMDBID})
+		}
+		if err := writeCSV(f, []string{"Position", "Name", "Year", "URL", "Description", "imdbID"}, lines); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ExportIMDb writes the user's ratings in the IMDb ratings export layout.
+func ExportIMDb(db *gorm.DB, userID uint, w io.Writer) error {
+	ex := &exporter{db: db, userID: userID}
+	reviews, err := ex.reviews()
+	if err != nil {
+		return err
+	}
+	lines := make([][]string, 0, len(reviews))
+	for _, e := range reviews {
+		url := ""
+		if e.OMDBID != "" {
+			url = "https://www.imdb.com/title/" + e.OMDBID + "/"
+		}
+		lines = append(lines, []string{e.OMDBID, strconv.Itoa(e.Rating), day(&e.Created), e.Title, url, "Movie", e.year()})
+	}
+	return writeCSV(w, []string{"Const", "Your Rating", "Date Rated", "Title", "URL", "Title Type", "Year"}, lines)
+}
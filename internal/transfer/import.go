@@ -0,0 +1,276 @@
+package transfer
+
+import (
+	"errors"
+	"strings"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ratings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lookup finds a movie the catalog does not have yet (through the movie provider) and saves it.
+// It returns nil, nil when the provider does not know the film either.
+type Lookup func(imdbID, title, year string) (*models.Movie, error)
+
+// systemKinds are the system playlists (every user has one of each), by row kind.
+var systemKinds = map[string]string{
+	KindDiary:     models.PlaylistWatched,
+	KindWatched:   models.PlaylistWatched,
+	KindWatchlist: models.PlaylistWatchlist,
+	KindLiked:     models.PlaylistLiked,
+}
+
+// Importer writes parsed rows for one user. Re-importing the same file changes nothing:
+// reviews are updated in place, diary entries are unique per movie and day and
+// playlist entries per playlist and movie.
+type Importer struct {
+	db     *gorm.DB
+	userID uint
+	lookup Lookup
+
+	// MaxLookups caps provider calls per import; later unknown films are reported unmatched.
+	// Imports run inside the upload request, so every lookup is time the client waits.
+	MaxLookups int
+
+	lookups int
+	movies  map[string]*models.Movie // resolved rows by imdb id or title|year
+	touched map[uint]bool
+}
+
+func NewImporter(db *gorm.DB, userID uint, lookup Lookup) *Importer {
+	return &Importer{
+		db:         db,
+		userID:     userID,
+		lookup:     lookup,
+		MaxLookups: 50,
+		movies:     map[string]*models.Movie{},
+		touched:    map[uint]bool{},
+	}
+}
+
+// Apply writes every row it can match and records the rest in job.
+func (im *Importer) Apply(rows []Row, job *models.ImportJob) error {
+	if job.Imported == nil {
+		job.Imported = map[string]int{}
+	}
+	job.Rows += len(rows)
+	for _, row := range rows {
+		movie, reason, err := im.resolve(row)
+		if err != nil {
+			return err
+		}
+		if movie == nil {
+			im.unmatched(job, row, reason)
+			continue
+		}
+		err = im.db.Transaction(func(tx *gorm.DB) error {
+			return im.write(tx, row, movie)
+		})
+		if err != nil {
+			im.unmatched(job, row, err.Error())
+			continue
+		}
+		im.touched[movie.ID] = true
+		job.Imported[row.Kind]++
+	}
+	job.UnmatchedCount = len(job.Unmatched)
+	return nil
+}
+
+// MovieIDs are the movies the import wrote something for.
+func (im *Importer) MovieIDs() []uint {
+	ids := make([]uint, 0, len(im.touched))
+	for id := range im.touched {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (im *Importer) unmatched(job *models.ImportJob, row Row, reason string) {
+	job.Unmatched = append(job.Unmatched, models.UnmatchedRow{
+		File:   row.File,
+		Line:   row.Line,
+		Kind:   row.Kind,
+		Title:  row.Title,
+		Year:   row.Year,
+		IMDbID: row.IMDbID,
+		Reason: reason,
+	})
+}
+
+// resolve finds a row's movie: IMDb id, then exact title and year (most voted wins),
+// then the provider. The reason is set when nothing matched.
+func (im *Importer) resolve(row Row) (*models.Movie, string, error) {
+	key := row.IMDbID
+	if key == "" {
+		if row.Title == "" {
+			return nil, "no title or IMDb id", nil
+		}
+		key = strings.ToLower(row.Title) + "|" + row.Year
+	}
+	if m, ok := im.movies[key]; ok {
+		if m == nil {
+			return nil, "no matching movie", nil
+		}
+		return m, "", nil
+	}
+
+	var movie models.Movie
+	var err error
+	if row.IMDbID != "" {
+		err = im.db.Where("omdb_id = ?", row.IMDbID).First(&movie).Error
+	} else {
+		query := im.db.Where("lower(title) = lower(?)", row.Title)
+		if row.Year != "" {
+			query = query.Where("year LIKE ?", row.Year+"%")
+		}
+		err = query.Order("votes DESC, id").First(&movie).Error
+	}
+	switch {
+	case err == nil:
+		im.movies[key] = &movie
+		return &movie, "", nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, "", err
+	}
+
+	if im.lookup == nil || im.lookups >= im.MaxLookups {
+		im.movies[key] = nil
+		return nil, "no matching movie", nil
+	}
+	im.lookups++
+	found, err := im.lookup(row.IMDbID, row.Title, row.Year)
+	if err != nil {
+		return nil, "provider lookup failed", nil
+	}
+	im.movies[key] = found
+	if found == nil {
+		return nil, "no matching movie", nil
+	}
+	return found, "", nil
+}
+
+func (im *Importer) write(tx *gorm.DB, row Row, movie *models.Movie) error {
+	switch row.Kind {
+	case KindRating, KindReview:
+		if row.Rating == 0 {
+			return errors.New("no rating")
+		}
+		return im.upsertReview(tx, movie.ID, row.Rating, row.Review)
+
+	case KindDiary:
+		if row.WatchedOn == nil {
+			return errors.New("no watched date")
+		}
+		var existing int64
+		if err := tx.Model(&models.DiaryEntry{}).
+			Where("user_id = ? AND movie_id = ? AND watched_on = ?", im.userID, movie.ID, *row.WatchedOn).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			entry := models.DiaryEntry{
+				UserID:    im.userID,
+				MovieID:   movie.ID,
+				WatchedOn: *row.WatchedOn,
+				Rewatch:   row.Rewatch,
+			}
+			if err := tx.Create(&entry).Error; err != nil {
+				return err
+			}
+		}
+		if row.Rating > 0 {
+			if err := im.upsertReview(tx, movie.ID, row.Rating, ""); err != nil {
+				return err
+			}
+		}
+		return im.addToSystemPlaylist(tx, systemKinds[row.Kind], movie.ID)
+
+	case KindWatched, KindWatchlist, KindLiked:
+		return im.addToSystemPlaylist(tx, systemKinds[row.Kind], movie.ID)
+
+	case KindList:
+		playlistID, err := im.customPlaylist(tx, row.List, row.ListDescription)
+		if err != nil {
+			return err
+		}
+		return im.addToPlaylist(tx, playlistID, movie.ID, row.Description)
+	}
+	return errors.New("unknown row kind")
+}
+
+// upsertReview creates the user's review or updates its rating; text only replaces text.
+func (im *Importer) upsertReview(tx *gorm.DB, movieID uint, rating int, content string) error {
+	var review models.Review
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND movie_id = ?", im.userID, movieID).
+		First(&review).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		review = models.Review{UserID: im.userID, MovieID: movieID, Rating: rating, Content: content}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return ratings.Add(tx, movieID, rating)
+	}
+	if err != nil {
+		return err
+	}
+
+	oldRating := review.Rating
+	review.Rating = rating
+	if content != "" {
+		review.Content = content
+	}
+	if err := tx.Save(&review).Error; err != nil {
+		return err
+	}
+	return ratings.Change(tx, movieID, oldRating, rating)
+}
+
+// visibility is what new playlists get: the user's default, except that unlisted
+// becomes private since an imported list has no share token yet.
+func (im *Importer) visibility(tx *gorm.DB) string {
+	var visibility string
+	tx.Model(&models.User{}).Where("id = ?", im.userID).Pluck("default_visibility", &visibility)
+	if visibility == models.VisibilityUnlisted {
+		return models.VisibilityPrivate
+	}
+	return visibility
+}
+
+// addToSystemPlaylist adds movieID to the user's playlist of that kind.
+func (im *Importer) addToSystemPlaylist(tx *gorm.DB, kind string, movieID uint) error {
+	var playlist models.Playlist
+	if err := tx.Where("owner_id = ? AND kind = ?", im.userID, kind).First(&playlist).Error; err != nil {
+		return err
+	}
+	return im.addToPlaylist(tx, playlist.ID, movieID, "")
+}
+
+// customPlaylist is the user's custom playlist called name, created (described as
+// listDescription) if needed.
+func (im *Importer) customPlaylist(tx *gorm.DB, name, listDescription string) (uint, error) {
+	if name == "" {
+		return 0, errors.New("no playlist name")
+	}
+	var playlist models.Playlist
+	err := tx.Where("owner_id = ? AND name = ? AND kind = ?", im.userID, name, models.PlaylistCustom).First(&playlist).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		playlist = models.Playlist{Name: name, Kind: models.PlaylistCustom, Description: listDescription, OwnerID: im.userID, Visibility: im.visibility(tx)}
+		err = tx.Create(&playlist).Error
+	}
+	return playlist.ID, err
+}
+
+// addToPlaylist adds movieID to the playlist. An entry that is already there keeps its
+// note unless the row brings one.
+func (im *Importer) addToPlaylist(tx *gorm.DB, playlistID, movieID uint, note string) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "playlist_id"}, {Name: "movie_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"description": gorm.Expr("COALESCE(NULLIF(EXCLUDED.description, ''), playlist_movies.description)"),
+		}),
+	}).Create(&models.PlaylistMovie{PlaylistID: playlistID, MovieID: movieID, Description: note}).Error
+}
@@ -0,0 +1,302 @@
+// Package transfer moves a user's film history in and out: Letterboxd export ZIPs and
+// IMDb ratings/watchlist CSVs in, the same formats out.
+//
+// Parsing turns every file into Rows of one Kind. Importer resolves each row to a
+// models.Movie (IMDb id first, then title and year) and writes it as a review, diary
+// entry or playlist entry. Rows that match nothing end up in the import's report.
+package transfer
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind says what a row becomes.
+const (
+	KindRating    = "rating"    // a review with a rating only
+	KindReview    = "review"    // a review with text
+	KindDiary     = "diary"     // a diary entry (and "watched")
+	KindWatched   = "watched"   // the "watched" playlist
+	KindWatchlist = "watchlist" // the "watch-later" playlist
+	KindLiked     = "liked"     // the "liked" playlist
+	KindList      = "list"      // a custom playlist named Row.List
+)
+
+const (
+	SourceLetterboxd = "letterboxd"
+	SourceIMDb       = "imdb"
+)
+
+// MaxFileBytes bounds every file read from an upload, zip entries included.
+const MaxFileBytes = 20 << 20
+
+// Row is one film line of an export.
+type Row struct {
+	File   string
+	Line   int
+	Kind   string
+	Title  string
+	Year   string
+	IMDbID string
+
+	Rating    int // 1..10, 0 when unrated
+	WatchedOn *time.Time
+	Rewatch   bool
+	Review    string
+
+	List            string // KindList: playlist name
+	ListDescription string // of the whole list
+	Description     string // per-entry note of a list
+}
+
+var (
+	imdbIDRe = regexp.MustCompile(`tt\d{7,}`)
+	yearRe   = regexp.MustCompile(`\d{4}`)
+)
+
+// table is a CSV section: a header and the records below it, with their line numbers.
+type table struct {
+	cols    map[string]int
+	records [][]string
+	lines   []int
+}
+
+func (t *table) get(rec []string, col string) string {
+	i, ok := t.cols[col]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func readCSV(r io.Reader) ([][]string, []int, error) {
+	cr := csv.NewReader(io.LimitReader(r, MaxFileBytes))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var records [][]string
+	var lines []int
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return records, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		records = append(records, rec)
+		lines = append(lines, line)
+	}
+}
+
+// tableAt reads the section whose header starts at records[start].
+func tableAt(records [][]string, lines []int, start int) *table {
+	t := &table{cols: map[string]int{}}
+	for i, name := range records[start] {
+		// Excel likes to put a BOM in front of the first column
+		t.cols[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	for i := start + 1; i < len(records); i++ {
+		if len(records[i]) == 1 && strings.TrimSpace(records[i][0]) == "" {
+			break // blank line ends a section
+		}
+		t.records = append(t.records, records[i])
+		t.lines = append(t.lines, lines[i])
+	}
+	return t
+}
+
+// letterboxdRating turns 0.5..5 stars into 1..10.
+func letterboxdRating(s string) int {
+	stars, err := strconv.ParseFloat(s, 64)
+	if err != nil || stars <= 0 {
+		return 0
+	}
+	return int(math.Min(10, math.Max(1, math.Round(stars*2))))
+}
+
+func imdbRating(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 10 {
+		return 0
+	}
+	return n
+}
+
+func parseDay(s string) *time.Time {
+	if len(s) >= 10 {
+		s = s[:10]
+	}
+	day, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil
+	}
+	return &day
+}
+
+// letterboxdKinds maps export files to what their rows become.
+var letterboxdKinds = map[string]string{
+	"diary.csv":       KindDiary,
+	"ratings.csv":     KindRating,
+	"reviews.csv":     KindReview,
+	"watched.csv":     KindWatched,
+	"watchlist.csv":   KindWatchlist,
+	"likes/films.csv": KindLiked,
+}
+
+// ParseLetterboxd reads the files of a Letterboxd export ZIP that carry films.
+// Letterboxd has no IMDb ids; an "imdbID" column (ours, or Letterboxd's import format) is used when present.
+func ParseLetterboxd(zr *zip.Reader) ([]Row, error) {
+	var rows []Row
+	found := false
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, "./")
+		kind, ok := letterboxdKinds[name]
+		isList := strings.HasPrefix(name, "lists/") && path.Ext(name) == ".csv"
+		if !ok && !isList {
+			continue
+		}
+		found = true
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		records, lines, err := readCSV(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		if isList {
+			rows = append(rows, letterboxdList(name, records, lines)...)
+			continue
+		}
+		t := tableAt(records, lines, 0)
+		for i, rec := range t.records {
+			row := Row{
+				File:   name,
+				Line:   t.lines[i],
+				Kind:   kind,
+				Title:  t.get(rec, "Name"),
+				Year:   t.get(rec, "Year"),
+				IMDbID: t.get(rec, "imdbID"),
+				Rating: letterboxdRating(t.get(rec, "Rating")),
+				Review: t.get(rec, "Review"),
+			}
+			row.Rewatch = strings.EqualFold(t.get(rec, "Rewatch"), "yes")
+			row.WatchedOn = parseDay(t.get(rec, "Watched Date"))
+			if kind == KindDiary && row.WatchedOn == nil {
+				row.WatchedOn = parseDay(t.get(rec, "Date"))
+			}
+			rows = append(rows, row)
+		}
+	}
+	if !found {
+		return nil, errors.New("not a Letterboxd export: no diary, ratings, watched, watchlist or list files")
+	}
+	return rows, nil
+}
+
+// letterboxdList reads lists/*.csv: a version line, the list's own header and row,
+// a blank line, then the films under a "Position" header.
+func letterboxdList(name string, records [][]string, lines []int) []Row {
+	listName := strings.TrimSuffix(path.Base(name), ".csv")
+	listDescription := ""
+	films := -1
+	for i, rec := range records {
+		switch strings.TrimPrefix(strings.TrimSpace(rec[0]), "\ufeff") {
+		case "Date":
+			meta := tableAt(records, lines, i)
+			if len(meta.records) > 0 {
+				if n := meta.get(meta.records[0], "Name"); n != "" {
+					listName = n
+				}
+				listDescription = meta.get(meta.records[0], "Description")
+			}
+		case "Position":
+			films = i
+		}
+	}
+	if films < 0 {
+		return nil
+	}
+
+	t := tableAt(records, lines, films)
+	rows := make([]Row, 0, len(t.records))
+	for i, rec := range t.records {
+		rows = append(rows, Row{
+			File:            name,
+			Line:            t.lines[i],
+			Kind:            KindList,
+			Title:           t.get(rec, "Name"),
+			Year:            t.get(rec, "Year"),
+			IMDbID:          t.get(rec, "imdbID"),
+			List:            listName,
+			ListDescription: listDescription,
+			Description:     t.get(rec, "Description"),
+		})
+	}
+	return rows
+}
+
+// ParseIMDb reads an IMDb CSV export. A ratings export (no Position column) becomes
+// ratings; a watchlist or list export goes to list, where "watchlist" means watch-later
+// and anything else a custom playlist of that name.
+func ParseIMDb(r io.Reader, name, list string) ([]Row, error) {
+	records, lines, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty file")
+	}
+	t := tableAt(records, lines, 0)
+	if _, ok := t.cols["Const"]; !ok {
+		return nil, errors.New("not an IMDb export: no Const column")
+	}
+	_, isList := t.cols["Position"]
+
+	rows := make([]Row, 0, len(t.records))
+	for i, rec := range t.records {
+		row := Row{
+			File:   name,
+			Line:   t.lines[i],
+			Title:  t.get(rec, "Title"),
+			Year:   yearRe.FindString(t.get(rec, "Year")),
+			IMDbID: imdbIDRe.FindString(t.get(rec, "Const")),
+			Rating: imdbRating(t.get(rec, "Your Rating")),
+		}
+		switch {
+		case !isList:
+			row.Kind = KindRating
+		case list == "" || strings.EqualFold(list, "watchlist"):
+			row.Kind = KindWatchlist
+		default:
+			row.Kind = KindList
+			row.List = list
+			row.Description = t.get(rec, "Description")
+		}
+		rows = append(rows, row)
+		// a list export carries the user's rating too
+		if isList && row.Rating > 0 {
+			rated := row
+			rated.Kind = KindRating
+			rows = append(rows, rated)
+		}
+	}
+	return rows, nil
+}
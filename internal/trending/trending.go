@@ -0,0 +1,146 @@
+// Package trending keeps a snapshot of the most active movies per time window in trending_scores.
+//
+// Activity is new reviews, adds to "liked" playlists, adds to any other playlist and
+// comments on the movie's reviews. Every event counts with its weight, halved every
+// half-life of its window, so a burst today beats the same burst last week.
+package trending
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"totallyguysproject/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Window is how far back a ranking looks and how fast events fade inside it.
+type Window struct {
+	Span     time.Duration
+	HalfLife time.Duration
+}
+
+type Config struct {
+	Interval time.Duration     // time between refreshes
+	Keep     int               // movies stored per window
+	Windows  map[string]Window // by models.Window*
+
+	// event weights
+	Review   float64
+	Like     float64
+	Addition float64
+	Comment  float64
+}
+
+// DefaultConfig reads TRENDING_INTERVAL (a Go duration, default 15m), the rest is fixed.
+func DefaultConfig() Config {
+	cfg := Config{
+		Interval: 15 * time.Minute,
+		Keep:     100,
+		Windows: map[string]Window{
+			models.WindowDay:   {Span: 24 * time.Hour, HalfLife: 6 * time.Hour},
+			models.WindowWeek:  {Span: 7 * 24 * time.Hour, HalfLife: 36 * time.Hour},
+			models.WindowMonth: {Span: 30 * 24 * time.Hour, HalfLife: 7 * 24 * time.Hour},
+		},
+		Review:   3,
+		Like:     2,
+		Addition: 1,
+		Comment:  0.5,
+	}
+	if d, err := time.ParseDuration(os.Getenv("TRENDING_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	return cfg
+}
+
+// Start refreshes every window now and then every cfg.Interval.
+func Start(db *gorm.DB, cfg Config) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			for _, name := range []string{models.WindowDay, models.WindowWeek, models.WindowMonth} {
+				if n, err := Refresh(db, name, cfg); err != nil {
+					fmt.Printf("trending: %s refresh failed: %v\n", name, err)
+				} else {
+					fmt.Printf("trending: %s has %d movies\n", name, n)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Refresh replaces the snapshot of one window and returns how many movies it holds.
+// Readers see either the old or the new snapshot, never a mix. The window's
+// TrendingSnapshot row tells a quiet window from one never refreshed.
+func Refresh(db *gorm.DB, window string, cfg Config) (int64, error) {
+	w, ok := cfg.Windows[window]
+	if !ok {
+		return 0, fmt.Errorf("unknown trending window %q", window)
+	}
+	now := time.Now()
+	var n int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("time_window = ?", window).Delete(&models.TrendingScore{}).Error; err != nil {
+			return err
+		}
+		res := tx.Exec(refreshSQL, map[string]interface{}{
+			"window":    window,
+			"now":       now,
+			"since":     now.Add(-w.Span),
+			"half_life": w.HalfLife.Seconds(),
+			"review":    cfg.Review,
+			"like":      cfg.Like,
+			"addition":  cfg.Addition,
+			"comment":   cfg.Comment,
+			"keep":      cfg.Keep,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		n = res.RowsAffected
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&models.TrendingSnapshot{Window: window, Movies: n, ComputedAt: now}).Error
+	})
+	return n, err
+}
+
+const refreshSQL = `
+	WITH events AS (
+		SELECT movie_id, created_at AS at, 'review' AS kind
+		FROM reviews WHERE deleted_at IS NULL AND created_at >= @since
+		UNION ALL
+		SELECT pm.movie_id, pm.added_at,
+			CASE WHEN pl.kind = 'liked' THEN 'like' ELSE 'addition' END
+		FROM playlist_movies pm
+		JOIN playlists pl ON pl.id = pm.playlist_id AND pl.deleted_at IS NULL
+		WHERE pm.added_at >= @since
+		UNION ALL
+		SELECT r.movie_id, c.created_at, 'comment'
+		FROM comments c
+		JOIN reviews r ON r.id = c.review_id AND r.deleted_at IS NULL
+		WHERE c.deleted_at IS NULL AND c.created_at >= @since
+	),
+	scored AS (
+		SELECT movie_id,
+			SUM(CASE kind WHEN 'review' THEN @review WHEN 'like' THEN @like
+					WHEN 'addition' THEN @addition ELSE @comment END
+				* exp(-ln(2) * extract(epoch FROM (@now - at)) / @half_life)) AS score,
+			COUNT(*) FILTER (WHERE kind = 'review') AS reviews,
+			COUNT(*) FILTER (WHERE kind = 'like') AS likes,
+			COUNT(*) FILTER (WHERE kind = 'addition') AS additions,
+			COUNT(*) FILTER (WHERE kind = 'comment') AS comments
+		FROM events
+		GROUP BY movie_id
+	),
+	ranked AS (
+		SELECT s.*, row_number() OVER (ORDER BY s.score DESC, m.votes DESC, s.movie_id) AS rn
+		FROM scored s
+		JOIN movies m ON m.id = s.movie_id AND m.deleted_at IS NULL
+	)
+	INSERT INTO trending_scores
+		(time_window, movie_id, rank, score, reviews, likes, additions, comments, computed_at)
+	SELECT @window, movie_id, rn, score, reviews, likes, additions, comments, @now
+	FROM ranked WHERE rn <= @keep`
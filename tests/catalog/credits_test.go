@@ -0,0 +1,39 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/catalog"
+)
+
+func TestSyncCreditsScopedToMovies(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	// the movie scope appears in both halves of the credits CTE
+	scoped := `m.id IN \(\$1,\$2\).*m.id IN \(\$3,\$4\)`
+	mock.ExpectExec(`UPDATE people SET imdb_id = c.imdb_id`).WithArgs(3, 5, 3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(scoped + `.*INSERT INTO people \(imdb_id, name\)`).WithArgs(3, 5, 3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO people \(name\)`).WithArgs(3, 5, 3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM movie_credits WHERE movie_id IN \(\$1,\$2\)`).WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`INSERT INTO movie_credits`).WithArgs(3, 5, 3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 6))
+
+	assert.NoError(t, catalog.SyncCredits(db, []uint{3, 5}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncCreditsNothingToDo(t *testing.T) {
+	assert.NoError(t, catalog.SyncCredits(nil, []uint{}))
+}
@@ -0,0 +1,49 @@
+package catalog_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/catalog"
+)
+
+const sample = `movie_id,movie_name,year,certificate,runtime,genre,rating,description,director,director_id,star,star_id,votes,gross(in $)
+tt3915174,Puss in Boots: The Last Wish,2022,PG,102 min,"Animation, Adventure, Comedy",7.9,A cat on his last life.,"Joel Crawford, 
+Januel Mercado",/name/nm3150455/,"Antonio Banderas, 
+Salma Hayek","/name/nm2591093/,/name/nm0000104/,/name/nm0000161/",93143.0,168464485.0
+bad-id,Nothing,2022,,,,,,,,,,,
+tt0000001,Untitled,I,,,Drama,,Add a Plot,,,,,,
+`
+
+func TestReaderParsesMultilineRows(t *testing.T) {
+	r, err := catalog.NewReader(strings.NewReader(sample))
+	assert.NoError(t, err)
+
+	row, err := r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "tt3915174", row.IMDbID)
+	assert.Equal(t, "2022", row.Year)
+	assert.Equal(t, []string{"Animation", "Adventure", "Comedy"}, row.Genres)
+	assert.Equal(t, 93143, row.Votes)
+	assert.Equal(t, int64(168464485), row.Gross)
+	assert.Equal(t, "Joel Crawford, Januel Mercado", catalog.Names(row.Directors))
+	assert.Equal(t, "nm3150455,nm2591093", catalog.IDs(row.Directors))
+	assert.Equal(t, "Antonio Banderas, Salma Hayek", catalog.Names(row.Stars))
+	assert.Equal(t, "nm0000104,nm0000161", catalog.IDs(row.Stars))
+
+	_, err = r.Next()
+	if assert.IsType(t, &catalog.RowError{}, err) {
+		assert.Equal(t, 5, err.(*catalog.RowError).Line)
+	}
+
+	row, err = r.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "", row.Year)
+	assert.Equal(t, "", row.Plot)
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
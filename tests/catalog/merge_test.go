@@ -0,0 +1,73 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/catalog"
+	"totallyguysproject/internal/models"
+)
+
+func TestMergeMoviesUnlinksDiaryFromDroppedReviews(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	canonical := &models.Movie{Title: "Heat", OMDBID: "tt0113277"}
+	canonical.ID = 3
+	duplicate := &models.Movie{Title: "Heat"}
+	duplicate.ID = 5
+	none := sqlmock.NewResult(0, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE reviews SET movie_id = \$1`).WithArgs(3, 5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// the user had reviewed both: the diary entry of the dropped review is unlinked
+	// while that review still exists
+	mock.ExpectExec(`UPDATE diary_entries SET review_id = NULL\s+WHERE movie_id = \$1 AND review_id IN \(SELECT id FROM reviews WHERE movie_id = \$2\)`).
+		WithArgs(5, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM comment_votes`).WithArgs(5).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM comments`).WithArgs(5).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM review_reactions`).WithArgs(5).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM reviews WHERE movie_id = \$1`).WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE diary_entries SET movie_id = \$1 WHERE movie_id = \$2`).WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE playlist_movies SET description`).WithArgs(3, 5).WillReturnResult(none)
+	mock.ExpectExec(`UPDATE playlist_movies SET movie_id`).WithArgs(3, 5, 3).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM playlist_movies`).WithArgs(5).WillReturnResult(none)
+	for _, table := range []string{"movie_genres", "movie_credits", "movie_similarities", "item_similarities",
+		"recommendations", "trending_scores", "movie_posters", "smart_playlist_movies"} {
+		mock.ExpectExec(`DELETE FROM ` + table).WillReturnResult(none)
+	}
+	mock.ExpectExec(`DELETE FROM "movies" WHERE "movies"."id" = \$1`).WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO genres`).WithArgs(3).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM movie_genres WHERE movie_id IN \(\$1\)`).WithArgs(3).WillReturnResult(none)
+	mock.ExpectExec(`INSERT INTO movie_genres`).WithArgs(3).WillReturnResult(none)
+	mock.ExpectExec(`UPDATE people SET imdb_id`).WillReturnResult(none)
+	mock.ExpectExec(`INSERT INTO people \(imdb_id, name\)`).WillReturnResult(none)
+	mock.ExpectExec(`INSERT INTO people \(name\)`).WillReturnResult(none)
+	mock.ExpectExec(`DELETE FROM movie_credits WHERE movie_id IN \(\$1\)`).WithArgs(3).WillReturnResult(none)
+	mock.ExpectExec(`INSERT INTO movie_credits`).WillReturnResult(none)
+	mock.ExpectExec(`UPDATE movies SET\s+review_count`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var stats *catalog.MergeStats
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		stats, err = catalog.MergeMovies(tx, canonical, duplicate)
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.ReviewsMoved)
+	assert.Equal(t, int64(1), stats.ReviewsDropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,137 @@
+package enrich_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/enrich"
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/provider"
+)
+
+func TestApplyFillsOnlyEmptyFields(t *testing.T) {
+	movie := models.Movie{Title: "Batman", Year: "1989", Director: "Tim Burton (dir.)"}
+	details := &provider.MovieDetails{
+		Plot:     "The Dark Knight of Gotham City begins his war on crime.",
+		Genre:    "Action, Adventure",
+		Director: "Tim Burton",
+		Actors:   "Michael Keaton, Jack Nicholson",
+		Rating:   "7.5",
+	}
+
+	updates := enrich.Apply(&movie, details)
+
+	assert.Equal(t, map[string]interface{}{
+		"plot":   details.Plot,
+		"genre":  details.Genre,
+		"actors": details.Actors,
+		"rating": details.Rating,
+	}, updates)
+	assert.Equal(t, "Tim Burton (dir.)", movie.Director)
+	assert.Equal(t, "7.5", movie.Rating)
+}
+
+func TestNeedsEnrichment(t *testing.T) {
+	incomplete := models.Movie{Title: "Batman", EnrichStatus: enrich.StatusPending}
+	assert.True(t, enrich.NeedsEnrichment(&incomplete))
+
+	incomplete.EnrichStatus = enrich.StatusNotFound
+	assert.False(t, enrich.NeedsEnrichment(&incomplete))
+
+	complete := models.Movie{Plot: "p", Genre: "g", Director: "d", Actors: "a", Rating: "1", EnrichStatus: enrich.StatusPending}
+	assert.False(t, enrich.NeedsEnrichment(&complete))
+}
+
+func TestApplySkipsLockedFields(t *testing.T) {
+	movie := models.Movie{Title: "Batman", LockedFields: "plot,poster"}
+	details := &provider.MovieDetails{
+		Plot:   "The Dark Knight of Gotham City begins his war on crime.",
+		Poster: "https://example.com/batman.jpg",
+		Rating: "7.5",
+	}
+
+	updates := enrich.Apply(&movie, details)
+
+	assert.Equal(t, map[string]interface{}{"rating": "7.5"}, updates)
+	assert.Empty(t, movie.Plot)
+}
+
+// stubProvider answers every lookup with details and counts the calls.
+type stubProvider struct {
+	details *provider.MovieDetails
+	calls   int
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+func (p *stubProvider) Search(string, int) (*provider.SearchResult, error) {
+	return nil, provider.ErrNotFound
+}
+func (p *stubProvider) ByID(string) (*provider.MovieDetails, error) {
+	p.calls++
+	return p.details, nil
+}
+func (p *stubProvider) ByTitle(string, string) (*provider.MovieDetails, error) {
+	p.calls++
+	return p.details, nil
+}
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+	return gormDB, mock
+}
+
+func TestProcessKeepsFieldsLockedMeanwhile(t *testing.T) {
+	db, mock := setupTestDB(t)
+	p := &stubProvider{details: &provider.MovieDetails{Plot: "From the provider.", Rating: "7.5"}}
+	cfg := enrich.DefaultConfig()
+	cfg.RatePerSec = 1000
+
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "omdb_id", "enrich_status"}).
+			AddRow(3, "Batman", "tt0096895", enrich.StatusPending))
+	mock.ExpectBegin()
+	// an admin locked the plot while the provider answered
+	mock.ExpectQuery(`SELECT \* FROM "movies" .* FOR UPDATE`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "omdb_id", "locked_fields"}).
+			AddRow(3, "Batman", "tt0096895", "plot"))
+	mock.ExpectExec(`UPDATE "movies" SET "enrich_attempt_at"=\$1,"enrich_attempts"=\$2,"enrich_error"=\$3,"enrich_next_at"=\$4,"enrich_status"=\$5,"rating"=\$6,"updated_at"=\$7`).
+		WithArgs(sqlmock.AnyArg(), 1, "", nil, enrich.StatusDone, "7.5", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, enrich.NewWorker(db, p, cfg).Process(3))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessStopsAtDailyLimit(t *testing.T) {
+	db, mock := setupTestDB(t)
+	p := &stubProvider{details: &provider.MovieDetails{Rating: "7.5"}}
+	cfg := enrich.DefaultConfig()
+	cfg.RatePerSec = 1000
+	cfg.DailyLimit = 1
+	w := enrich.NewWorker(db, p, cfg)
+
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "omdb_id"}).AddRow(3, "Batman", "tt0096895"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "movies" .* FOR UPDATE`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "omdb_id"}).AddRow(3, "Batman", "tt0096895"))
+	mock.ExpectExec(`UPDATE "movies"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, w.Process(3))
+
+	// the budget is spent: the next movie is neither looked up nor touched
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "omdb_id"}).AddRow(4, "Alien", "tt0078748"))
+	assert.NoError(t, w.Process(4))
+
+	assert.Equal(t, 1, p.calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestAdminUpdateMovie_UnknownField(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("PUT", `{"omdb_id": "tt0000001"}`)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	handlers.AdminUpdateMovie(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestAdminUpdateMovie_LocksEditedFields(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE "movies"."id" = \$1 .*FOR UPDATE`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "locked_fields"}).AddRow(1, "Batman", "poster"))
+	mock.ExpectExec(`UPDATE "movies" SET "locked_fields"=\$1,"plot"=\$2,"updated_at"=\$3`).
+		WithArgs("plot", "Gotham's new protector.", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("PUT", `{"plot": "Gotham's new protector.", "unlock": ["poster"]}`)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	handlers.AdminUpdateMovie(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminMergeMovies_IntoItself(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("POST", `{"duplicate_id": 3}`)
+	c.Params = gin.Params{{Key: "id", Value: "3"}}
+	handlers.AdminMergeMovies(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestGetPlaylist_CollaboratorSeesPrivate(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("private", nil))
+	mock.ExpectQuery(`SELECT "role" FROM "playlist_collaborators" WHERE playlist_id = \$1 AND user_id = \$2 AND accepted_at IS NOT NULL`).
+		WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("viewer"))
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Owner"))
+	mock.ExpectQuery(`LEFT JOIN users adder ON adder.id = playlist_movies.added_by`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "added_by", "added_by_name"}).AddRow(7, "Laura", 2, "Club Member"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "playlist_subscriptions"`).WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.GetPlaylist(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"viewer"`)
+	assert.Contains(t, w.Body.String(), `"added_by_name":"Club Member"`)
+	assert.Contains(t, w.Body.String(), `"subscribed":true`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddMovieToPlaylist_ViewerCannotEdit(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT \* FROM "playlist_movies"`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "movie_id"}))
+	mock.ExpectQuery(`SELECT "role" FROM "playlist_collaborators"`).WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("viewer"))
+
+	c, w := createTestContext("POST", `{"movie_id":7}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.AddMovieToPlaylist(c, db, nil)
+
+	assert.Equal(t, 403, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddMovieToPlaylist_EditorIsCredited(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT \* FROM "playlist_movies"`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "movie_id"}))
+	mock.ExpectQuery(`SELECT "role" FROM "playlist_collaborators"`).WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("editor"))
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Laura"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "playlist_movies"`).
+		WithArgs(5, 7, "", nil, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"added_at"}))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", `{"movie_id":7}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.AddMovieToPlaylist(c, db, nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcceptPlaylistInvite_NothingPending(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("private", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "playlist_collaborators" SET "accepted_at"=\$1 WHERE playlist_id = \$2 AND user_id = \$3 AND accepted_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 5, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.AcceptPlaylistInvite(c, db, nil)
+
+	assert.Equal(t, 404, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInviteCollaborator_WithoutHub(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("private", nil))
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Club Member"))
+	mock.ExpectQuery(`SELECT \* FROM "playlist_collaborators" WHERE playlist_id = \$1 AND user_id = \$2`).WithArgs(5, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "user_id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "playlist_collaborators"`).
+		WithArgs(5, 2, "editor", 1, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", `{"user_id":2}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.InviteCollaborator(c, db, nil)
+
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"editor"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
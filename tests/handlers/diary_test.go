@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestCreateDiaryEntry_InvalidDate(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("POST", `{"movie_id": 1, "watched_on": "01/05/2024"}`)
+	c.Set("userID", uint(1))
+	handlers.CreateDiaryEntry(c, db, nil)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestCreateDiaryEntry_RewatchAndWatchedSync(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE "movies"."id" = \$1`).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(5, "Heat"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "diary_entries" WHERE \(user_id = \$1 AND movie_id = \$2 AND watched_on < \$3\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO "diary_entries"`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, 5, sqlmock.AnyArg(), true, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE \(owner_id = \$1 AND kind = \$2\)`).
+		WithArgs(1, "watched", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "kind", "owner_id"}).AddRow(3, "watched", "watched", 1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "diary_entries" WHERE \(user_id = \$1 AND movie_id = \$2\)`).
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`INSERT INTO "playlist_movies" .*ON CONFLICT DO NOTHING`).
+		WithArgs(3, 5, "", nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"added_at"}))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", `{"movie_id": 5, "watched_on": "2024-05-01"}`)
+	c.Set("userID", uint(1))
+	handlers.CreateDiaryEntry(c, db, nil)
+
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"rewatch":true`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetDiaryCalendar_FillsEveryDay(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`FROM "diary_entries" JOIN movies .*diary_entries.watched_on >= \$2 AND diary_entries.watched_on < \$3`).
+		WillReturnRows(sqlmock.NewRows([]string{"entry_id", "watched_on", "rewatch", "id", "title"}).
+			AddRow(7, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), false, 5, "Heat"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?month=2024-02", nil)
+	c.Set("userID", uint(1))
+	handlers.GetDiaryCalendar(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `"month":"2024-02"`)
+	assert.Contains(t, body, `"date":"2024-02-29","entries":[{"id":7`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveFromWatched_KeepsLoggedMovies(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "kind", "owner_id"}).AddRow(3, "watched", "watched", 1))
+	mock.ExpectQuery(`SELECT \* FROM "playlist_movies"`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "movie_id"}))
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(5, "Heat"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "diary_entries" WHERE \(user_id = \$1 AND movie_id = \$2\)`).
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	c, w := createTestContext("DELETE", "")
+	c.Params = gin.Params{{Key: "id", Value: "3"}, {Key: "movie_id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.RemoveMovieFromPlaylist(c, db, nil)
+
+	assert.Equal(t, 409, w.Code)
+	assert.Contains(t, w.Body.String(), "diary")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,132 @@
+package handlers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestForkPlaylist_CopiesEntries(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT "id","name" FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Owner"))
+	mock.ExpectQuery(`SELECT "default_visibility" FROM "users"`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"default_visibility"}).AddRow("public"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "playlists"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec(`INSERT INTO playlist_movies \(playlist_id, movie_id, description, position, added_at, added_by\)\s+SELECT \$1, playlist_movies.movie_id, playlist_movies.description, playlist_movies.position,.*FROM playlist_movies`).
+		WithArgs(9, 2, 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.ForkPlaylist(c, db, nil)
+
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"forked_from_id":5`)
+	assert.Contains(t, w.Body.String(), `"name":"noir"`)
+	assert.Contains(t, w.Body.String(), `"movies":3`)
+	// the source's uploaded cover stays the source's
+	assert.Contains(t, w.Body.String(), `"cover":"/src/default-playlist.jpg"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForkPlaylist_NameTooLong(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	c, w := createTestContext("POST", `{"name":"`+strings.Repeat("n", 101)+`"}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.ForkPlaylist(c, db, nil)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "name must be 1 to 100 characters")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForkPlaylist_PrivateLooksMissing(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("unlisted", "s3cret"))
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.ForkPlaylist(c, db, nil)
+
+	assert.Equal(t, 404, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscribePlaylist_NotOwnPlaylist(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("public", nil))
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.SubscribePlaylist(c, db)
+
+	assert.Equal(t, 400, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscribePlaylist_Public(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "playlist_subscriptions" \("playlist_id","user_id","created_at"\) VALUES \(\$1,\$2,\$3\) ON CONFLICT DO NOTHING`).
+		WithArgs(5, 2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.SubscribePlaylist(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMySubscriptions_SystemListsLocalized(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT playlist_subscriptions.playlist_id, playlists.name AS playlist_name, playlists.kind AS playlist_kind`).
+		WithArgs(2, "private").
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "playlist_name", "playlist_kind", "cover", "owner_id", "owner_name"}).
+			AddRow(5, "liked", "liked", "", 1, "Owner"))
+
+	c, w := createTestContext("GET", "")
+	c.Set("userID", uint(2))
+	c.Set("language", "ru")
+
+	handlers.GetMySubscriptions(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"playlist_kind":"liked"`)
+	assert.Contains(t, w.Body.String(), `"display_name":"Понравилось"`)
+	assert.Contains(t, w.Body.String(), `"cover":"/src/liked-playlist.jpg"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,302 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+	"totallyguysproject/internal/provider"
+)
+
+func TestLoadMoviesByGenre_MissingGenre(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	handlers.LoadMoviesByGenre(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestLoadMoviesByGenre_InvalidSort(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?genre=drama&sort=budget", nil)
+	handlers.LoadMoviesByGenre(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestLoadMoviesByGenre_Intersection(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "movies".*genres.slug IN \(\$1,\$2\).*HAVING COUNT\(DISTINCT movie_genres.genre_id\) = \$3`).
+		WithArgs("film-noir", "drama", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+	mock.ExpectQuery(`SELECT \* FROM "movies".*ORDER BY NULLIF\(NULLIF\(movies.rating.*LIMIT \$4 OFFSET \$5`).
+		WithArgs("film-noir", "drama", 2, 10, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "omdb_id", "title", "year", "rating"}).
+			AddRow(1, "tt0043014", "Sunset Blvd.", "1950", "8.4"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?genre=Film-Noir,Drama&page=2&limit=10", nil)
+	handlers.LoadMoviesByGenre(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Movies []handlers.MovieSummary `json:"movies"`
+		Total  int                     `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 12, resp.Total)
+	assert.Equal(t, "Sunset Blvd.", resp.Movies[0].Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchAndSaveMovie_InvalidField(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?title=godfather&field=budget", nil)
+	handlers.SearchAndSaveMovie(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestSearchAndSaveMovie_RankedLocalHits(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	rows := sqlmock.NewRows([]string{"id", "omdb_id", "title", "year", "poster", "relevance", "snippet"}).
+		AddRow(1, "tt0068646", "The Godfather", "1972", "N/A", 1.7, "The <mark>Godfather</mark>").
+		AddRow(2, "tt0071562", "The Godfather Part II", "1974", "N/A", 0.7, "The <mark>Godfather</mark> Part II").
+		AddRow(3, "tt0099674", "The Godfather Part III", "1990", "N/A", 0.6, "The <mark>Godfather</mark> Part III")
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(id\), 0\) FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(100))
+	mock.ExpectQuery(`SELECT COUNT\(\*\).*websearch_to_tsquery\('english', \$1\).*movies.id <= \$3`).
+		WithArgs("godfater", "godfater", 100).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`websearch_to_tsquery\('english', \$1\).*movies.search_vector @@ q.tsq OR q.raw <% movies.title.*LIMIT \$4 OFFSET \$5`).
+		WithArgs("godfater", "godfater", 100, 3, 0).
+		WillReturnRows(rows)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?title=godfater&limit=3", nil)
+	handlers.SearchAndSaveMovie(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Search []struct {
+			Title     string  `json:"title"`
+			Relevance float64 `json:"relevance"`
+			Snippet   string  `json:"snippet"`
+		} `json:"Search"`
+		Source string `json:"source"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "database", resp.Source)
+	assert.Len(t, resp.Search, 3)
+	assert.Equal(t, "The <mark>Godfather</mark>", resp.Search[0].Snippet)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchAndSaveMovie_MergesProviderHits(t *testing.T) {
+	db, mock := setupTestDB(t)
+	handlers.SetMovieProvider(provider.NewFake("../../data/fixtures/omdb"))
+
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(id\), 0\) FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(100))
+	mock.ExpectQuery(`SELECT COUNT\(\*\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`ORDER BY relevance DESC`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "omdb_id", "title", "year"}).
+			AddRow(4, "tt0096895", "Batman", "1989"))
+	// Batman is already listed locally, only Batman Begins is new
+	mock.ExpectQuery(`SELECT movies.omdb_id.*movies.omdb_id IN \(\$4,\$5\)`).
+		WithArgs("batman", "batman", 100, "tt0096895", "tt0372784").
+		WillReturnRows(sqlmock.NewRows([]string{"omdb_id"}).AddRow("tt0096895"))
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE "movies"."omdb_id" = \$1`).
+		WithArgs("tt0372784", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "omdb_id", "title", "year"}).
+			AddRow(9, "tt0372784", "Batman Begins", "2005"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?title=batman", nil)
+	handlers.SearchAndSaveMovie(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Search []struct {
+			ID     uint   `json:"id"`
+			OMDBID string `json:"omdb_id"`
+		} `json:"Search"`
+		Source     string `json:"source"`
+		Total      int    `json:"total"`
+		NextCursor string `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "database+fake", resp.Source)
+	assert.Equal(t, 2, resp.Total)
+	assert.Empty(t, resp.NextCursor)
+	if assert.Len(t, resp.Search, 2) {
+		assert.Equal(t, "tt0372784", resp.Search[1].OMDBID)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchAndSaveMovie_InvalidCursor(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?title=batman&cursor=%21%21", nil)
+	handlers.SearchAndSaveMovie(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestSearchAndSaveMovie_DeepPageNeedsCursor(t *testing.T) {
+	db, mock := setupTestDB(t)
+	handlers.SetMovieProvider(provider.NewFake("../../data/fixtures/omdb"))
+
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(id\), 0\) FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(100))
+	mock.ExpectQuery(`SELECT COUNT\(\*\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	// page 50 would walk the provider from its first page
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?title=batman&page=50&limit=20", nil)
+	handlers.SearchAndSaveMovie(c, db)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "next_cursor")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiscoverMovies_InvalidYear(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?year_from=nineties", nil)
+	handlers.DiscoverMovies(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestDiscoverMovies_FiltersAndFacets(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "movies" WHERE .*::int >= \$1 AND .*::int <= \$2 AND movies.certificate IN \(\$3\)`).
+		WithArgs(1990, 1999, "R").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE .*ORDER BY movies.votes DESC NULLS LAST, movies.id LIMIT \$4`).
+		WithArgs(1990, 1999, "R", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "certificate"}).
+			AddRow(3, "The Godfather Part III", "1990", "R"))
+
+	// genre facet keeps every filter
+	mock.ExpectQuery(`SELECT genres.slug AS value.*certificate IN \(\$3\)`).
+		WithArgs(1990, 1999, "R").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "label", "count"}).AddRow("crime", "Crime", 1))
+	// decade facet drops the year filter
+	mock.ExpectQuery(`AS value, COUNT\(\*\) AS count FROM "movies" WHERE movies.certificate IN \(\$1\)`).
+		WithArgs("R").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("1990", 1))
+	// certificate facet drops the certificate filter
+	mock.ExpectQuery(`SELECT movies.certificate AS value`).
+		WithArgs(1990, 1999).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("R", 1).AddRow("PG-13", 4))
+	mock.ExpectQuery(`floor\(`).
+		WithArgs(1990, 1999, "R").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("7", 1))
+	mock.ExpectQuery(`floor\(movies.avg_rating\)::int::text AS value, COUNT\(\*\) AS count FROM "movies" WHERE .* AND movies.review_count > 0`).
+		WithArgs(1990, 1999, "R").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("8", 1))
+	mock.ExpectQuery(`unnest\(string_to_array\(movies.director`).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("Francis Ford Coppola", 1))
+	mock.ExpectQuery(`unnest\(string_to_array\(movies.actors`).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "count"}))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?year_from=1990&year_to=1999&certificate=R&sort=votes", nil)
+	handlers.DiscoverMovies(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Movies []handlers.MovieSummary `json:"movies"`
+		Total  int                     `json:"total"`
+		Facets map[string][]struct {
+			Value string `json:"value"`
+			Count int    `json:"count"`
+		} `json:"facets"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Total)
+	assert.Len(t, resp.Facets["certificate"], 2)
+	assert.Equal(t, "Francis Ford Coppola", resp.Facets["director"][0].Value)
+	assert.Equal(t, "8", resp.Facets["avg_rating"][0].Value)
+	assert.NotNil(t, resp.Facets["actor"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiscoverMovies_PeopleFilterIsLiteral(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "movies" WHERE movies.director ILIKE \$1`).
+		WithArgs(`%100\% \_ok%`).
+		WillReturnError(errors.New("stop here"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?director=100%25%20_ok", nil)
+	handlers.DiscoverMovies(c, db)
+
+	assert.Equal(t, 500, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSimilarMovies_EmptyIsNotRecomputed(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	computed := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "similar_computed_at"}).AddRow(5, "Obscure", computed))
+	mock.ExpectQuery(`FROM "movie_similarities"`).WithArgs(5, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// no similar.Compute: it found nothing last time
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	handlers.GetSimilarMovies(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"similar":[]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMyRecommendations_EmptyIsNotRecomputed(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	computed := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "recommendations"`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`FROM "recommendations"`).WithArgs(1, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id","recommendations_computed_at" FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recommendations_computed_at"}).AddRow(1, computed))
+	// no recommend.ComputeUsers: the feed came out empty last time
+
+	c, w := createTestContext("GET", "")
+	c.Set("userID", uint(1))
+	handlers.GetMyRecommendations(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"recommendations":[]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
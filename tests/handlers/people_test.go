@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestSearchPeople_MissingQuery(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	handlers.SearchPeople(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestGetPerson_Filmography(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "people" WHERE "people"."id" = \$1`).
+		WithArgs(7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "imdb_id", "name"}).AddRow(7, "nm0000338", "Francis Ford Coppola"))
+	mock.ExpectQuery(`FROM "movie_credits" JOIN movies ON movies.id = movie_credits.movie_id.*WHERE movie_credits.person_id = \$1`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "year", "role", "billing"}).
+			AddRow(3, "The Godfather Part III", "1990", "director", 1).
+			AddRow(1, "The Godfather", "1972", "director", 1))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "7"}}
+	handlers.GetPerson(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Name        string `json:"name"`
+		Filmography map[string][]struct {
+			Title string `json:"title"`
+		} `json:"filmography"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Francis Ford Coppola", resp.Name)
+	assert.Len(t, resp.Filmography["director"], 2)
+	assert.Empty(t, resp.Filmography["actor"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPerson_NotFound(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "people"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "99"}}
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	handlers.GetPerson(c, db)
+
+	assert.Equal(t, 404, w.Code)
+}
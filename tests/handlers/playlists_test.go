@@ -0,0 +1,417 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func playlistRow(visibility string, token interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "cover", "owner_id", "visibility", "share_token"}).
+		AddRow(5, "noir", "/cover.jpg", 1, visibility, token)
+}
+
+func TestGetPlaylist_PrivateLooksMissing(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("private", nil))
+	mock.ExpectQuery(`SELECT "role" FROM "playlist_collaborators"`).WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(2))
+
+	handlers.GetPlaylist(c, db)
+
+	assert.Equal(t, 404, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPlaylist_UnlistedNeedsToken(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("unlisted", "s3cret"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?token=guess", nil)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+
+	handlers.GetPlaylist(c, db)
+	assert.Equal(t, 404, w.Code)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("unlisted", "s3cret"))
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Owner"))
+	mock.ExpectQuery(`SELECT movies.\*, playlist_movies.description, .* FROM "movies".*ORDER BY playlist_movies.position ASC NULLS LAST`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description"}).AddRow(7, "Laura", ""))
+
+	c, w = createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?token=s3cret", nil)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+
+	handlers.GetPlaylist(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	// only the owner gets the token back
+	assert.NotContains(t, w.Body.String(), "share_token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserPlaylists_OthersSeePublicOnly(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE owner_id = \$1 AND visibility = \$2`).
+		WithArgs("1", "public").
+		WillReturnRows(playlistRow("public", nil))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Set("userID", uint(2))
+
+	handlers.GetUserPlaylists(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetPlaylistVisibility_UnlistedGetsToken(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("private", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "playlists" SET "share_token"=\$1,"visibility"=\$2,"updated_at"=\$3`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("PUT", `{"visibility":"unlisted"}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.SetPlaylistVisibility(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Regexp(t, `"share_token":"[A-Za-z0-9_-]{32}"`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotatePlaylistShareToken_DropsUnlistedSubscriptions(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("unlisted", "old-token"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "playlists" SET "share_token"=\$1,"updated_at"=\$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "playlist_subscriptions" WHERE playlist_id = \$1 AND user_id NOT IN \(SELECT "user_id" FROM "playlist_collaborators" WHERE playlist_id = \$2 AND accepted_at IS NOT NULL\)`).
+		WithArgs(5, 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.RotatePlaylistShareToken(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), "old-token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPlaylist_UnknownSort(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Owner"))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?sort=loudness", nil)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+
+	handlers.GetPlaylist(c, db)
+
+	assert.Equal(t, 400, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectReorderLock(mock sqlmock.Sqlmock, version int, current ...int) {
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE "playlists"."id" = \$1 .* FOR UPDATE`).WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "order_version"}).AddRow(5, 1, version))
+	rows := sqlmock.NewRows([]string{"movie_id"})
+	for _, id := range current {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(`SELECT "movie_id" FROM "playlist_movies" WHERE playlist_id = \$1 ORDER BY playlist_movies.position`).
+		WithArgs(5).WillReturnRows(rows)
+}
+
+func TestReorderPlaylist_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	expectReorderLock(mock, 2, 7, 8, 9)
+	mock.ExpectExec(`UPDATE playlist_movies SET position = o.pos\s+FROM unnest\(\$1::bigint\[\]\) WITH ORDINALITY`).
+		WithArgs("{9,7,8}", 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE "playlists" SET "order_version"=\$1`).
+		WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("PUT", `{"movie_ids":[9,7,8],"order_version":2}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.ReorderPlaylist(c, db, nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"movie_ids":[9,7,8],"order_version":3}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReorderPlaylist_Conflicts(t *testing.T) {
+	cases := map[string]string{
+		"stale version": `{"movie_ids":[9,7,8],"order_version":1}`,
+		"missing movie": `{"movie_ids":[9,7]}`,
+		"foreign movie": `{"movie_ids":[9,7,10]}`,
+		"duplicate":     `{"movie_ids":[9,9,7]}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			db, mock := setupTestDB(t)
+
+			expectReorderLock(mock, 2, 7, 8, 9)
+			mock.ExpectCommit()
+
+			c, w := createTestContext("PUT", body)
+			c.Params = gin.Params{{Key: "id", Value: "5"}}
+			c.Set("userID", uint(1))
+
+			handlers.ReorderPlaylist(c, db, nil)
+
+			assert.Equal(t, 409, w.Code)
+			assert.Contains(t, w.Body.String(), `"movie_ids":[7,8,9],"order_version":2`)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdatePlaylistRules_OnlySmartPlaylists(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("public", nil))
+
+	c, w := createTestContext("PUT", `{"rules":[{"field":"genre","op":"contains","value":"noir"}]}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.UpdatePlaylistRules(c, db)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "not a smart playlist")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePlaylist_RejectsBadRules(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	c, w := createTestContext("POST", `{"name":"old noir","rules":{"rules":[{"field":"year","op":"contains","value":"1950"}]}}`)
+	c.Set("userID", uint(1))
+
+	handlers.CreatePlaylist(c, db)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "rule 1: year takes")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePlaylist_NameTrimmedAndBounded(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	c, w := createTestContext("POST", `{"name":"   "}`)
+	c.Set("userID", uint(1))
+	handlers.CreatePlaylist(c, db)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "name must be 1 to 100 characters")
+
+	c, w = createTestContext("POST", `{"name":"`+strings.Repeat("n", 101)+`"}`)
+	c.Set("userID", uint(1))
+	handlers.CreatePlaylist(c, db)
+	assert.Equal(t, 400, w.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdatePlaylist_RenameDescribeTag(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "playlists" SET "description"=\$1,"name"=\$2,"tags"=\$3,"updated_at"=\$4 WHERE "playlists"."deleted_at" IS NULL AND "id" = \$5`).
+		WithArgs("Rain and shadows", "Film noir", `["noir","1940s"]`, sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("PATCH", `{"name":" Film noir ","description":"Rain and shadows","tags":["Noir","1940s","noir",""]}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+
+	handlers.UpdatePlaylist(c, db, nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id":5,"name":"Film noir","description":"Rain and shadows","tags":["noir","1940s"]}`, w.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDefaultPlaylistsCannotBeRenamedOrDeleted(t *testing.T) {
+	// a system list keeps its kind whatever it was called
+	liked := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "kind", "owner_id"}).AddRow(5, "Favourites", "liked", 1)
+	}
+
+	db, mock := setupTestDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).WillReturnRows(liked())
+
+	c, w := createTestContext("PATCH", `{"name":"loved"}`)
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+	handlers.UpdatePlaylist(c, db, nil)
+	assert.Equal(t, 403, w.Code)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists"`).WithArgs(5, 1).WillReturnRows(liked())
+
+	c, w = createTestContext("DELETE", "")
+	c.Params = gin.Params{{Key: "id", Value: "5"}}
+	c.Set("userID", uint(1))
+	handlers.DeletePlaylist(c, db)
+	assert.Equal(t, 403, w.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkPlaylistOps_PerItemResults(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE id IN \(\$1,\$2\)`).WithArgs(5, 5).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE id IN \(\$1,\$2\)`).WithArgs(7, 8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Laura").AddRow(8, "Gilda"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "playlist_movies" .* ON CONFLICT DO NOTHING`).
+		WithArgs(5, 7, "", nil, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"added_at"}).AddRow(nil))
+	mock.ExpectExec(`DELETE FROM "playlist_movies" WHERE playlist_id = \$1 AND movie_id = \$2`).
+		WithArgs(5, 8).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", `{"ops":[{"op":"add","playlist_id":5,"movie_id":7},{"op":"remove","playlist_id":5,"movie_id":8}]}`)
+	c.Set("userID", uint(1))
+
+	handlers.BulkPlaylistOps(c, db, nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"index":0,"op":"add","playlist_id":5,"movie_id":7,"status":"added"`)
+	assert.Contains(t, w.Body.String(), `"index":1,"op":"remove","playlist_id":5,"movie_id":8,"status":"unchanged"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkPlaylistOps_OneBadItemAppliesNothing(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE id IN \(\$1,\$2\)`).WithArgs(5, 5).
+		WillReturnRows(playlistRow("public", nil))
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE id IN \(\$1,\$2\)`).WithArgs(7, 99).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Laura"))
+
+	c, w := createTestContext("POST", `{"ops":[{"op":"add","playlist_id":5,"movie_id":7},{"op":"add","playlist_id":5,"movie_id":99}]}`)
+	c.Set("userID", uint(1))
+
+	handlers.BulkPlaylistOps(c, db, nil)
+
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"applied":false`)
+	assert.Contains(t, w.Body.String(), `"movie_id":7,"status":"not_applied"`)
+	assert.Contains(t, w.Body.String(), `"movie_id":99,"status":"failed","error":"movie 99 not found"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkPlaylistOps_MoveIntoPlaylistThatHasTheMovie(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE id IN \(\$1,\$2\)`).WithArgs(6, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "kind", "owner_id", "visibility"}).
+			AddRow(5, "noir", "custom", 1, "public").
+			AddRow(6, "best", "custom", 1, "public"))
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE id IN \(\$1\)`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Laura"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "playlist_movies" WHERE playlist_id = \$1 AND movie_id = \$2`).WithArgs(5, 7, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id", "movie_id", "description"}).AddRow(5, 7, "Tierney at her best"))
+	mock.ExpectExec(`DELETE FROM "playlist_movies" WHERE playlist_id = \$1 AND movie_id = \$2`).WithArgs(5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "playlist_movies" .* ON CONFLICT DO NOTHING`).
+		WithArgs(6, 7, "Tierney at her best", nil, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"added_at"}))
+	mock.ExpectExec(`UPDATE "playlist_movies" SET "description"=\$1 WHERE playlist_id = \$2 AND movie_id = \$3 AND description = ''`).
+		WithArgs("Tierney at her best", 6, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("POST", `{"ops":[{"op":"move","from_playlist_id":5,"playlist_id":6,"movie_id":7}]}`)
+	c.Set("userID", uint(1))
+
+	handlers.BulkPlaylistOps(c, db, nil)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"op":"move","playlist_id":6,"movie_id":7,"status":"removed"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserPlaylists_SystemListsLocalized(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE owner_id = \$1 AND visibility = \$2`).
+		WithArgs("1", "public").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "kind", "cover", "owner_id", "visibility"}).
+			AddRow(3, "watched", "watched", "", 1, "public").
+			AddRow(4, "watched", "custom", "/uploads/w.jpg", 1, "public"))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Set("userID", uint(2))
+	c.Set("language", "ru")
+
+	handlers.GetUserPlaylists(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Playlists []map[string]interface{} `json:"playlists"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Playlists, 2)
+	assert.Equal(t, "Просмотрено", resp.Playlists[0]["display_name"])
+	assert.Equal(t, "/src/watched-playlist.jpg", resp.Playlists[0]["cover"])
+	// a custom list that happens to be called "watched" is just a custom list
+	assert.Equal(t, "watched", resp.Playlists[1]["display_name"])
+	assert.Equal(t, "/uploads/w.jpg", resp.Playlists[1]["cover"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,39 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestGetPoster_InvalidSize(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "size", Value: "huge"}}
+	handlers.GetPoster(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestGetPoster_PlaceholderUntilMirrored(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "movie_posters" WHERE movie_id = \$1`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id", "status"}).AddRow(1, "missing"))
+
+	c, w := createTestContext("GET", "")
+	c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "size", Value: "small"}}
+	handlers.GetPoster(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), `width="154"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func reviewRow(id, userID int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "movie_id", "user_id", "rating"}).AddRow(id, 10, userID, 8)
+}
+
+func TestAddReviewReaction_HelpfulReplacesUnhelpful(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "reviews"`).WithArgs(3, 1).WillReturnRows(reviewRow(3, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "review_reactions" WHERE review_id = \$1 AND user_id = \$2 AND type = \$3`).
+		WithArgs(3, 2, "unhelpful").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "review_reactions" .* ON CONFLICT DO NOTHING`).
+		WithArgs(3, 2, "helpful", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT review_id, type, count\(\*\) AS n FROM "review_reactions"`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"review_id", "type", "n"}).AddRow(3, "helpful", 1))
+	mock.ExpectQuery(`SELECT "type" FROM "review_reactions" WHERE review_id = \$1 AND user_id = \$2`).
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"type"}).AddRow("helpful"))
+
+	c, w := createTestContext("POST", `{"type":"helpful"}`)
+	c.Params = gin.Params{{Key: "id", Value: "3"}}
+	c.Set("userID", uint(2))
+
+	handlers.AddReviewReaction(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"helpful":1`)
+	assert.Contains(t, w.Body.String(), `"unhelpful":0`)
+	assert.Contains(t, w.Body.String(), `"my_reactions":["helpful"]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddReviewReaction_RejectsOwnReviewAndUnknownTypes(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "reviews"`).WithArgs(3, 1).WillReturnRows(reviewRow(3, 1))
+
+	c, w := createTestContext("POST", `{"type":"funny"}`)
+	c.Params = gin.Params{{Key: "id", Value: "3"}}
+	c.Set("userID", uint(1))
+	handlers.AddReviewReaction(c, db)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "your own review")
+
+	mock.ExpectQuery(`SELECT \* FROM "reviews"`).WithArgs(3, 1).WillReturnRows(reviewRow(3, 1))
+
+	c, w = createTestContext("POST", `{"type":"love"}`)
+	c.Params = gin.Params{{Key: "id", Value: "3"}}
+	c.Set("userID", uint(2))
+	handlers.AddReviewReaction(c, db)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "helpful, unhelpful, funny")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetReviewsForMovie_MostHelpfulFirst(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT .* FROM "reviews" .* WHERE reviews.movie_id = \$1 ORDER BY reviews.created_at DESC`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "movie_id", "user_id", "rating"}).
+			AddRow(1, 10, 1, 9).
+			AddRow(2, 10, 2, 7).
+			AddRow(3, 10, 3, 5))
+	mock.ExpectQuery(`SELECT review_id, type, count\(\*\) AS n FROM "review_reactions" WHERE review_id IN \(\$1,\$2,\$3\)`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"review_id", "type", "n"}).
+			AddRow(1, "helpful", 2).
+			AddRow(2, "helpful", 40).
+			AddRow(2, "unhelpful", 5).
+			AddRow(2, "funny", 3))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?sort=helpful", nil)
+	c.Params = gin.Params{{Key: "id", Value: "10"}}
+
+	handlers.GetReviewsForMovie(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var reviews []handlers.ReviewWithMovieAndUser
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reviews))
+	assert.Len(t, reviews, 3)
+	// 40 of 45 found it helpful beats 2 of 2; no votes comes last
+	assert.Equal(t, []uint{2, 1, 3}, []uint{reviews[0].ID, reviews[1].ID, reviews[2].ID})
+	assert.Equal(t, int64(3), reviews[0].Reactions["funny"])
+	assert.Equal(t, 0.0, reviews[2].Helpfulness)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/handlers"
+)
+
+func TestGetTrendingMovies_InvalidWindow(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?window=year", nil)
+	handlers.GetTrendingMovies(c, db)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestGetTrendingMovies_FromSnapshot(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "trending_scores" .*WHERE trending_scores.time_window = \$1`).
+		WithArgs("day").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`FROM "trending_scores" .*ORDER BY trending_scores.rank LIMIT \$2`).
+		WithArgs("day", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "rank", "score", "reviews", "likes"}).
+			AddRow(5, "Dune", 1, 12.5, 3, 2).
+			AddRow(8, "Alien", 2, 4.1, 1, 0))
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?window=day", nil)
+	handlers.GetTrendingMovies(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Window string `json:"window"`
+		Total  int    `json:"total"`
+		Movies []struct {
+			ID      uint   `json:"id"`
+			Title   string `json:"title"`
+			Rank    int    `json:"rank"`
+			Reviews int    `json:"reviews"`
+		} `json:"movies"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "day", resp.Window)
+	assert.Equal(t, 2, resp.Total)
+	assert.Len(t, resp.Movies, 2)
+	assert.Equal(t, "Dune", resp.Movies[0].Title)
+	assert.Equal(t, 3, resp.Movies[0].Reviews)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTrendingMovies_QuietWindowNotRefreshed(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "trending_scores"`).
+		WithArgs("day").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`FROM "trending_scores"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "trending_snapshots" WHERE time_window = \$1 LIMIT \$2`).
+		WithArgs("day", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"time_window", "movies", "computed_at"}).AddRow("day", 0, time.Now()))
+	// refreshed and empty: no trending.Refresh per request
+
+	c, w := createTestContext("GET", "")
+	c.Request = httptest.NewRequest("GET", "/?window=day", nil)
+	handlers.GetTrendingMovies(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"movies":[]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
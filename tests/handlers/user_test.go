@@ -1,7 +1,6 @@
 package handlers_test
 
 import (
-
 	"net/http/httptest"
 	"testing"
 
@@ -108,4 +107,41 @@ func TestGetProfile_Success(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+
+func TestDeleteUser_UncountsReviews(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "users"`).WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Test User"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT "movie_id" FROM "reviews" WHERE user_id = \$1`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}).AddRow(7).AddRow(9))
+	for _, table := range []string{"playlist_collaborators", "playlist_subscriptions"} {
+		mock.ExpectExec(`DELETE FROM "`+table+`" WHERE user_id = \$1 OR playlist_id IN \(SELECT "id" FROM "playlists" WHERE owner_id = \$2`).
+			WithArgs(1, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	// the entries of the user's playlists go with them
+	mock.ExpectExec(`DELETE FROM "playlist_movies" WHERE playlist_id IN \(SELECT "id" FROM "playlists" WHERE owner_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	for _, table := range []string{"smart_playlist_movies", "playlists", "review_reactions",
+		"diary_entries", "reviews", "follows", "comments", "comment_votes", "import_jobs"} {
+		mock.ExpectExec(`DELETE FROM "` + table + `"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`UPDATE movies SET\s+review_count = s.review_count.* AND m.id IN \(\$1,\$2\)`).
+		WithArgs(7, 9).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = \$1`).WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	c, w := createTestContext("DELETE", "")
+	c.Set("userID", uint(1))
+
+	handlers.DeleteUser(c, db)
+
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,134 @@
+package posters_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/posters"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+// testPoster is mostly dark blue with a red stripe on top.
+func testPoster(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0x10, 0x20, 0x80, 0xff}
+			if y < h/10 {
+				c = color.RGBA{0xff, 0, 0, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestResizeKeepsAspectRatio(t *testing.T) {
+	out := posters.Resize(testPoster(300, 450), 154)
+	assert.Equal(t, 154, out.Bounds().Dx())
+	assert.Equal(t, 231, out.Bounds().Dy())
+}
+
+func TestDominantColorPicksTheLargestArea(t *testing.T) {
+	assert.Equal(t, "#102080", posters.DominantColor(testPoster(300, 450)))
+}
+
+func TestProcessMirrorsAllSizes(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, testPoster(300, 450)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	posters.Dir = t.TempDir()
+	db, mock := setupTestDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE "movies"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "poster"}).AddRow(3, srv.URL+"/p.png"))
+	mock.ExpectQuery(`SELECT \* FROM "movie_posters" WHERE movie_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "movie_posters" .*ON CONFLICT \("movie_id"\) DO UPDATE`).
+		WithArgs(srv.URL+"/p.png", posters.StatusMirrored, 300, 450, "#102080", 0, nil, sqlmock.AnyArg(), 3, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}).AddRow(3))
+	mock.ExpectCommit()
+
+	assert.NoError(t, posters.NewMirrorer(db, posters.DefaultConfig()).Process(3))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for size := range posters.Sizes {
+		f, err := os.Open(posters.File(3, size))
+		assert.NoError(t, err, size)
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		assert.NoError(t, err, size)
+		if w := posters.Sizes[size]; w > 0 && w < 300 {
+			assert.Equal(t, w, cfg.Width, size)
+		} else {
+			assert.Equal(t, 300, cfg.Width, size) // never upscaled
+		}
+	}
+}
+
+func TestProcessRecordsBrokenPoster(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	posters.Dir = t.TempDir()
+	db, mock := setupTestDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "poster"}).AddRow(4, srv.URL))
+	mock.ExpectQuery(`SELECT \* FROM "movie_posters"`).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "movie_posters"`).
+		WithArgs(srv.URL, posters.StatusFailed, 0, 0, "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 4, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}).AddRow(4))
+	mock.ExpectCommit()
+
+	assert.NoError(t, posters.NewMirrorer(db, posters.DefaultConfig()).Process(4))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessNAPosterIsMissing(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "poster"}).AddRow(5, "N/A"))
+	mock.ExpectQuery(`SELECT \* FROM "movie_posters"`).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "movie_posters"`).
+		WithArgs("N/A", posters.StatusMissing, 0, 0, "", 0, nil, sqlmock.AnyArg(), 5, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}).AddRow(5))
+	mock.ExpectCommit()
+
+	assert.NoError(t, posters.NewMirrorer(db, posters.DefaultConfig()).Process(5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDefaultConfigReadsPosterDir(t *testing.T) {
+	t.Setenv("POSTER_DIR", "/srv/posters")
+	assert.Equal(t, "/srv/posters", posters.DefaultConfig().Dir)
+}
@@ -0,0 +1,79 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/provider"
+)
+
+// countingProvider records how many lookups reach the wrapped provider.
+type countingProvider struct {
+	provider.MovieProvider
+	calls int
+}
+
+func (p *countingProvider) ByID(imdbID string) (*provider.MovieDetails, error) {
+	p.calls++
+	return p.MovieProvider.ByID(imdbID)
+}
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestCachedNegativeEntry(t *testing.T) {
+	db, mock := setupTestDB(t)
+	inner := &countingProvider{MovieProvider: provider.NewFake(fixturesDir)}
+	cached := provider.NewCached(db, inner)
+
+	// cold: miss, upstream says not found, negative entry is stored
+	mock.ExpectQuery(`SELECT \* FROM "provider_caches"`).
+		WithArgs("fake:id:tt0000000", sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "provider_caches".*ON CONFLICT`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, err := cached.ByID("tt0000000")
+	assert.Equal(t, provider.ErrNotFound, err)
+
+	// warm: served from the negative entry without calling upstream
+	mock.ExpectQuery(`SELECT \* FROM "provider_caches"`).
+		WithArgs("fake:id:tt0000000", sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "not_found"}).AddRow("fake:id:tt0000000", true))
+
+	_, err = cached.ByID(" TT0000000 ")
+	assert.Equal(t, provider.ErrNotFound, err)
+
+	assert.Equal(t, 1, inner.calls)
+	assert.Equal(t, provider.CacheStats{Hits: 1, NegativeHits: 1, Misses: 1}, cached.Stats())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCachedHit(t *testing.T) {
+	db, mock := setupTestDB(t)
+	inner := &countingProvider{MovieProvider: provider.NewFake(fixturesDir)}
+	cached := provider.NewCached(db, inner)
+
+	mock.ExpectQuery(`SELECT \* FROM "provider_caches"`).
+		WithArgs("fake:id:tt0043014", sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "payload"}).
+			AddRow("fake:id:tt0043014", `{"imdbID":"tt0043014","Title":"Sunset Blvd."}`))
+
+	m, err := cached.ByID("tt0043014")
+	assert.NoError(t, err)
+	assert.Equal(t, "Sunset Blvd.", m.Title)
+	assert.Equal(t, 0, inner.calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
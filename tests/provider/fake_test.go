@@ -0,0 +1,46 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"totallyguysproject/internal/provider"
+)
+
+const fixturesDir = "../../data/fixtures/omdb"
+
+func TestFakeSearch(t *testing.T) {
+	p := provider.NewFake(fixturesDir)
+
+	res, err := p.Search("godfather", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res.Total)
+	assert.Len(t, res.Items, 3)
+
+	_, err = p.Search("no such movie", 1)
+	assert.Equal(t, provider.ErrNotFound, err)
+}
+
+func TestFakeByID(t *testing.T) {
+	p := provider.NewFake(fixturesDir)
+
+	m, err := p.ByID("tt0043014")
+	assert.NoError(t, err)
+	assert.Equal(t, "Sunset Blvd.", m.Title)
+	assert.Equal(t, "Billy Wilder", m.Director)
+
+	_, err = p.ByID("tt0000000")
+	assert.Equal(t, provider.ErrNotFound, err)
+}
+
+func TestFakeByTitle(t *testing.T) {
+	p := provider.NewFake(fixturesDir)
+
+	m, err := p.ByTitle("batman", "1989")
+	assert.NoError(t, err)
+	assert.Equal(t, "tt0096895", m.IMDbID)
+
+	_, err = p.ByTitle("Batman", "2005")
+	assert.Equal(t, provider.ErrNotFound, err)
+}
@@ -0,0 +1,84 @@
+package ratings_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/ratings"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestAddIncrementsCountersAndBucket(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectExec(`UPDATE movies SET\s+review_count = review_count \+ \$1,\s+rating_sum = rating_sum \+ \$2,\s+rating_histogram\[\$3\] = rating_histogram\[\$4\] \+ \$5`).
+		WithArgs(1, 8, 8, 8, 1, 8, 1, 42).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, ratings.Add(db, 42, 8))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeMovesBetweenBuckets(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectExec(`UPDATE movies SET`).
+		WithArgs(-1, -3, 3, 3, -1, -3, -1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE movies SET`).
+		WithArgs(1, 9, 9, 9, 1, 9, 1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, ratings.Change(db, 7, 3, 9))
+	// same rating: nothing to do
+	assert.NoError(t, ratings.Change(db, 7, 9, 9))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddRejectsOutOfRange(t *testing.T) {
+	db, _ := setupTestDB(t)
+
+	assert.Error(t, ratings.Add(db, 1, 11))
+	assert.Error(t, ratings.Remove(db, 1, 0))
+}
+
+func TestRecomputeReportsRepairedRows(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectExec(`COUNT\(\*\) FILTER \(WHERE rating = 10\).*m.id IN \(\$1,\$2\)`).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	fixed, err := ratings.Recompute(db, []uint{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fixed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRatingHistogramRoundTrip(t *testing.T) {
+	h := models.RatingHistogram{0, 0, 1, 0, 0, 0, 2, 5, 0, 1}
+
+	v, err := h.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "{0,0,1,0,0,0,2,5,0,1}", v)
+
+	var back models.RatingHistogram
+	assert.NoError(t, back.Scan([]byte("{0,0,1,0,0,0,2,5,0,1}")))
+	assert.Equal(t, h, back)
+
+	assert.Error(t, back.Scan("{1,2,3}"))
+}
@@ -0,0 +1,85 @@
+package reactions_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/reactions"
+	"totallyguysproject/internal/ws"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestWilsonPrefersConfidence(t *testing.T) {
+	assert.Equal(t, 0.0, reactions.Wilson(0, 0))
+	// 40 of 45 beats 2 of 2
+	assert.Greater(t, reactions.Wilson(40, 5), reactions.Wilson(2, 0))
+	// more of the same is surer
+	assert.Greater(t, reactions.Wilson(20, 0), reactions.Wilson(2, 0))
+	assert.Greater(t, reactions.Wilson(1, 0), reactions.Wilson(0, 1))
+	assert.InDelta(t, 0.5520, reactions.Wilson(10, 2), 0.0001)
+}
+
+func TestValidAndOpposite(t *testing.T) {
+	assert.True(t, reactions.Valid("funny"))
+	assert.False(t, reactions.Valid("love"))
+	assert.Equal(t, reactions.Unhelpful, reactions.Opposite(reactions.Helpful))
+	assert.Equal(t, reactions.Helpful, reactions.Opposite(reactions.Unhelpful))
+	assert.Equal(t, "", reactions.Opposite(reactions.Disagree))
+}
+
+func TestCountsFillsEveryType(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT review_id, type, count\(\*\) AS n FROM "review_reactions" WHERE review_id IN \(\$1,\$2\) GROUP BY review_id, type`).
+		WithArgs(3, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"review_id", "type", "n"}).
+			AddRow(3, "helpful", 5).
+			AddRow(3, "funny", 1))
+
+	counts, err := reactions.Counts(db, []uint{3, 4})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), counts[3]["helpful"])
+	assert.Equal(t, int64(1), counts[3]["funny"])
+	assert.Equal(t, int64(0), counts[3]["disagree"])
+	assert.Len(t, counts[4], len(reactions.Types))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotifyOneMessagePerAuthor(t *testing.T) {
+	db, mock := setupTestDB(t)
+	hubDB, _ := setupTestDB(t)
+	hub := ws.NewHub(hubDB)
+	defer hub.Stop()
+
+	since := time.Now().Add(-time.Minute)
+	newest := since.Add(30 * time.Second)
+	mock.ExpectQuery(`SELECT review_reactions.review_id, review_reactions.type, count\(\*\) AS n,.*FROM "review_reactions" JOIN reviews .* WHERE review_reactions.review_id IN \(\$1,\$2,\$3\) AND review_reactions.created_at > \$4 GROUP BY`).
+		WithArgs(3, 4, 7, since).
+		WillReturnRows(sqlmock.NewRows([]string{"review_id", "type", "n", "latest", "author_id", "movie_id", "movie_title"}).
+			AddRow(3, "funny", 1, since.Add(time.Second), 1, 10, "Heat").
+			AddRow(3, "helpful", 4, newest, 1, 10, "Heat").
+			AddRow(4, "helpful", 2, since.Add(2*time.Second), 1, 11, "Ronin").
+			AddRow(7, "disagree", 1, since.Add(3*time.Second), 2, 10, "Heat"))
+
+	n, latest, err := reactions.Notify(db, hub, []uint{3, 4, 7}, since)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, latest.Equal(newest))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,94 @@
+package recommend_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/recommend"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestComputeItemsReplacesNeighbours(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "item_similarities" WHERE movie_id IN \(\$1,\$2\)`).
+		WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	mock.ExpectExec(`FROM reviews WHERE deleted_at IS NULL\s+UNION ALL.*WHERE a1.movie_id IN \(\$\d+,\$\d+\).*INSERT INTO item_similarities`).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+	mock.ExpectCommit()
+
+	assert.NoError(t, recommend.ComputeItems(db, []uint{3, 5}, recommend.DefaultConfig()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestComputeUsersOnlyReadsTheirAffinities(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "recommendations" WHERE user_id IN \(\$1\)`).
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 50))
+	mock.ExpectExec(`UPDATE "users" SET "recommendations_computed_at"=\$1 WHERE id IN \(\$2\)`).
+		WithArgs(sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`AND user_id IN \(\$\d+\).*AND pl.owner_id IN \(\$\d+\).*WHERE f.follower_id IN \(\$\d+\).*INSERT INTO recommendations`).
+		WillReturnResult(sqlmock.NewResult(0, 50))
+	mock.ExpectCommit()
+
+	assert.NoError(t, recommend.ComputeUsers(db, []uint{9}, recommend.DefaultConfig()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRebuildDoesMoviesThenUsers(t *testing.T) {
+	db, mock := setupTestDB(t)
+	cfg := recommend.DefaultConfig()
+	cfg.BatchSize = 10
+
+	mock.ExpectQuery(`SELECT "id" FROM "movies" WHERE id > \$1`).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "item_similarities"`).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO item_similarities`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "id" FROM "movies" WHERE id > \$1`).
+		WithArgs(2, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id > \$1`).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "recommendations"`).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "users" SET "recommendations_computed_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO recommendations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id > \$1`).
+		WithArgs(4, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	movies, users, err := recommend.Rebuild(db, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, movies)
+	assert.Equal(t, 1, users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnqueueWithoutWorkerIsNoop(t *testing.T) {
+	recommend.Enqueue(1, 2, 3)
+}
@@ -0,0 +1,73 @@
+package similar_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/similar"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestComputeReplacesNeighbours(t *testing.T) {
+	db, mock := setupTestDB(t)
+	cfg := similar.DefaultConfig()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "movie_similarities" WHERE movie_id IN \(\$1,\$2\)`).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 30))
+	// marked even if nothing is found, the handlers don't redo it then
+	mock.ExpectExec(`UPDATE "movies" SET "similar_computed_at"=\$1 WHERE id IN \(\$2,\$3\)`).
+		WithArgs(sqlmock.AnyArg(), 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`SELECT id FROM movies WHERE id IN \(\$1,\$2\).*INSERT INTO movie_similarities`).
+		WillReturnResult(sqlmock.NewResult(0, 40))
+	mock.ExpectCommit()
+
+	assert.NoError(t, similar.Compute(db, []uint{1, 2}, cfg))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRebuildWalksAllMoviesInBatches(t *testing.T) {
+	db, mock := setupTestDB(t)
+	cfg := similar.DefaultConfig()
+	cfg.BatchSize = 2
+
+	mock.ExpectQuery(`SELECT "id" FROM "movies" WHERE id > \$1 .*ORDER BY id LIMIT \$2`).
+		WithArgs(0, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "movie_similarities"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "movies" SET "similar_computed_at"`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO movie_similarities`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "id" FROM "movies" WHERE id > \$1`).
+		WithArgs(4, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "movie_similarities"`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "movies" SET "similar_computed_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO movie_similarities`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "id" FROM "movies" WHERE id > \$1`).
+		WithArgs(7, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	n, err := similar.Rebuild(db, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,138 @@
+package smart_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/smart"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestValidateFillsDefaults(t *testing.T) {
+	rules := &models.SmartRules{Rules: []models.SmartRule{{Field: "genre", Op: "contains", Value: "noir"}}}
+
+	assert.NoError(t, smart.Validate(rules))
+	assert.Equal(t, "all", rules.Match)
+	assert.Equal(t, "rating", rules.Sort)
+	assert.Equal(t, smart.DefaultLimit, rules.Limit)
+
+	rules.Limit = 10000
+	assert.NoError(t, smart.Validate(rules))
+	assert.Equal(t, smart.MaxLimit, rules.Limit)
+}
+
+func TestValidateRejectsBadRules(t *testing.T) {
+	cases := map[string]models.SmartRules{
+		"no rules":      {},
+		"unknown field": {Rules: []models.SmartRule{{Field: "mood", Op: "contains", Value: "sad"}}},
+		"wrong op":      {Rules: []models.SmartRule{{Field: "genre", Op: "gt", Value: "noir"}}},
+		"not a number":  {Rules: []models.SmartRule{{Field: "year", Op: "lt", Value: "old"}}},
+		"empty text":    {Rules: []models.SmartRule{{Field: "director", Op: "contains", Value: " "}}},
+		"bad match":     {Match: "some", Rules: []models.SmartRule{{Field: "year", Op: "lt", Value: 1970.0}}},
+		"bad sort":      {Sort: "mood", Rules: []models.SmartRule{{Field: "year", Op: "lt", Value: 1970.0}}},
+		// names are not matched, a custom list can be called anything
+		"playlist name": {Rules: []models.SmartRule{{Field: "playlist", Op: "in", Value: "noir"}}},
+		"unknown kind":  {Rules: []models.SmartRule{{Field: "playlist", Op: "in", Value: map[string]interface{}{"kind": "custom"}}}},
+	}
+	for name, rules := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, smart.Validate(&rules))
+		})
+	}
+}
+
+func TestRefreshReplacesMatches(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	rules := &models.SmartRules{Match: "all", Rules: []models.SmartRule{
+		{Field: "genre", Op: "contains", Value: "Crime"},
+		{Field: "year", Op: "lt", Value: 1960.0},
+		{Field: "playlist", Op: "not_in", Value: map[string]interface{}{"kind": "watched"}},
+		{Field: "followed_rating", Op: "gte", Value: 8.0},
+	}}
+	playlist := &models.Playlist{Rules: rules}
+	playlist.ID = 5
+	playlist.OwnerID = 1
+
+	mock.ExpectQuery(`SELECT movies.id FROM "movies" WHERE \(\(movies.genre ILIKE \$1\) AND \(.*< \$2\) AND \(NOT EXISTS .*pl.owner_id = \$3 AND pl.kind = \$4\)\) AND \(EXISTS .*f.follower_id = \$5 .*r.rating >= \$6\)\).*ORDER BY .* LIMIT \$7`).
+		WithArgs("%Crime%", 1960.0, 1, "watched", 1, 8.0, smart.DefaultLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9).AddRow(3))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "smart_playlist_movies" WHERE playlist_id = \$1 AND movie_id NOT IN \(\$2,\$3\)`).
+		WithArgs(5, 9, 3).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	// matches that were already listed keep their added_at
+	mock.ExpectQuery(`INSERT INTO "smart_playlist_movies" .* ON CONFLICT \("playlist_id","movie_id"\) DO UPDATE SET "position"="excluded"."position" RETURNING "added_at"`).
+		WillReturnRows(sqlmock.NewRows([]string{"added_at"}).AddRow(nil).AddRow(nil))
+	mock.ExpectExec(`UPDATE "playlists" SET "refreshed_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, smart.Refresh(db, playlist))
+	assert.NotNil(t, playlist.RefreshedAt)
+	// the saved rules are left as they were; defaults are filled per refresh
+	assert.Equal(t, "", rules.Sort)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshWithNoMatchesEmptiesPlaylist(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	playlist := &models.Playlist{Rules: &models.SmartRules{Rules: []models.SmartRule{{Field: "my_rating", Op: "none"}}}}
+	playlist.ID = 5
+	playlist.OwnerID = 1
+
+	mock.ExpectQuery(`SELECT movies.id FROM "movies" WHERE \(\(NOT EXISTS \(SELECT 1 FROM reviews r`).
+		WithArgs(1, smart.DefaultLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "smart_playlist_movies" WHERE playlist_id = \$1$`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE "playlists" SET "refreshed_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, smart.Refresh(db, playlist))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshOwnersSkipsBrokenPlaylists(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "playlists" WHERE rules IS NOT NULL AND owner_id IN \(\$1\)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "rules"}).
+			AddRow(4, 1, `{"rules":[{"field":"mood","op":"contains","value":"sad"}]}`).
+			AddRow(5, 1, `{"rules":[{"field":"my_rating","op":"none"}]}`))
+	// playlist 4 fails validation, 5 is still refreshed
+	mock.ExpectQuery(`SELECT movies.id FROM "movies"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "smart_playlist_movies" WHERE playlist_id = \$1$`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "playlists" SET "refreshed_at"=\$1`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := smart.RefreshOwners(db, []uint{1})
+
+	assert.Equal(t, 1, n)
+	assert.ErrorContains(t, err, "playlist 4")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,157 @@
+package transfer_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/models"
+	"totallyguysproject/internal/transfer"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func zipOf(t *testing.T, files map[string]string) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, err := zw.Create(name)
+		assert.NoError(t, err)
+		f.Write([]byte(body))
+	}
+	assert.NoError(t, zw.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	return zr
+}
+
+func TestParseLetterboxd(t *testing.T) {
+	zr := zipOf(t, map[string]string{
+		"diary.csv": "\ufeffDate,Name,Year,Letterboxd URI,Rating,Rewatch,Tags,Watched Date\n" +
+			"2024-03-02,Heat,1995,https://boxd.it/a,4.5,Yes,,2024-03-01\n",
+		"ratings.csv": "Date,Name,Year,Letterboxd URI,Rating\n" +
+			"2024-01-01,Alien,1979,https://boxd.it/b,3\n",
+		"lists/noir.csv": "Letterboxd list export v7\n" +
+			"Date,Name,Tags,URL,Description\n" +
+			"2024-01-01,Best Noir,,https://boxd.it/l,Shadows\n" +
+			"\n" +
+			"Position,Name,Year,URL,Description\n" +
+			"1,Laura,1944,https://boxd.it/c,the portrait\n",
+		"profile.csv": "Date Joined,Username\n2020-01-01,someone\n",
+	})
+
+	rows, err := transfer.ParseLetterboxd(zr)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	byKind := map[string]transfer.Row{}
+	for _, r := range rows {
+		byKind[r.Kind] = r
+	}
+
+	diary := byKind[transfer.KindDiary]
+	assert.Equal(t, "Heat", diary.Title)
+	assert.Equal(t, 9, diary.Rating)
+	assert.True(t, diary.Rewatch)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), *diary.WatchedOn)
+	assert.Equal(t, 2, diary.Line)
+
+	assert.Equal(t, 6, byKind[transfer.KindRating].Rating)
+
+	list := byKind[transfer.KindList]
+	assert.Equal(t, "Best Noir", list.List)
+	assert.Equal(t, "Shadows", list.ListDescription)
+	assert.Equal(t, "the portrait", list.Description)
+	assert.Equal(t, "1944", list.Year)
+}
+
+func TestParseLetterboxdRejectsOtherZips(t *testing.T) {
+	_, err := transfer.ParseLetterboxd(zipOf(t, map[string]string{"notes.txt": "hi"}))
+	assert.Error(t, err)
+}
+
+func TestParseIMDb(t *testing.T) {
+	ratings := "Const,Your Rating,Date Rated,Title,URL,Title Type,Year\n" +
+		"tt0113277,8,2024-01-01,Heat,https://www.imdb.com/title/tt0113277/,Movie,1995\n"
+	rows, err := transfer.ParseIMDb(strings.NewReader(ratings), "ratings.csv", "")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, transfer.KindRating, rows[0].Kind)
+	assert.Equal(t, "tt0113277", rows[0].IMDbID)
+	assert.Equal(t, 8, rows[0].Rating)
+
+	list := "Position,Const,Created,Modified,Description,Title,URL,Title Type,IMDb Rating,Your Rating,Year\n" +
+		"1,tt0078748,2024-01-01,2024-01-01,,Alien,,Movie,8.5,7,1979\n" +
+		"2,tt0037008,2024-01-01,2024-01-01,,Laura,,Movie,7.9,,1944\n"
+	rows, err = transfer.ParseIMDb(strings.NewReader(list), "WATCHLIST.csv", "")
+	assert.NoError(t, err)
+	kinds := []string{}
+	for _, r := range rows {
+		kinds = append(kinds, r.Kind)
+	}
+	// a rated list entry also becomes a rating
+	assert.Equal(t, []string{transfer.KindWatchlist, transfer.KindRating, transfer.KindWatchlist}, kinds)
+
+	_, err = transfer.ParseIMDb(strings.NewReader("Name,Year\nHeat,1995\n"), "x.csv", "")
+	assert.Error(t, err)
+}
+
+func TestImporterReportsUnmatchedRows(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT \* FROM "movies" WHERE lower\(title\) = lower\(\$1\) AND year LIKE \$2`).
+		WithArgs("Nowhere Film", "2001%", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rows := []transfer.Row{
+		{File: "ratings.csv", Line: 2, Kind: transfer.KindRating, Title: "Nowhere Film", Year: "2001", Rating: 6},
+		{File: "ratings.csv", Line: 3, Kind: transfer.KindRating, Rating: 6},
+		// same film again: answered from the importer's cache
+		{File: "watched.csv", Line: 2, Kind: transfer.KindWatched, Title: "nowhere film", Year: "2001"},
+	}
+	job := models.ImportJob{}
+	importer := transfer.NewImporter(db, 4, nil)
+	assert.NoError(t, importer.Apply(rows, &job))
+
+	assert.Equal(t, 3, job.Rows)
+	assert.Equal(t, 3, job.UnmatchedCount)
+	assert.Equal(t, "no matching movie", job.Unmatched[0].Reason)
+	assert.Equal(t, "no title or IMDb id", job.Unmatched[1].Reason)
+	assert.Empty(t, importer.MovieIDs())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportIMDbRoundTrips(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectQuery(`SELECT movies.title, movies.year, movies.omdb_id, reviews.rating, reviews.content, reviews.created_at AS created FROM "reviews"`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"title", "year", "omdb_id", "rating", "content", "created"}).
+			AddRow("Heat", "1995", "tt0113277", 8, "", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	var buf bytes.Buffer
+	assert.NoError(t, transfer.ExportIMDb(db, 4, &buf))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rows, err := transfer.ParseIMDb(&buf, "ratings.csv", "")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "tt0113277", rows[0].IMDbID)
+	assert.Equal(t, 8, rows[0].Rating)
+	assert.Equal(t, "1995", rows[0].Year)
+}
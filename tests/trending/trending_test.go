@@ -0,0 +1,50 @@
+package trending_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"totallyguysproject/internal/trending"
+)
+
+func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	return gormDB, mock
+}
+
+func TestRefreshReplacesWindowSnapshot(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "trending_scores" WHERE time_window = \$1`).
+		WithArgs("day").
+		WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectExec(`WITH events AS .*pm.added_at >= \$\d+.*INSERT INTO trending_scores`).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectExec(`INSERT INTO "trending_snapshots" .* ON CONFLICT \("time_window"\) DO UPDATE`).
+		WithArgs("day", 42, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := trending.Refresh(db, "day", trending.DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshUnknownWindow(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	_, err := trending.Refresh(db, "year", trending.DefaultConfig())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}